@@ -26,6 +26,7 @@ import (
 	"github.com/rook/rook/pkg/cephmgr/cephd"
 	"github.com/rook/rook/pkg/cephmgr/mon"
 	"github.com/rook/rook/pkg/clusterd"
+	k8smon "github.com/rook/rook/pkg/operator/mon"
 	"github.com/rook/rook/pkg/util/flags"
 	"github.com/spf13/cobra"
 )
@@ -36,9 +37,13 @@ var apiCmd = &cobra.Command{
 	Hidden: true,
 }
 var apiPort int
+var apiMonSecret = k8smon.DefaultMonSecret()
 
 func init() {
 	apiCmd.Flags().IntVar(&apiPort, "api-port", 0, "port on which the api is listening")
+	apiCmd.Flags().StringVar(&apiMonSecret.Name, "mon-secret-name", apiMonSecret.Name, "the secret the mon keys are stored in")
+	apiCmd.Flags().StringVar(&apiMonSecret.MonKey, "mon-secret-key", apiMonSecret.MonKey, "the data key of the mon key in the secret")
+	apiCmd.Flags().StringVar(&apiMonSecret.AdminKey, "admin-secret-key", apiMonSecret.AdminKey, "the data key of the admin key in the secret")
 
 	flags.SetFlagsFromEnv(rootCmd.Flags(), "ROOK_OPERATOR")
 
@@ -68,7 +73,7 @@ func startAPI(cmd *cobra.Command, args []string) error {
 		ConnFactory:    mon.NewConnectionFactoryWithClusterInfo(&cfg.clusterInfo),
 		CephFactory:    factory,
 		Port:           apiPort,
-		ClusterHandler: apik8s.New(clientset, context, &cfg.clusterInfo, factory, cfg.containerVersion),
+		ClusterHandler: apik8s.New(clientset, context, &cfg.clusterInfo, factory, cfg.containerVersion, apiMonSecret),
 	}
 
 	return api.Run(context, apiCfg)
@@ -19,6 +19,7 @@ package main
 
 import (
 	"fmt"
+	"net"
 
 	"github.com/rook/rook/pkg/cephmgr/cephd"
 	"github.com/rook/rook/pkg/cephmgr/mon"
@@ -34,13 +35,21 @@ var monCmd = &cobra.Command{
 }
 
 var (
-	monName string
-	monPort int
+	monName        string
+	monPort        int
+	monV2Port      int
+	monForceQuorum bool
+	monPublicNet   string
+	monKeyring     string
 )
 
 func init() {
 	monCmd.Flags().StringVar(&monName, "name", "", "name of the monitor")
 	monCmd.Flags().IntVar(&monPort, "port", 0, "port of the monitor")
+	monCmd.Flags().IntVar(&monV2Port, "v2-port", 0, "port of the messenger v2 protocol of the monitor. 0 if the monitor only has the legacy protocol")
+	monCmd.Flags().BoolVar(&monForceQuorum, "force-quorum", false, "replace the monmap with a monmap that only has this monitor")
+	monCmd.Flags().StringVar(&monPublicNet, "public-network", "", "network in CIDR notation of the address the monitor binds to")
+	monCmd.Flags().StringVar(&monKeyring, "keyring", "", "path the keyring of the monitor is written to. defaults to the keyring in the data dir")
 
 	flags.SetFlagsFromEnv(monCmd.Flags(), "ROOKD")
 
@@ -57,12 +66,47 @@ func startMon(cmd *cobra.Command, args []string) error {
 	if monPort == 0 {
 		return fmt.Errorf("missing mon port")
 	}
+	if monV2Port != 0 {
+		// the ceph in this image cannot parse the msgr2 addresses in the mon addr or the monmap
+		return fmt.Errorf("the mon v2 port is not supported by this ceph version")
+	}
+
+	if monPublicNet != "" {
+		addr, err := publicNetworkAddr(monPublicNet)
+		if err != nil {
+			return err
+		}
+		cfg.networkInfo.ClusterAddrIPv4 = addr
+		cfg.networkInfo.PublicNetwork = monPublicNet
+	}
 
 	// at first start the local monitor needs to be added to the list of mons
 	clusterInfo.Monitors = mon.ParseMonEndpoints(cfg.monEndpoints)
 	clusterInfo.Monitors[monName] = mon.ToCephMon(monName, cfg.networkInfo.ClusterAddrIPv4)
 
-	monCfg := &mon.Config{Name: monName, Cluster: &clusterInfo, CephLauncher: cephd.New()}
+	monCfg := &mon.Config{Name: monName, Cluster: &clusterInfo, ForceQuorum: monForceQuorum, KeyringPath: monKeyring, CephLauncher: cephd.New()}
 	context := clusterd.NewDaemonContext(cfg.dataDir, cfg.cephConfigOverride, cfg.logLevel)
 	return mon.Run(context, monCfg)
 }
+
+// the address of a local interface in the public network. the node of the mon can have several networks.
+func publicNetworkAddr(network string) (string, error) {
+	ifaceAddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return "", fmt.Errorf("failed to get the interface addresses. %+v", err)
+	}
+	addrs := []string{}
+	for _, a := range ifaceAddrs {
+		if ipNet, ok := a.(*net.IPNet); ok {
+			addrs = append(addrs, ipNet.IP.String())
+		}
+	}
+	addr, err := clusterd.AddrInNetwork(network, addrs)
+	if err != nil {
+		return "", err
+	}
+	if addr == "" {
+		return "", fmt.Errorf("no address in public network %s. addresses: %v", network, addrs)
+	}
+	return addr, nil
+}
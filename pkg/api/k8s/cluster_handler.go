@@ -25,6 +25,7 @@ import (
 	"github.com/rook/rook/pkg/model"
 	"github.com/rook/rook/pkg/operator/k8sutil"
 	k8smds "github.com/rook/rook/pkg/operator/mds"
+	k8smon "github.com/rook/rook/pkg/operator/mon"
 	"k8s.io/client-go/1.5/kubernetes"
 )
 
@@ -34,10 +35,12 @@ type clusterHandler struct {
 	clusterInfo *mon.ClusterInfo
 	factory     client.ConnectionFactory
 	version     string
+	monSecret   k8smon.MonSecret
 }
 
-func New(clientset *kubernetes.Clientset, context *clusterd.DaemonContext, clusterInfo *mon.ClusterInfo, factory client.ConnectionFactory, containerVersion string) *clusterHandler {
-	return &clusterHandler{clientset: clientset, context: context, clusterInfo: clusterInfo, factory: factory, version: containerVersion}
+func New(clientset *kubernetes.Clientset, context *clusterd.DaemonContext, clusterInfo *mon.ClusterInfo, factory client.ConnectionFactory, containerVersion string,
+	monSecret k8smon.MonSecret) *clusterHandler {
+	return &clusterHandler{clientset: clientset, context: context, clusterInfo: clusterInfo, factory: factory, version: containerVersion, monSecret: monSecret}
 }
 
 func (s *clusterHandler) GetClusterInfo() (*mon.ClusterInfo, error) {
@@ -73,6 +76,7 @@ func (s *clusterHandler) GetObjectStoreConnectionInfo() (*model.ObjectStoreConne
 func (s *clusterHandler) StartFileSystem(fs *model.FilesystemRequest) error {
 	logger.Infof("Starting the MDS")
 	c := k8smds.New(k8sutil.Namespace, s.version, s.factory)
+	c.MonSecret = s.monSecret
 	return c.Start(s.clientset, s.clusterInfo)
 }
 
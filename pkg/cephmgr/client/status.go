@@ -43,6 +43,8 @@ type HealthStatus struct {
 		Epoch       int    `json:"epoch"`
 		Round       int    `json:"round"`
 		RoundStatus string `json:"round_status"`
+		// the skew of each mon relative to the leader. only reported when there is a mon besides the leader.
+		Mons []TimecheckMon `json:"mons"`
 	} `json:"timechecks"`
 	Summary       []HealthSummary `json:"summary"`
 	OverallStatus string          `json:"overall_status"`
@@ -66,6 +68,14 @@ type HealthService struct {
 	} `json:"store_stats"`
 }
 
+type TimecheckMon struct {
+	Name    string  `json:"name"`
+	Skew    float64 `json:"skew"`
+	Latency float64 `json:"latency"`
+	Health  string  `json:"health"`
+	Details string  `json:"details"`
+}
+
 type HealthSummary struct {
 	Severity string `json:"severity"`
 	Summary  string `json:"summary"`
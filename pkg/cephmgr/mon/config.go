@@ -33,6 +33,10 @@ import (
 type CephMonitorConfig struct {
 	Name     string `json:"name"`
 	Endpoint string `json:"endpoint"`
+	// EndpointV2 is the address of the messenger v2 protocol. Empty when the mon only has the legacy protocol.
+	EndpointV2 string `json:"endpointV2,omitempty"`
+	// FailureDomain is the failure domain of the node the mon was scheduled to, if the domains are known
+	FailureDomain string `json:"failureDomain,omitempty"`
 }
 
 type cephConfig struct {
@@ -89,6 +93,12 @@ func getMonDataDirPath(configDir, monName string) string {
 	return filepath.Join(getMonRunDirPath(configDir, monName), fmt.Sprintf("mon.%s", monName))
 }
 
+// GetMonAdminSocketPath returns the path of the admin socket of the given monitor. The daemon is started with this
+// path so that probes that query the socket agree with the daemon.
+func GetMonAdminSocketPath(configDir, clusterName, monName string) string {
+	return filepath.Join(getMonRunDirPath(configDir, monName), fmt.Sprintf("%s-mon.%s.asok", clusterName, monName))
+}
+
 func ConnectToClusterAsAdmin(context *clusterd.Context, factory client.ConnectionFactory, cluster *ClusterInfo) (client.Connection, error) {
 	if len(cluster.Monitors) == 0 {
 		return nil, errors.New("no monitors")
@@ -358,7 +368,7 @@ func addInitialMonitorsConfigFileSections(configFile *ini.File, cluster *Cluster
 			return err
 		}
 
-		if _, err := s.NewKey("mon addr", mon.Endpoint); err != nil {
+		if _, err := s.NewKey("mon addr", mon.Addrs()); err != nil {
 			return err
 		}
 	}
@@ -18,6 +18,7 @@ package mon
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/rook/rook/pkg/clusterd"
@@ -31,36 +32,95 @@ const (
 type Config struct {
 	Name    string
 	Cluster *ClusterInfo
+	// ForceQuorum replaces the monmap in the store with a monmap that only has this mon so it forms quorum alone
+	ForceQuorum bool
+	// KeyringPath is where the keyring of the mon is written. It defaults to the keyring in the run dir of the mon.
+	KeyringPath string
 	CephLauncher
 }
 
 func FlattenMonEndpoints(mons map[string]*CephMonitorConfig) string {
 	endpoints := []string{}
 	for _, m := range mons {
-		endpoints = append(endpoints, fmt.Sprintf("%s=%s", m.Name, m.Endpoint))
+		endpoints = append(endpoints, fmt.Sprintf("%s=%s", m.Name, m.Addrs()))
 	}
 	return strings.Join(endpoints, ",")
 }
 
+// Addrs returns the address of the mon in the form of the mon addr setting. A mon with the messenger v2 protocol
+// has the list of its v2 and v1 addresses.
+func (m *CephMonitorConfig) Addrs() string {
+	if m.EndpointV2 == "" {
+		return m.Endpoint
+	}
+	return fmt.Sprintf("[v2:%s,v1:%s]", m.EndpointV2, m.Endpoint)
+}
+
 func ParseMonEndpoints(input string) map[string]*CephMonitorConfig {
 	logger.Infof("parsing mon endpoints: %s", input)
 	mons := map[string]*CephMonitorConfig{}
-	rawMons := strings.Split(input, ",")
+	rawMons := splitMonAddrs(input)
 	for _, rawMon := range rawMons {
 		parts := strings.Split(rawMon, "=")
 		if len(parts) != 2 {
 			logger.Warningf("ignoring invalid monitor %s", rawMon)
 			continue
 		}
-		mons[parts[0]] = &CephMonitorConfig{Name: parts[0], Endpoint: parts[1]}
+		mons[parts[0]] = parseMonAddrs(parts[0], parts[1])
 	}
 	return mons
 }
 
+// a mon with the messenger v2 protocol has both of its addresses in brackets, for example
+// [v2:1.2.3.4:3300,v1:1.2.3.4:6789]
+func parseMonAddrs(name, addrs string) *CephMonitorConfig {
+	m := &CephMonitorConfig{Name: name}
+	if !strings.HasPrefix(addrs, "[v2:") || !strings.HasSuffix(addrs, "]") {
+		m.Endpoint = addrs
+		return m
+	}
+	for _, addr := range splitMonAddrs(addrs[1 : len(addrs)-1]) {
+		if strings.HasPrefix(addr, "v2:") {
+			m.EndpointV2 = strings.TrimPrefix(addr, "v2:")
+		} else {
+			m.Endpoint = strings.TrimPrefix(addr, "v1:")
+		}
+	}
+	return m
+}
+
+// split on the commas that are not in brackets. the brackets hold the addresses of a mon or an ipv6 address.
+func splitMonAddrs(input string) []string {
+	parts := []string{}
+	depth := 0
+	start := 0
+	for i, ch := range input {
+		switch ch {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, input[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, input[start:])
+}
+
 func ToCephMon(name, ip string) *CephMonitorConfig {
 	return &CephMonitorConfig{Name: name, Endpoint: fmt.Sprintf("%s:%d", ip, Port)}
 }
 
+// ToCephMonV2 returns the config of a mon that also listens for the messenger v2 protocol on the given port
+func ToCephMonV2(name, ip string, v2Port int) *CephMonitorConfig {
+	m := ToCephMon(name, ip)
+	m.EndpointV2 = fmt.Sprintf("%s:%d", ip, v2Port)
+	return m
+}
+
 func Run(context *clusterd.DaemonContext, config *Config) error {
 
 	configFile, monDataDir, err := generateConfigFiles(context, config)
@@ -79,14 +139,14 @@ func Run(context *clusterd.DaemonContext, config *Config) error {
 func generateConfigFiles(context *clusterd.DaemonContext, config *Config) (string, string, error) {
 
 	// write the keyring to disk
-	keyringPath := getMonKeyringPath(context.ConfigDir, config.Name)
+	keyringPath := config.keyringPath(context.ConfigDir)
 	if err := writeMonitorKeyring(config.Name, config.Cluster, keyringPath); err != nil {
 		return "", "", err
 	}
 
 	// write the config file to disk
 	confFilePath, err := GenerateConnectionConfigFile(clusterd.ToContext(context), config.Cluster, getMonRunDirPath(context.ConfigDir, config.Name),
-		"admin", getMonKeyringPath(context.ConfigDir, config.Name))
+		"admin", keyringPath)
 	if err != nil {
 		return "", "", err
 	}
@@ -109,7 +169,7 @@ func startMon(context *clusterd.DaemonContext, config *Config, confFilePath, mon
 	// call mon --mkfs in a child process
 	logger.Infof("initializing mon")
 
-	keyringPath := getMonKeyringPath(context.ConfigDir, config.Name)
+	keyringPath := config.keyringPath(context.ConfigDir)
 	err := context.ProcMan.Run(
 		fmt.Sprintf("mkfs-%s", config.Name),
 		"mon",
@@ -123,22 +183,82 @@ func startMon(context *clusterd.DaemonContext, config *Config, confFilePath, mon
 		return fmt.Errorf("failed mon %s --mkfs: %+v", config.Name, err)
 	}
 
+	if config.ForceQuorum {
+		if err := injectSingleMonMap(context, config, confFilePath, monDataDir); err != nil {
+			return fmt.Errorf("failed to force quorum on mon %s: %+v", config.Name, err)
+		}
+	}
+
 	// start the monitor daemon in the foreground with the given config
 	logger.Infof("starting mon")
 
 	util.WriteFileToLog(logger, confFilePath)
 
-	err = config.CephLauncher.Run(
-		"mon",
+	err = config.CephLauncher.Run("mon", monDaemonArgs(context.ConfigDir, config, confFilePath, monDataDir)...)
+	if err != nil {
+		return fmt.Errorf("failed to start mon: %+v", err)
+	}
+
+	return nil
+}
+
+// the keyring path the mon is started with
+func (c *Config) keyringPath(configDir string) string {
+	if c.KeyringPath != "" {
+		return c.KeyringPath
+	}
+	return getMonKeyringPath(configDir, c.Name)
+}
+
+// the args to run the mon daemon in the foreground
+func monDaemonArgs(configDir string, config *Config, confFilePath, monDataDir string) []string {
+	return []string{
 		"--foreground",
 		fmt.Sprintf("--cluster=%s", config.Cluster.Name),
 		fmt.Sprintf("--name=mon.%s", config.Name),
 		fmt.Sprintf("--mon-data=%s", monDataDir),
 		fmt.Sprintf("--conf=%s", confFilePath),
-		fmt.Sprintf("--keyring=%s", keyringPath))
-	if err != nil {
-		return fmt.Errorf("failed to start mon: %+v", err)
+		fmt.Sprintf("--keyring=%s", config.keyringPath(configDir)),
+		fmt.Sprintf("--admin-socket=%s", GetMonAdminSocketPath(configDir, config.Cluster.Name, config.Name)),
 	}
+}
 
+// Replace the monmap of the mon with a monmap that only has this mon. The mon image has no monmaptool to edit the
+// monmap, so the monmap is taken from a scratch store that mkfs creates from the config, where this mon is the
+// only mon. The current monmap is extracted first so it can be restored by hand.
+func injectSingleMonMap(context *clusterd.DaemonContext, config *Config, confFilePath, monDataDir string) error {
+	runDir := getMonRunDirPath(context.ConfigDir, config.Name)
+	scratchDir := filepath.Join(runDir, "recovery")
+	if err := os.RemoveAll(scratchDir); err != nil {
+		return fmt.Errorf("failed to clean the scratch store: %+v", err)
+	}
+	defer os.RemoveAll(scratchDir)
+
+	backupPath := filepath.Join(runDir, "monmap.bak")
+	monMapPath := filepath.Join(runDir, "monmap")
+	monArgs := func(dataDir string, args ...string) []string {
+		return append([]string{
+			fmt.Sprintf("--cluster=%s", config.Cluster.Name),
+			fmt.Sprintf("--name=mon.%s", config.Name),
+			fmt.Sprintf("--mon-data=%s", dataDir),
+			fmt.Sprintf("--conf=%s", confFilePath),
+		}, args...)
+	}
+
+	logger.Warningf("forcing quorum on mon %s. the current monmap is saved to %s", config.Name, backupPath)
+	steps := []struct {
+		name string
+		args []string
+	}{
+		{"extract-monmap", monArgs(monDataDir, fmt.Sprintf("--extract-monmap=%s", backupPath))},
+		{"mkfs-recovery", monArgs(scratchDir, "--mkfs", fmt.Sprintf("--keyring=%s", config.keyringPath(context.ConfigDir)))},
+		{"extract-recovery-monmap", monArgs(scratchDir, fmt.Sprintf("--extract-monmap=%s", monMapPath))},
+		{"inject-monmap", monArgs(monDataDir, fmt.Sprintf("--inject-monmap=%s", monMapPath))},
+	}
+	for _, step := range steps {
+		if err := context.ProcMan.Run(fmt.Sprintf("%s-%s", step.name, config.Name), "mon", step.args...); err != nil {
+			return fmt.Errorf("failed to %s: %+v", step.name, err)
+		}
+	}
 	return nil
 }
@@ -16,8 +16,13 @@ limitations under the License.
 package mon
 
 import (
+	"io/ioutil"
+	"os"
 	"testing"
 
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/rook/rook/pkg/util/proc"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -43,4 +48,57 @@ func TestMonFlattening(t *testing.T) {
 	assert.Equal(t, "1.2.3.4:5000", parsed["foo"].Endpoint)
 	assert.Equal(t, "bar", parsed["bar"].Name)
 	assert.Equal(t, "2.3.4.5:6000", parsed["bar"].Endpoint)
+
+	// the addresses of the messenger v2 and legacy protocols
+	mons = map[string]*CephMonitorConfig{"foo": ToCephMonV2("foo", "1.2.3.4", 3300)}
+	assert.Equal(t, "foo=[v2:1.2.3.4:3300,v1:1.2.3.4:6790]", FlattenMonEndpoints(mons))
+	parsed = ParseMonEndpoints("foo=[v2:1.2.3.4:3300,v1:1.2.3.4:6790],bar=2.3.4.5:6790,baz=[v2:[::1]:3300,v1:[::1]:6790]")
+	assert.Equal(t, 3, len(parsed))
+	assert.Equal(t, &CephMonitorConfig{Name: "foo", Endpoint: "1.2.3.4:6790", EndpointV2: "1.2.3.4:3300"}, parsed["foo"])
+	assert.Equal(t, &CephMonitorConfig{Name: "bar", Endpoint: "2.3.4.5:6790"}, parsed["bar"])
+	assert.Equal(t, &CephMonitorConfig{Name: "baz", Endpoint: "[::1]:6790", EndpointV2: "[::1]:3300"}, parsed["baz"])
+}
+
+func TestMonAdminSocketPath(t *testing.T) {
+	config := &Config{Name: "mon0", Cluster: &ClusterInfo{Name: "rookcluster"}}
+	args := monDaemonArgs("/var/lib/rook", config, "/var/lib/rook/mon0/rookcluster.config", "/var/lib/rook/mon0/mon.mon0")
+
+	// the daemon binds the socket where the probes look for it
+	socket := GetMonAdminSocketPath("/var/lib/rook", "rookcluster", "mon0")
+	assert.Equal(t, "/var/lib/rook/mon0/rookcluster-mon.mon0.asok", socket)
+	assert.Equal(t, "--admin-socket="+socket, args[len(args)-1])
+}
+
+func TestMonKeyringPath(t *testing.T) {
+	config := &Config{Name: "mon0", Cluster: &ClusterInfo{Name: "rookcluster"}}
+	args := monDaemonArgs("/var/lib/rook", config, "/var/lib/rook/mon0/rookcluster.config", "/var/lib/rook/mon0/mon.mon0")
+	assert.Equal(t, "--keyring=/var/lib/rook/mon0/keyring", args[5])
+
+	// the daemon reads the keyring from the custom path
+	config.KeyringPath = "/etc/ceph/keyring"
+	args = monDaemonArgs("/var/lib/rook", config, "/var/lib/rook/mon0/rookcluster.config", "/var/lib/rook/mon0/mon.mon0")
+	assert.Equal(t, "--keyring=/etc/ceph/keyring", args[5])
+}
+
+func TestInjectSingleMonMap(t *testing.T) {
+	configDir, err := ioutil.TempDir("", "mon")
+	assert.Nil(t, err)
+	defer os.RemoveAll(configDir)
+
+	actions := []string{}
+	executor := &exectest.MockExecutor{
+		MockExecuteCommand: func(actionName string, command string, args ...string) error {
+			actions = append(actions, actionName)
+			return nil
+		},
+	}
+	context := &clusterd.DaemonContext{ConfigDir: configDir, ProcMan: proc.New(executor)}
+	config := &Config{Name: "mon0", Cluster: &ClusterInfo{Name: "rookcluster"}, ForceQuorum: true}
+
+	// the monmap of the scratch store replaces the monmap of the mon after the current monmap is saved
+	err = injectSingleMonMap(context, config, "/tmp/rookcluster.config", getMonDataDirPath(configDir, "mon0"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"extract-monmap-mon0", "mkfs-recovery-mon0", "extract-recovery-monmap-mon0", "inject-monmap-mon0"}, actions)
+	_, err = os.Stat(getMonRunDirPath(configDir, "mon0") + "/recovery")
+	assert.True(t, os.IsNotExist(err))
 }
@@ -95,12 +95,17 @@ func CreateClusterInfo(factory client.ConnectionFactory, adminSecret string) (*C
 		}
 	}
 
+	return NewClusterInfo(fsid, monSecret, adminSecret), nil
+}
+
+// NewClusterInfo returns the info of a new cluster with the given fsid and keys
+func NewClusterInfo(fsid, monSecret, adminSecret string) *ClusterInfo {
 	return &ClusterInfo{
 		FSID:          fsid,
 		MonitorSecret: monSecret,
 		AdminSecret:   adminSecret,
 		Name:          "rookcluster",
-	}, nil
+	}
 }
 
 // save the given cluster info to the key value store
@@ -54,3 +54,18 @@ func verifyIPNetwork(network string) error {
 	_, _, err := net.ParseCIDR(network)
 	return err
 }
+
+// AddrInNetwork returns the first of the addresses in the network in CIDR notation, or an empty string if none of
+// the addresses are in the network
+func AddrInNetwork(network string, addrs []string) (string, error) {
+	_, ipNet, err := net.ParseCIDR(network)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse network %s. %+v", network, err)
+	}
+	for _, addr := range addrs {
+		if ip := net.ParseIP(addr); ip != nil && ipNet.Contains(ip) {
+			return addr, nil
+		}
+	}
+	return "", nil
+}
@@ -39,3 +39,17 @@ func TestVerifyNetworkInfo(t *testing.T) {
 	err = VerifyNetworkInfo(networkInfo)
 	assert.NotNil(t, err)
 }
+
+func TestAddrInNetwork(t *testing.T) {
+	addr, err := AddrInNetwork("10.1.2.0/24", []string{"10.1.1.1", "", "10.1.2.2", "10.1.2.3"})
+	assert.Nil(t, err)
+	assert.Equal(t, "10.1.2.2", addr)
+
+	// none of the addresses are in the network
+	addr, err = AddrInNetwork("10.1.2.0/24", []string{"10.1.1.1"})
+	assert.Nil(t, err)
+	assert.Equal(t, "", addr)
+
+	_, err = AddrInNetwork("10.1.2.0/33", []string{"10.1.2.2"})
+	assert.NotNil(t, err)
+}
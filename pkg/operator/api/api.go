@@ -36,6 +36,8 @@ type Cluster struct {
 	Namespace string
 	Version   string
 	Replicas  int32
+	// MonSecret is the secret the api reads the mon and admin keys from
+	MonSecret k8smon.MonSecret
 }
 
 func New(namespace, version string) *Cluster {
@@ -43,6 +45,7 @@ func New(namespace, version string) *Cluster {
 		Namespace: namespace,
 		Version:   version,
 		Replicas:  1,
+		MonSecret: k8smon.DefaultMonSecret(),
 	}
 }
 
@@ -101,13 +104,16 @@ func (c *Cluster) makeDeployment(cluster *mon.ClusterInfo) (*extensions.Deployme
 
 func (c *Cluster) apiContainer(cluster *mon.ClusterInfo) v1.Container {
 	// need a different prefix on the env vars
-	monSecretVar := k8smon.MonSecretEnvVar()
-	adminSecretVar := k8smon.AdminSecretEnvVar()
+	monSecretVar := c.MonSecret.MonSecretEnvVar()
+	adminSecretVar := c.MonSecret.AdminSecretEnvVar()
 	monSecretVar.Name = "ROOK_OPERATOR_MON_SECRET"
 	adminSecretVar.Name = "ROOK_OPERATOR_ADMIN_SECRET"
 
 	command := fmt.Sprintf("/usr/bin/rook-operator api --data-dir=%s --mon-endpoints=%s --cluster-name=%s --api-port=%d --container-version=%s",
 		k8sutil.DataDir, mon.FlattenMonEndpoints(cluster.Monitors), cluster.Name, model.Port, c.Version)
+	// the daemons the api starts read the keys from the same secret
+	command += fmt.Sprintf(" --mon-secret-name=%s --mon-secret-key=%s --admin-secret-key=%s",
+		c.MonSecret.Name, c.MonSecret.MonKey, c.MonSecret.AdminKey)
 	return v1.Container{
 		// TODO: fix "sleep 5".
 		// Without waiting some time, there is highly probable flakes in network setup.
@@ -20,6 +20,7 @@ package k8sutil
 
 import (
 	"net/http"
+	"regexp"
 
 	apierrors "k8s.io/client-go/1.5/pkg/api/errors"
 	"k8s.io/client-go/1.5/pkg/api/unversioned"
@@ -55,3 +56,20 @@ func IsKubernetesResourceNotFoundError(err error) bool {
 	}
 	return false
 }
+
+// the message of the api server when a validating or mutating admission webhook denies a request
+var admissionDeniedPattern = regexp.MustCompile(`admission webhook "([^"]+)" denied the request:?\s*(.*)`)
+
+// AdmissionWebhookRejection returns the webhook that denied the request and the reason it gave. Policy engines
+// like gatekeeper put the name of the violated policy in the reason.
+func AdmissionWebhookRejection(err error) (string, string, bool) {
+	se, ok := err.(*apierrors.StatusError)
+	if !ok {
+		return "", "", false
+	}
+	match := admissionDeniedPattern.FindStringSubmatch(se.Status().Message)
+	if match == nil {
+		return "", "", false
+	}
+	return match[1], match[2], true
+}
@@ -22,6 +22,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"regexp"
+	"strings"
 
 	"k8s.io/client-go/1.5/pkg/api"
 	unversionedAPI "k8s.io/client-go/1.5/pkg/api/unversioned"
@@ -36,8 +38,14 @@ const (
 	DefaultRepoPrefix = "quay.io/rook"
 	repoPrefixEnvVar  = "ROOK_OPERATOR_REPO_PREFIX"
 	defaultVersion    = "latest"
+	digestPrefix      = "sha256:"
+
+	// HostnameTopologyKey spreads pods across nodes
+	HostnameTopologyKey = "kubernetes.io/hostname"
 )
 
+var digestPattern = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
 func RepoPrefix() string {
 	var repoPrefix string
 	if repoPrefix = os.Getenv(repoPrefixEnvVar); repoPrefix == "" {
@@ -55,15 +63,40 @@ func getVersion(version string) string {
 	return version
 }
 
+// IsImageDigest returns whether the version pins the image by digest, for example sha256:<hex>, rather than by a tag
+func IsImageDigest(version string) bool {
+	return strings.HasPrefix(version, digestPrefix)
+}
+
+// ValidateImageVersion returns an error if the version is a digest that is not a sha256 digest of 64 hex characters
+func ValidateImageVersion(version string) error {
+	if IsImageDigest(version) && !digestPattern.MatchString(version) {
+		return fmt.Errorf("invalid image digest %s. expected %s followed by 64 lowercase hex characters", version, digestPrefix)
+	}
+	return nil
+}
+
+func makeImage(name, version string) string {
+	if IsImageDigest(version) {
+		return fmt.Sprintf("%s/%s@%s", RepoPrefix(), name, version)
+	}
+	return fmt.Sprintf("%s/%s:%v", RepoPrefix(), name, getVersion(version))
+}
+
 func MakeRookImage(version string) string {
-	return fmt.Sprintf("%s/rookd:%v", RepoPrefix(), getVersion(version))
+	return makeImage("rookd", version)
 }
 
 func MakeRookOperatorImage(version string) string {
-	return fmt.Sprintf("%s/rook-operator:%v", RepoPrefix(), getVersion(version))
+	return makeImage("rook-operator", version)
 }
 
 func PodWithAntiAffinity(pod *v1.Pod, attribute, value string) {
+	PodWithTopologyAntiAffinity(pod, attribute, value, HostnameTopologyKey)
+}
+
+// PodWithTopologyAntiAffinity keeps the pod out of the topology domains, for example the zones, of the other pods of the cluster
+func PodWithTopologyAntiAffinity(pod *v1.Pod, attribute, value, topologyKey string) {
 	// set pod anti-affinity with the pods that belongs to the same rook cluster
 	affinity := v1.Affinity{
 		PodAntiAffinity: &v1.PodAntiAffinity{
@@ -74,7 +107,7 @@ func PodWithAntiAffinity(pod *v1.Pod, attribute, value string) {
 							attribute: value,
 						},
 					},
-					TopologyKey: "kubernetes.io/hostname",
+					TopologyKey: topologyKey,
 				},
 			},
 		},
@@ -18,6 +18,7 @@ package k8sutil
 import (
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -46,3 +47,13 @@ func TestMakeRookOperatorImageWithEnv(t *testing.T) {
 func TestDefaultVersion(t *testing.T) {
 	assert.Equal(t, fmt.Sprintf("quay.io/rook/rook-operator:%s", defaultVersion), MakeRookOperatorImage(""))
 }
+
+func TestMakeRookImageDigest(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("0a", 32)
+	assert.Nil(t, ValidateImageVersion(digest))
+	assert.Equal(t, "quay.io/rook/rookd@"+digest, MakeRookImage(digest))
+
+	assert.Nil(t, ValidateImageVersion("v1"))
+	assert.NotNil(t, ValidateImageVersion("sha256:abc"))
+	assert.NotNil(t, ValidateImageVersion("sha256:"+strings.Repeat("0A", 32)))
+}
@@ -40,6 +40,8 @@ type Cluster struct {
 	Namespace string
 	Version   string
 	Replicas  int32
+	// MonSecret is the secret the mds reads the mon and admin keys from
+	MonSecret k8smon.MonSecret
 	factory   client.ConnectionFactory
 }
 
@@ -48,6 +50,7 @@ func New(namespace, version string, factory client.ConnectionFactory) *Cluster {
 		Namespace: namespace,
 		Version:   version,
 		Replicas:  1,
+		MonSecret: k8smon.DefaultMonSecret(),
 		factory:   factory,
 	}
 }
@@ -160,8 +163,8 @@ func (c *Cluster) mdsContainer(cluster *mon.ClusterInfo, id string) v1.Container
 		},
 		Env: []v1.EnvVar{
 			{Name: "ROOKD_MDS_KEYRING", ValueFrom: &v1.EnvVarSource{SecretKeyRef: &v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: appName}, Key: keyringName}}},
-			k8smon.MonSecretEnvVar(),
-			k8smon.AdminSecretEnvVar(),
+			c.MonSecret.MonSecretEnvVar(),
+			c.MonSecret.AdminSecretEnvVar(),
 		},
 	}
 }
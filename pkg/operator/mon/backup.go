@@ -0,0 +1,85 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rook/rook/pkg/cephmgr/mon"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/client-go/1.5/kubernetes"
+	"k8s.io/client-go/1.5/pkg/api"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+	"k8s.io/client-go/1.5/pkg/labels"
+)
+
+const (
+	// the label of the backups of the mon secret. the value is the name of the backed up secret.
+	backupOfAttr       = "rook.io/backup-of"
+	backupTimestampKey = "backup-timestamp"
+)
+
+// BackupClusterInfo saves a copy of the mon secret to a new secret before an operation that can lose the cluster,
+// such as forcing quorum or deleting the mons. The oldest backups are deleted so that MaxClusterInfoBackups remain.
+// The name of the new backup is returned.
+func (c *Cluster) BackupClusterInfo(clientset kubernetes.Interface, clusterInfo *mon.ClusterInfo) (string, error) {
+	now := time.Now().UTC()
+	// the names sort in the order the backups are created
+	name := fmt.Sprintf("%s-backup-%d", c.SecretName, now.UnixNano())
+
+	data := c.secretData(clusterInfo)
+	data[backupTimestampKey] = now.Format(time.RFC3339)
+	backupLabels := getLabels(clusterInfo.Name)
+	backupLabels[backupOfAttr] = c.SecretName
+	secret := &v1.Secret{
+		ObjectMeta: v1.ObjectMeta{Name: name, Namespace: c.Namespace, Labels: backupLabels},
+		StringData: data,
+		Type:       k8sutil.RookType,
+	}
+	if _, err := clientset.Core().Secrets(c.Namespace).Create(secret); err != nil {
+		return "", fmt.Errorf("failed to back up mon secret %s. %+v", c.SecretName, err)
+	}
+	logger.Infof("backed up mon secret %s to %s", c.SecretName, name)
+
+	if err := c.pruneClusterInfoBackups(clientset); err != nil {
+		// the new backup is saved. the old backups are pruned again after the next backup.
+		logger.Warningf("failed to delete old backups of mon secret %s. %+v", c.SecretName, err)
+	}
+	return name, nil
+}
+
+func (c *Cluster) pruneClusterInfoBackups(clientset kubernetes.Interface) error {
+	options := api.ListOptions{LabelSelector: labels.SelectorFromSet(map[string]string{backupOfAttr: c.SecretName})}
+	secrets, err := clientset.Core().Secrets(c.Namespace).List(options)
+	if err != nil {
+		return fmt.Errorf("failed to list the backups. %+v", err)
+	}
+
+	names := []string{}
+	for _, s := range secrets.Items {
+		names = append(names, s.Name)
+	}
+	sort.Strings(names)
+	for i := 0; i < len(names)-c.MaxClusterInfoBackups; i++ {
+		logger.Infof("deleting old backup %s", names[i])
+		if err := ignoreNotFound(clientset.Core().Secrets(c.Namespace).Delete(names[i], &api.DeleteOptions{})); err != nil {
+			return fmt.Errorf("failed to delete backup %s. %+v", names[i], err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/1.5/kubernetes/fake"
+	"k8s.io/client-go/1.5/pkg/api"
+)
+
+func TestBackupClusterInfo(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	c := New("ns", nil, "myversion")
+	c.MaxClusterInfoBackups = 2
+	info := testClusterInfo()
+
+	name, err := c.BackupClusterInfo(clientset, info)
+	assert.Nil(t, err)
+	secret, err := clientset.Core().Secrets("ns").Get(name)
+	assert.Nil(t, err)
+	assert.Equal(t, info.FSID, secret.StringData[fsidSecretName])
+	assert.Equal(t, info.MonitorSecret, secret.StringData[monSecretName])
+	assert.Equal(t, info.AdminSecret, secret.StringData[adminSecretName])
+	assert.Equal(t, info.Name, secret.StringData[clusterSecretName])
+	assert.NotEqual(t, "", secret.StringData[backupTimestampKey])
+	assert.Equal(t, appName, secret.Labels[backupOfAttr])
+
+	// only the newest backups are kept
+	second, err := c.BackupClusterInfo(clientset, info)
+	assert.Nil(t, err)
+	third, err := c.BackupClusterInfo(clientset, info)
+	assert.Nil(t, err)
+	secrets, err := clientset.Core().Secrets("ns").List(api.ListOptions{})
+	assert.Nil(t, err)
+	names := []string{}
+	for _, s := range secrets.Items {
+		names = append(names, s.Name)
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{second, third}, names)
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rook/rook/pkg/cephmgr/mon"
+)
+
+// in-memory cache of the cluster info loaded from the mon secrets, keyed by namespace
+type clusterInfoCache struct {
+	sync.Mutex
+	entries map[string]*cachedClusterInfo
+}
+
+type cachedClusterInfo struct {
+	info   *mon.ClusterInfo
+	loaded time.Time
+}
+
+func newClusterInfoCache() *clusterInfoCache {
+	return &clusterInfoCache{entries: map[string]*cachedClusterInfo{}}
+}
+
+// get the cluster info for the namespace if it was loaded within the ttl
+func (c *clusterInfoCache) get(namespace string, ttl time.Duration) *mon.ClusterInfo {
+	c.Lock()
+	defer c.Unlock()
+
+	entry, ok := c.entries[namespace]
+	if !ok || time.Since(entry.loaded) > ttl {
+		return nil
+	}
+	return copyClusterInfo(entry.info)
+}
+
+func (c *clusterInfoCache) set(namespace string, info *mon.ClusterInfo) {
+	c.Lock()
+	defer c.Unlock()
+	c.entries[namespace] = &cachedClusterInfo{info: copyClusterInfo(info), loaded: time.Now()}
+}
+
+func (c *clusterInfoCache) invalidate(namespace string) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.entries, namespace)
+}
+
+// the callers modify the monitors of the cluster info, so the cache never hands out its own copy
+func copyClusterInfo(info *mon.ClusterInfo) *mon.ClusterInfo {
+	result := *info
+	result.Monitors = map[string]*mon.CephMonitorConfig{}
+	for name, m := range info.Monitors {
+		result.Monitors[name] = m
+	}
+	return &result
+}
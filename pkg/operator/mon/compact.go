@@ -0,0 +1,75 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rook/rook/pkg/cephmgr/client"
+	"github.com/rook/rook/pkg/cephmgr/mon"
+)
+
+// CompactMonStore compacts the store of the mon to reclaim the space of the keys that were trimmed, for example
+// after a recovery bloated the store. The command returns when the compaction completed. With an empty mon name
+// the stores of all the mons in the cluster info are compacted one at a time.
+func (c *Cluster) CompactMonStore(clusterInfo *mon.ClusterInfo, monName string) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+
+	names := []string{monName}
+	if monName == "" {
+		names = []string{}
+		for name := range clusterInfo.Monitors {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	for _, name := range names {
+		if err := c.compactMon(clusterInfo, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// the mon that receives the compact command compacts its own store, so the connection only has the target mon
+func (c *Cluster) compactMon(clusterInfo *mon.ClusterInfo, name string) error {
+	m, ok := clusterInfo.Monitors[name]
+	if !ok {
+		return fmt.Errorf("mon %s is not in the cluster", name)
+	}
+	target := *clusterInfo
+	target.Monitors = map[string]*mon.CephMonitorConfig{name: m}
+
+	conn, err := c.connect(&target)
+	if err != nil {
+		return fmt.Errorf("failed to connect to mon %s. %+v", name, err)
+	}
+	defer conn.Shutdown()
+
+	logger.Infof("compacting the store of mon %s", name)
+	start := time.Now()
+	if _, err := client.ExecuteMonCommand(conn, map[string]interface{}{"prefix": "compact"}, "compact"); err != nil {
+		return fmt.Errorf("failed to compact the store of mon %s. %+v", name, err)
+	}
+	logger.Infof("compacted the store of mon %s in %v", name, time.Since(start))
+	return nil
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rook/rook/pkg/cephmgr/client"
+	"github.com/rook/rook/pkg/cephmgr/client/test"
+	"github.com/rook/rook/pkg/cephmgr/mon"
+	"github.com/stretchr/testify/assert"
+)
+
+// records the mons in the config file of each connection with the mon commands that were sent on it
+type compactFactory struct {
+	test.MockConnectionFactory
+	commands []string
+	fail     bool
+}
+
+type compactConn struct {
+	test.MockConnection
+	factory *compactFactory
+	mons    []string
+}
+
+func (f *compactFactory) NewConnWithClusterAndUser(clusterName string, userName string) (client.Connection, error) {
+	return &compactConn{factory: f}, nil
+}
+
+func (c *compactConn) ReadConfigFile(path string) error {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{"mon0", "mon1", "mon2"} {
+		if strings.Contains(string(buf), fmt.Sprintf("[mon.%s]", name)) {
+			c.mons = append(c.mons, name)
+		}
+	}
+	return nil
+}
+
+func (c *compactConn) MonCommand(args []byte) ([]byte, string, error) {
+	c.factory.commands = append(c.factory.commands, fmt.Sprintf("%v %s", c.mons, string(args)))
+	if c.factory.fail {
+		return nil, "", fmt.Errorf("mock compact failed")
+	}
+	return []byte{}, "", nil
+}
+
+func TestCompactMonStore(t *testing.T) {
+	configDir, err := ioutil.TempDir("", "compact")
+	assert.Nil(t, err)
+	defer os.RemoveAll(configDir)
+
+	factory := &compactFactory{}
+	c := New("ns", factory, "myversion")
+	c.configDir = configDir
+	info := testClusterInfo()
+	info.Monitors["mon0"] = mon.ToCephMon("mon0", "1.2.3.4")
+	info.Monitors["mon1"] = mon.ToCephMon("mon1", "1.2.3.5")
+	info.Monitors["mon2"] = mon.ToCephMon("mon2", "1.2.3.6")
+
+	// the command is sent on a connection to the target mon only
+	err = c.CompactMonStore(info, "mon1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{`[mon1] {"format":"json","prefix":"compact"}`}, factory.commands)
+	assert.Equal(t, 3, len(info.Monitors))
+
+	// all the mons are compacted in order
+	factory.commands = nil
+	err = c.CompactMonStore(info, "")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		`[mon0] {"format":"json","prefix":"compact"}`,
+		`[mon1] {"format":"json","prefix":"compact"}`,
+		`[mon2] {"format":"json","prefix":"compact"}`,
+	}, factory.commands)
+
+	// an unknown mon and a failed compaction are errors
+	err = c.CompactMonStore(info, "mon9")
+	assert.NotNil(t, err)
+	factory.commands = nil
+	factory.fail = true
+	err = c.CompactMonStore(info, "")
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, len(factory.commands))
+}
@@ -0,0 +1,211 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/rook/rook/pkg/cephmgr/mon"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/client-go/1.5/kubernetes"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+)
+
+const (
+	configOverrideName       = "mon-config-override"
+	configOverrideKey        = "config"
+	configOverrideVolumeName = "config-override"
+	configOverrideDir        = "/etc/rook/override"
+	configHashAnnotation     = "rook.io/config-hash"
+	resourcesHashAnnotation  = "rook.io/resources-hash"
+	dnsSrvNameSetting        = "mon_dns_srv_name"
+	publicNetworkSetting     = "public_network"
+
+	operatorVersionAnnotation = "rook.io/operator-version"
+	operatorIDAnnotation      = "rook.io/operator-id"
+)
+
+// the settings added to the mon config. the settings rook derives from the cluster take precedence over the overrides.
+func (c *Cluster) configSettings() map[string]string {
+	settings := map[string]string{}
+	for k, v := range c.ConfigOverrides {
+		settings[k] = v
+	}
+	if c.DNSSrvName != "" {
+		settings[dnsSrvNameSetting] = c.DNSSrvName
+	}
+	if c.PublicNetwork != "" {
+		settings[publicNetworkSetting] = c.PublicNetwork
+	}
+	return settings
+}
+
+// the ceph config file with the override settings in the global section, sorted so the content is stable
+func (c *Cluster) configOverrideContent() string {
+	settings := c.configSettings()
+	keys := []string{}
+	for k := range settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	content := "[global]\n"
+	for _, k := range keys {
+		content += fmt.Sprintf("%s = %s\n", k, settings[k])
+	}
+	return content
+}
+
+// check that the srv record the mons bootstrap from resolves. the name is resolved relative to the search
+// domains like ceph does.
+func (c *Cluster) validateDNSSrv() error {
+	if c.DNSSrvName == "" {
+		return nil
+	}
+	_, addrs, err := c.lookupSRV("", "", fmt.Sprintf("_%s._tcp", c.DNSSrvName))
+	if err != nil {
+		return fmt.Errorf("failed to resolve the mon srv record %s. %+v", c.DNSSrvName, err)
+	}
+	if len(addrs) == 0 {
+		return fmt.Errorf("the mon srv record %s has no targets", c.DNSSrvName)
+	}
+	return nil
+}
+
+func (c *Cluster) validatePublicNetwork() error {
+	if c.PublicNetwork == "" {
+		return nil
+	}
+	if _, _, err := net.ParseCIDR(c.PublicNetwork); err != nil {
+		return fmt.Errorf("invalid mon public network %s. %+v", c.PublicNetwork, err)
+	}
+	return nil
+}
+
+// the ceph in the rook image predates nautilus and cannot parse the msgr2 addresses of a v2 port in the
+// mon addr or the monmap, so the mons would not start
+func (c *Cluster) validateV2Port() error {
+	if c.V2Port != 0 {
+		return fmt.Errorf("the mon v2 port %d is not supported. the ceph version in the rook image only has the legacy messenger protocol", c.V2Port)
+	}
+	return nil
+}
+
+// the keyring is mounted in the dir of its path, which must not be a dir rook mounts for something else
+func (c *Cluster) validateKeyringMountPath() error {
+	if c.KeyringMountPath == "" {
+		return nil
+	}
+	if !path.IsAbs(c.KeyringMountPath) || strings.HasSuffix(c.KeyringMountPath, "/") {
+		return fmt.Errorf("invalid mon keyring mount path %s. the path must be the absolute path of a file", c.KeyringMountPath)
+	}
+	switch path.Dir(c.KeyringMountPath) {
+	case "/", k8sutil.DataDir, configOverrideDir, caBundleDir, serviceAccountTokenDir:
+		return fmt.Errorf("invalid mon keyring mount path %s. the dir of the path is already mounted", c.KeyringMountPath)
+	}
+	return nil
+}
+
+// the hash of the effective mon config. pods without overrides have an empty hash so that
+// pods created before the hash was introduced are not restarted needlessly.
+func (c *Cluster) configHash() string {
+	if len(c.configSettings()) == 0 {
+		return ""
+	}
+	return hashString(c.configOverrideContent())
+}
+
+// the hash of the resources of the mon. empty when the mon has no resources for the same reason as the config hash.
+func (c *Cluster) resourcesHash(config *MonConfig) string {
+	resources := c.monResources(config)
+	if len(resources.Limits) == 0 && len(resources.Requests) == 0 {
+		return ""
+	}
+	// the map keys are sorted when marshalled
+	buf, err := json.Marshal(resources)
+	if err != nil {
+		logger.Warningf("failed to marshal the resources of mon %s. %+v", config.Name, err)
+		return ""
+	}
+	return hashString(string(buf))
+}
+
+func hashString(s string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(s)))
+}
+
+// save the override settings to the config map that is mounted in the mon pods
+func (c *Cluster) saveConfigOverride(clientset kubernetes.Interface, namespace string, clusterInfo *mon.ClusterInfo) error {
+	if len(c.configSettings()) == 0 {
+		return nil
+	}
+
+	configMap := &v1.ConfigMap{
+		ObjectMeta: v1.ObjectMeta{
+			Name:            configOverrideName,
+			Namespace:       namespace,
+			Labels:          getLabels(clusterInfo.Name),
+			Annotations:     c.operatorAnnotations(),
+			OwnerReferences: c.ownerReferences(),
+		},
+		Data: map[string]string{configOverrideKey: c.configOverrideContent()},
+	}
+
+	_, err := clientset.Core().ConfigMaps(namespace).Create(configMap)
+	if err == nil {
+		logger.Infof("created mon config override")
+		return nil
+	}
+	if !k8sutil.IsKubernetesResourceAlreadyExistError(err) {
+		return fmt.Errorf("failed to create mon config override. %+v", err)
+	}
+
+	existing, err := clientset.Core().ConfigMaps(namespace).Get(configOverrideName)
+	if err != nil {
+		return fmt.Errorf("failed to get mon config override. %+v", err)
+	}
+	if c.foreign(existing.ObjectMeta) {
+		return nil
+	}
+	_, err = clientset.Core().ConfigMaps(namespace).Update(configMap)
+	if err != nil {
+		return fmt.Errorf("failed to update mon config override. %+v", err)
+	}
+	logger.Infof("updated mon config override")
+	return nil
+}
+
+// the volume for the config override file. nil if there are no overrides.
+func (c *Cluster) configOverrideVolume() *v1.Volume {
+	if len(c.configSettings()) == 0 {
+		return nil
+	}
+	return &v1.Volume{
+		Name: configOverrideVolumeName,
+		VolumeSource: v1.VolumeSource{
+			ConfigMap: &v1.ConfigMapVolumeSource{
+				LocalObjectReference: v1.LocalObjectReference{Name: configOverrideName},
+				Items:                []v1.KeyToPath{{Key: configOverrideKey, Path: configOverrideKey}},
+			},
+		},
+	}
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/1.5/kubernetes/fake"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+	"k8s.io/client-go/1.5/pkg/runtime"
+	core "k8s.io/client-go/1.5/testing"
+)
+
+// the kubelet is not running in the tests. mark created mon pods as running.
+func startCreatedPods(clientset *fake.Clientset) {
+	clientset.PrependReactor("create", "pods", func(action core.Action) (bool, runtime.Object, error) {
+		pod := action.(core.CreateAction).GetObject().(*v1.Pod)
+		pod.Status.Phase = v1.PodRunning
+		pod.Status.PodIP = "10.0.0.1"
+		return false, nil, nil
+	})
+}
+
+func TestConfigOverrideContent(t *testing.T) {
+	c := New("ns", nil, "myversion")
+	assert.Equal(t, "", c.configHash())
+	assert.Nil(t, c.configOverrideVolume())
+
+	c.ConfigOverrides = map[string]string{"mon_osd_full_ratio": ".90", "debug_mon": "10"}
+	assert.Equal(t, "[global]\ndebug_mon = 10\nmon_osd_full_ratio = .90\n", c.configOverrideContent())
+	hash := c.configHash()
+	assert.NotEqual(t, "", hash)
+
+	pod := c.makeMonPod(&MonConfig{Name: "mon0", Port: 6790}, testClusterInfo(), true, false)
+	assert.Equal(t, hash, pod.Annotations[configHashAnnotation])
+	assert.Equal(t, 2, len(pod.Spec.Volumes))
+	assert.Contains(t, pod.Spec.Containers[0].Command[2], "--ceph-config-override=/etc/rook/override/config")
+
+	c.ConfigOverrides["debug_mon"] = "20"
+	assert.NotEqual(t, hash, c.configHash())
+}
+
+func TestConfigChangeRollingRestart(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		testMonSecret("ns"),
+		testMonPod("mon0", "ns", "1.2.3.4", v1.PodRunning),
+		testMonPod("mon1", "ns", "1.2.3.5", v1.PodRunning),
+		testMonPod("mon2", "ns", "1.2.3.6", v1.PodRunning))
+	startCreatedPods(clientset)
+
+	c, _ := newTestHealthCluster(map[string]string{"mon_status": allInQuorumResponse})
+	c.PodStartRetries = 2
+	c.PodStartDelay = time.Millisecond
+
+	// the mons are not restarted when the config did not change
+	_, _, err := c.EnsureMons(clientset)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(podRestarts(clientset)))
+
+	c.ConfigOverrides = map[string]string{"debug_mon": "10"}
+	clientset.ClearActions()
+	_, _, err = c.EnsureMons(clientset)
+	assert.Nil(t, err)
+
+	configMap, err := clientset.Core().ConfigMaps("ns").Get(configOverrideName)
+	assert.Nil(t, err)
+	assert.Equal(t, c.configOverrideContent(), configMap.Data[configOverrideKey])
+
+	// each mon is deleted and recreated before the next mon is restarted
+	assert.Equal(t, []string{"delete mon0", "create mon0", "delete mon1", "create mon1", "delete mon2", "create mon2"}, podRestarts(clientset))
+
+	for _, name := range []string{"mon0", "mon1", "mon2"} {
+		pod, err := clientset.Core().Pods("ns").Get(name)
+		assert.Nil(t, err)
+		assert.Equal(t, c.configHash(), pod.Annotations[configHashAnnotation])
+	}
+}
+
+func TestDNSSrvName(t *testing.T) {
+	c := New("ns", nil, "myversion")
+	assert.Nil(t, c.validateDNSSrv())
+
+	c.DNSSrvName = "ceph-mon"
+	assert.Equal(t, "[global]\nmon_dns_srv_name = ceph-mon\n", c.configOverrideContent())
+	assert.NotNil(t, c.configOverrideVolume())
+
+	// the record is resolved relative to the search domains
+	lookedUp := ""
+	c.lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
+		lookedUp = name
+		return "", []*net.SRV{{Target: "mon0.rook-mon.ns.svc", Port: 6790}}, nil
+	}
+	assert.Nil(t, c.validateDNSSrv())
+	assert.Equal(t, "_ceph-mon._tcp", lookedUp)
+
+	c.lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
+		return "", nil, fmt.Errorf("no such host")
+	}
+	assert.NotNil(t, c.validateDNSSrv())
+	c.lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
+		return "", nil, nil
+	}
+	assert.NotNil(t, c.validateDNSSrv())
+}
+
+func TestPublicNetwork(t *testing.T) {
+	c := New("ns", nil, "myversion")
+	assert.Nil(t, c.validatePublicNetwork())
+
+	c.PublicNetwork = "10.1.2.0/33"
+	assert.NotNil(t, c.validatePublicNetwork())
+
+	c.PublicNetwork = "10.1.2.0/24"
+	assert.Nil(t, c.validatePublicNetwork())
+	assert.Equal(t, "[global]\npublic_network = 10.1.2.0/24\n", c.configOverrideContent())
+	container := c.makeMonPod(&MonConfig{Name: "mon0", Port: 6790}, testClusterInfo(), true, false).Spec.Containers[0]
+	assert.Contains(t, container.Command[2], " --public-network=10.1.2.0/24")
+
+	// the ip in the public network is chosen on the host network
+	pod := testMonPod("mon0", "ns", "10.1.1.1", v1.PodRunning)
+	pod.Status.HostIP = "10.1.2.2"
+	assert.Equal(t, "", c.monIP(pod))
+	c.HostNetwork = true
+	assert.Equal(t, "10.1.2.2", c.monIP(pod))
+	pod.Status.PodIP = "10.1.2.3"
+	assert.Equal(t, "10.1.2.3", c.monIP(pod))
+
+	// any ip is used without a public network
+	c.PublicNetwork = ""
+	pod.Status.PodIP = "10.1.1.1"
+	assert.Equal(t, "10.1.1.1", c.monIP(pod))
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rook/rook/pkg/cephmgr/client"
+	"github.com/rook/rook/pkg/cephmgr/mon"
+	"k8s.io/client-go/1.5/kubernetes"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+)
+
+const redacted = "<redacted>"
+
+// how long to wait for the port of a mon to accept a connection
+const monDialTimeout = 5 * time.Second
+
+func getPodLogs(clientset kubernetes.Interface, namespace, name string, opts *v1.PodLogOptions) ([]byte, error) {
+	return clientset.Core().Pods(namespace).GetLogs(name, opts).DoRaw()
+}
+
+// GetMonLogs returns the last tailLines lines of the logs of the mon container, or all of the logs when tailLines
+// is not positive. With previous the logs of the previous container are returned, for example after the mon crashed.
+func (c *Cluster) GetMonLogs(clientset kubernetes.Interface, monName string, tailLines int, previous bool) (string, error) {
+	opts := &v1.PodLogOptions{Container: MonContainerName, Previous: previous}
+	if tailLines > 0 {
+		lines := int64(tailLines)
+		opts.TailLines = &lines
+	}
+	logs, err := c.podLogs(clientset, c.Namespace, monName, opts)
+	if err != nil {
+		return "", fmt.Errorf("failed to get the logs of mon %s. %+v", monName, err)
+	}
+	return string(logs), nil
+}
+
+// CheckMonConnectivity dials the port of each mon in the cluster info and returns the mons that cannot be reached
+// with the reason. Mons that cannot reach each other never form quorum, which points to a network policy or a
+// problem with the pod network.
+func (c *Cluster) CheckMonConnectivity(clusterInfo *mon.ClusterInfo) map[string]error {
+	unreachable := map[string]error{}
+	for name, m := range clusterInfo.Monitors {
+		// the ipv6 endpoints of the cluster info are not bracketed
+		conn, err := c.dial("tcp", bracketEndpoint(m.Endpoint), monDialTimeout)
+		if err != nil {
+			logger.Warningf("mon %s at %s is not reachable. %+v", name, m.Endpoint, err)
+			unreachable[name] = err
+			continue
+		}
+		conn.Close()
+	}
+	return unreachable
+}
+
+// CollectDiagnostics gathers the mon pod logs and descriptions, the mon and quorum status, the monmap, and
+// the endpoints config map. The result maps a file name to its content, suitable for writing to a tarball.
+// Items that cannot be collected are reported in a file with the .error suffix. Env values and the cluster
+// keys are redacted.
+func (c *Cluster) CollectDiagnostics(clientset kubernetes.Interface, clusterInfo *mon.ClusterInfo) (map[string][]byte, error) {
+	files := map[string][]byte{}
+
+	pods, err := clientset.Core().Pods(c.Namespace).List(listOptions(clusterInfo.Name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list mon pods. %+v", err)
+	}
+	for _, pod := range pods.Items {
+		logs, err := c.podLogs(clientset, c.Namespace, pod.Name, &v1.PodLogOptions{Container: MonContainerName})
+		addDiagnostic(files, fmt.Sprintf("logs/%s.log", pod.Name), logs, err)
+
+		for i := range pod.Spec.Containers {
+			for j := range pod.Spec.Containers[i].Env {
+				if pod.Spec.Containers[i].Env[j].Value != "" {
+					pod.Spec.Containers[i].Env[j].Value = redacted
+				}
+			}
+		}
+		desc, err := json.MarshalIndent(pod, "", "  ")
+		addDiagnostic(files, fmt.Sprintf("pods/%s.json", pod.Name), desc, err)
+	}
+
+	endpoints, err := clientset.Core().ConfigMaps(c.Namespace).Get(EndpointConfigMapName)
+	if err == nil {
+		buf, err := json.MarshalIndent(endpoints.Data, "", "  ")
+		addDiagnostic(files, "endpoints.json", buf, err)
+	} else {
+		addDiagnostic(files, "endpoints.json", nil, err)
+	}
+
+	commands := map[string]string{"mon_status": "mon_status.json", "quorum_status": "quorum_status.json", "mon dump": "monmap.json"}
+	conn, err := c.connect(clusterInfo)
+	if err != nil {
+		for _, name := range commands {
+			addDiagnostic(files, name, nil, err)
+		}
+	} else {
+		defer conn.Shutdown()
+		for prefix, name := range commands {
+			buf, err := client.ExecuteMonCommand(conn, map[string]interface{}{"prefix": prefix}, prefix)
+			addDiagnostic(files, name, buf, err)
+		}
+	}
+
+	// the keys should never appear in the output, but the logs are not under our control
+	for name, content := range files {
+		for _, secret := range []string{clusterInfo.MonitorSecret, clusterInfo.AdminSecret} {
+			if secret != "" {
+				content = bytes.Replace(content, []byte(secret), []byte(redacted), -1)
+			}
+		}
+		files[name] = content
+	}
+
+	return files, nil
+}
+
+func addDiagnostic(files map[string][]byte, name string, content []byte, err error) {
+	if err != nil {
+		files[name+".error"] = []byte(err.Error())
+		return
+	}
+	files[name] = content
+}
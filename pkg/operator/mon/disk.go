@@ -0,0 +1,96 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/rook/rook/pkg/cephmgr/client"
+	"github.com/rook/rook/pkg/cephmgr/mon"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/client-go/1.5/kubernetes"
+	"k8s.io/client-go/1.5/pkg/api/resource"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+)
+
+// MonDiskUsage is how full the data volume of a mon is
+type MonDiskUsage struct {
+	Name string
+	// UsedPercent is the used share of the filesystem of the mon data dir as reported by the mon
+	UsedPercent int
+	// StoreBytes is the size of the mon store, which is most of the used space
+	StoreBytes int64
+	// Capacity is the capacity of the data volume claim of the mon. Zero when the mon data is on an empty dir.
+	Capacity resource.Quantity
+}
+
+// CheckMonDiskSpace returns the mons whose data volume is at least MonDiskWarnPercent full, sorted by name. Each
+// mon reports the usage of the filesystem of its data dir in the ceph status. The mons shut down when the volume
+// fills up, so the warning gives the time to expand the volumes or compact the stores before quorum is lost.
+func (c *Cluster) CheckMonDiskSpace(clientset kubernetes.Interface, clusterInfo *mon.ClusterInfo) ([]MonDiskUsage, error) {
+	conn, err := c.connect(clusterInfo)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Shutdown()
+
+	status, err := client.Status(conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ceph status. %+v", err)
+	}
+
+	full := []MonDiskUsage{}
+	for _, service := range status.Health.Details.Services {
+		for _, m := range service["mons"] {
+			// the mon has not reported its usage yet
+			if m.KbTotal == 0 {
+				continue
+			}
+			usage := MonDiskUsage{
+				Name:        m.Name,
+				UsedPercent: int(m.KbUsed * 100 / m.KbTotal),
+				StoreBytes:  int64(m.StoreStats.BytesTotal),
+			}
+			if usage.UsedPercent < c.MonDiskWarnPercent {
+				continue
+			}
+
+			if c.usePVC() {
+				claim, err := clientset.Core().PersistentVolumeClaims(c.Namespace).Get(dataVolumeClaimName(m.Name))
+				if err != nil && !k8sutil.IsKubernetesResourceNotFoundError(err) {
+					return nil, fmt.Errorf("failed to get data volume claim of mon %s. %+v", m.Name, err)
+				}
+				if err == nil {
+					usage.Capacity = claim.Status.Capacity[v1.ResourceStorage]
+				}
+				logger.Warningf("the data volume %s of mon %s is %d%% full. expand the volume or compact the mon store",
+					dataVolumeClaimName(m.Name), m.Name, usage.UsedPercent)
+			} else {
+				logger.Warningf("the data dir of mon %s is %d%% full. free space on the node or compact the mon store", m.Name, usage.UsedPercent)
+			}
+			full = append(full, usage)
+		}
+	}
+	sort.Sort(byDiskUsageName(full))
+	return full, nil
+}
+
+type byDiskUsageName []MonDiskUsage
+
+func (m byDiskUsageName) Len() int           { return len(m) }
+func (m byDiskUsageName) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+func (m byDiskUsageName) Less(i, j int) bool { return m[i].Name < m[j].Name }
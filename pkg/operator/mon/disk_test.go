@@ -0,0 +1,60 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/1.5/kubernetes/fake"
+	"k8s.io/client-go/1.5/pkg/api/resource"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+)
+
+func TestCheckMonDiskSpace(t *testing.T) {
+	c, info := newTestHealthCluster(map[string]string{
+		`"prefix":"status"`: `{"health":{"health":{"health_services":[{"mons":[` +
+			`{"name":"mon2","kb_total":1000,"kb_used":900,"store_stats":{"bytes_total":800000}},` +
+			`{"name":"mon0","kb_total":1000,"kb_used":400,"store_stats":{"bytes_total":300000}},` +
+			`{"name":"mon1","kb_total":1000,"kb_used":700,"store_stats":{"bytes_total":600000}},` +
+			`{"name":"mon3"}]}]}}}`,
+	})
+	clientset := fake.NewSimpleClientset()
+
+	// mon1 and mon2 are near full. mon3 did not report its usage.
+	full, err := c.CheckMonDiskSpace(clientset, info)
+	assert.Nil(t, err)
+	assert.Equal(t, []MonDiskUsage{{Name: "mon1", UsedPercent: 70, StoreBytes: 600000}, {Name: "mon2", UsedPercent: 90, StoreBytes: 800000}}, full)
+
+	// the capacity of the volume is reported when the mon data is on a claim
+	c.MonDiskWarnPercent = 80
+	c.DataVolumeSize = resource.MustParse("1Gi")
+	claim := c.makeDataVolumeClaim(&MonConfig{Name: "mon2"}, info)
+	claim.Status.Capacity = v1.ResourceList{v1.ResourceStorage: resource.MustParse("2Gi")}
+	_, err = clientset.Core().PersistentVolumeClaims("ns").Create(claim)
+	assert.Nil(t, err)
+	full, err = c.CheckMonDiskSpace(clientset, info)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(full)) {
+		assert.Equal(t, "mon2", full[0].Name)
+		assert.Equal(t, "2Gi", full[0].Capacity.String())
+	}
+
+	// a failed status is returned
+	c, info = newTestHealthCluster(map[string]string{`"prefix":"status"`: "not json"})
+	_, err = c.CheckMonDiskSpace(clientset, info)
+	assert.NotNil(t, err)
+}
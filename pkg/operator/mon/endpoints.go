@@ -0,0 +1,205 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rook/rook/pkg/cephmgr/mon"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/client-go/1.5/kubernetes"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+)
+
+const (
+	// EndpointConfigMapName is the config map that clients mount to discover the mons
+	EndpointConfigMapName = "rook-ceph-mon-endpoints"
+	// EndpointDataKey is the key of the comma-separated mon endpoints in the config map
+	EndpointDataKey = "data"
+	// EndpointFSIDKey is the key of the cluster fsid in the config map
+	EndpointFSIDKey = "fsid"
+)
+
+// save the mon endpoints and fsid to the well-known config map if they changed
+func (c *Cluster) saveEndpoints(clientset kubernetes.Interface, namespace string, clusterInfo *mon.ClusterInfo) error {
+	data := map[string]string{
+		EndpointDataKey: MonEndpointString(clusterInfo),
+		EndpointFSIDKey: clusterInfo.FSID,
+	}
+
+	configMap, err := clientset.Core().ConfigMaps(namespace).Get(EndpointConfigMapName)
+	if err != nil {
+		if !k8sutil.IsKubernetesResourceNotFoundError(err) {
+			return fmt.Errorf("failed to get mon endpoints. %+v", err)
+		}
+
+		configMap = &v1.ConfigMap{
+			ObjectMeta: v1.ObjectMeta{
+				Name:            EndpointConfigMapName,
+				Namespace:       namespace,
+				Labels:          getLabels(clusterInfo.Name),
+				Annotations:     c.operatorAnnotations(),
+				OwnerReferences: c.ownerReferences(),
+			},
+			Data: data,
+		}
+		if _, err := clientset.Core().ConfigMaps(namespace).Create(configMap); err != nil {
+			return fmt.Errorf("failed to create mon endpoints. %+v", err)
+		}
+		logger.Infof("saved mon endpoints %s", data[EndpointDataKey])
+		return nil
+	}
+
+	if c.foreign(configMap.ObjectMeta) {
+		return nil
+	}
+	data[EndpointDataKey] = MonEndpointString(c.throttleEndpoints(clusterInfo, configMap.Data[EndpointDataKey]))
+	// the config map was created before the mon resource owned it
+	owned := c.owner == nil || len(configMap.OwnerReferences) > 0
+	if configMap.Data[EndpointDataKey] == data[EndpointDataKey] && configMap.Data[EndpointFSIDKey] == data[EndpointFSIDKey] && owned {
+		return nil
+	}
+	configMap.Data = data
+	if !owned {
+		configMap.OwnerReferences = c.ownerReferences()
+	}
+	if _, err := clientset.Core().ConfigMaps(namespace).Update(configMap); err != nil {
+		return fmt.Errorf("failed to update mon endpoints. %+v", err)
+	}
+	logger.Infof("updated mon endpoints to %s", data[EndpointDataKey])
+	return nil
+}
+
+// the cluster info with the saved endpoint of each mon whose endpoint changed less than EndpointChangeInterval ago.
+// the latest endpoint is saved by the first save after the interval.
+func (c *Cluster) throttleEndpoints(clusterInfo *mon.ClusterInfo, saved string) *mon.ClusterInfo {
+	if c.EndpointChangeInterval == 0 {
+		return clusterInfo
+	}
+	c.endpointsLock.Lock()
+	defer c.endpointsLock.Unlock()
+	if c.endpointChanged == nil {
+		c.endpointChanged = map[string]time.Time{}
+	}
+
+	previous := mon.ParseMonEndpoints(saved)
+	throttled := *clusterInfo
+	throttled.Monitors = map[string]*mon.CephMonitorConfig{}
+	for name, m := range clusterInfo.Monitors {
+		throttled.Monitors[name] = m
+		old, ok := previous[name]
+		if !ok || sameEndpoints(old, m) {
+			continue
+		}
+		if changed, ok := c.endpointChanged[name]; ok && time.Since(changed) < c.EndpointChangeInterval {
+			logger.Infof("throttling the endpoint change of mon %s from %s to %s. the endpoint changed %v ago",
+				name, old.Addrs(), m.Addrs(), time.Since(changed))
+			throttled.Monitors[name] = old
+			continue
+		}
+		c.endpointChanged[name] = time.Now()
+	}
+	return &throttled
+}
+
+func sameEndpoints(a, b *mon.CephMonitorConfig) bool {
+	return bracketEndpoint(a.Endpoint) == bracketEndpoint(b.Endpoint) && bracketEndpoint(a.EndpointV2) == bracketEndpoint(b.EndpointV2)
+}
+
+// RefreshMonEndpoints updates the mons in the cluster info with the current IPs of the running mon pods
+// and saves the endpoints to the config map. The mons without a running pod are removed from the endpoints. Clients
+// that cached the endpoints call this after mons were rescheduled.
+func (c *Cluster) RefreshMonEndpoints(clientset kubernetes.Interface, clusterInfo *mon.ClusterInfo) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+
+	running, _, err := c.pollPods(clientset, c.Namespace, clusterInfo.Name)
+	if err != nil {
+		return fmt.Errorf("failed to get mon pods. %+v", err)
+	}
+
+	monitors := map[string]*mon.CephMonitorConfig{}
+	for _, pod := range running {
+		if fsid, ok := pod.Annotations[fsidAnnotation]; ok && fsid != clusterInfo.FSID {
+			continue
+		}
+		if c.monIP(pod) == "" {
+			// the mon keeps its endpoint until its ip is assigned
+			if m, ok := clusterInfo.Monitors[pod.Name]; ok {
+				monitors[pod.Name] = m
+			}
+			continue
+		}
+		monitors[pod.Name] = c.cephMon(c.Namespace, pod.Name, c.monIP(pod))
+	}
+	if len(monitors) == 0 {
+		// the saved endpoints are kept rather than cleared
+		return fmt.Errorf("no running mons found")
+	}
+	clusterInfo.Monitors = monitors
+	for _, pod := range running {
+		if _, ok := monitors[pod.Name]; ok {
+			c.captureFailureDomain(clientset, clusterInfo, pod)
+		}
+	}
+
+	return c.saveEndpoints(clientset, c.Namespace, clusterInfo)
+}
+
+// the endpoints of the mon at the pod ip and the port of the mons, with the messenger v2 endpoint when the mons have a
+// v2 port
+func (c *Cluster) cephMon(namespace, name, podIP string) *mon.CephMonitorConfig {
+	host := c.monHost(namespace, name, podIP)
+	m := &mon.CephMonitorConfig{Name: name, Endpoint: fmt.Sprintf("%s:%d", host, c.port())}
+	if c.V2Port != 0 {
+		m.EndpointV2 = fmt.Sprintf("%s:%d", host, c.V2Port)
+	}
+	return m
+}
+
+// MonEndpointString returns the mon endpoints in the form ceph expects, for example
+// mon0=1.2.3.4:6790,mon1=[fe80::1]:6790. The mons are sorted by name and ipv6 addresses are bracketed.
+// A mon with a messenger v2 endpoint has both of its endpoints, for example mon0=[v2:1.2.3.4:3300,v1:1.2.3.4:6790].
+func MonEndpointString(clusterInfo *mon.ClusterInfo) string {
+	endpoints := []string{}
+	for _, m := range clusterInfo.Monitors {
+		if m.EndpointV2 != "" {
+			endpoints = append(endpoints, fmt.Sprintf("%s=[v2:%s,v1:%s]", m.Name, bracketEndpoint(m.EndpointV2), bracketEndpoint(m.Endpoint)))
+			continue
+		}
+		endpoints = append(endpoints, fmt.Sprintf("%s=%s", m.Name, bracketEndpoint(m.Endpoint)))
+	}
+	sort.Strings(endpoints)
+	return strings.Join(endpoints, ",")
+}
+
+// the port follows the last colon of the endpoint. the host is bracketed if it is an ipv6 address.
+func bracketEndpoint(endpoint string) string {
+	if strings.HasPrefix(endpoint, "[") {
+		return endpoint
+	}
+	i := strings.LastIndex(endpoint, ":")
+	if i < 0 {
+		return endpoint
+	}
+	return net.JoinHostPort(endpoint[:i], endpoint[i+1:])
+}
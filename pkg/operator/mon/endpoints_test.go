@@ -0,0 +1,231 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rook/rook/pkg/cephmgr/mon"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/1.5/kubernetes/fake"
+	"k8s.io/client-go/1.5/pkg/api"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+	"k8s.io/client-go/1.5/pkg/runtime"
+	core "k8s.io/client-go/1.5/testing"
+)
+
+func TestSaveEndpoints(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		testMonPod("mon0", "ns", "1.2.3.4", v1.PodRunning),
+		testMonPod("mon1", "ns", "1.2.3.5", v1.PodRunning),
+		testMonPod("mon2", "ns", "1.2.3.6", v1.PodRunning))
+	c := New("ns", nil, "myversion")
+	mons := []*MonConfig{{Name: "mon0", Port: 6790}, {Name: "mon1", Port: 6790}, {Name: "mon2", Port: 6790}}
+
+	info := testClusterInfo()
+	_, err := c.startPods(clientset, info, mons)
+	assert.Nil(t, err)
+
+	configMap, err := clientset.Core().ConfigMaps("ns").Get(EndpointConfigMapName)
+	assert.Nil(t, err)
+	assert.Equal(t, "mon0=1.2.3.4:6790,mon1=1.2.3.5:6790,mon2=1.2.3.6:6790", configMap.Data[EndpointDataKey])
+	assert.Equal(t, info.FSID, configMap.Data[EndpointFSIDKey])
+	assert.Equal(t, info.Monitors, mon.ParseMonEndpoints(configMap.Data[EndpointDataKey]))
+
+	// the config map follows the endpoints when a mon moves
+	info.Monitors["mon1"] = mon.ToCephMon("mon1", "1.2.3.7")
+	err = c.saveEndpoints(clientset, "ns", info)
+	assert.Nil(t, err)
+	configMap, err = clientset.Core().ConfigMaps("ns").Get(EndpointConfigMapName)
+	assert.Nil(t, err)
+	assert.Equal(t, "mon0=1.2.3.4:6790,mon1=1.2.3.7:6790,mon2=1.2.3.6:6790", configMap.Data[EndpointDataKey])
+
+	// nothing is written when the endpoints did not change
+	clientset.ClearActions()
+	err = c.saveEndpoints(clientset, "ns", info)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(clientset.Actions()))
+}
+
+func TestSaveEndpointsIncrementally(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	startCreatedPods(clientset)
+
+	// record the endpoints every time the config map is written
+	saved := []string{}
+	record := func(action core.Action) (bool, runtime.Object, error) {
+		var obj runtime.Object
+		if a, ok := action.(core.CreateAction); ok {
+			obj = a.GetObject()
+		} else {
+			obj = action.(core.UpdateAction).GetObject()
+		}
+		if configMap := obj.(*v1.ConfigMap); configMap.Name == EndpointConfigMapName {
+			saved = append(saved, configMap.Data[EndpointDataKey])
+		}
+		return false, nil, nil
+	}
+	clientset.PrependReactor("create", "configmaps", record)
+	clientset.PrependReactor("update", "configmaps", record)
+
+	c := New("ns", nil, "myversion")
+	c.PodStartDelay = time.Millisecond
+	mons := []*MonConfig{{Name: "mon0", Port: 6790}, {Name: "mon1", Port: 6790}, {Name: "mon2", Port: 6790}}
+
+	_, err := c.startPods(clientset, testClusterInfo(), mons)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"mon0=10.0.0.1:6790",
+		"mon0=10.0.0.1:6790,mon1=10.0.0.1:6790",
+		"mon0=10.0.0.1:6790,mon1=10.0.0.1:6790,mon2=10.0.0.1:6790",
+	}, saved)
+}
+
+func TestRefreshMonEndpoints(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		testMonPod("mon0", "ns", "1.2.3.4", v1.PodRunning),
+		testMonPod("mon1", "ns", "1.2.3.5", v1.PodRunning))
+	c := New("ns", nil, "myversion")
+	info := testClusterInfo()
+	info.Monitors["mon0"] = mon.ToCephMon("mon0", "1.2.3.4")
+	info.Monitors["mon1"] = mon.ToCephMon("mon1", "1.2.3.5")
+	assert.Nil(t, c.saveEndpoints(clientset, "ns", info))
+
+	// mon1 was rescheduled to another node
+	pod, err := clientset.Core().Pods("ns").Get("mon1")
+	assert.Nil(t, err)
+	pod.Status.PodIP = "1.2.3.9"
+	_, err = clientset.Core().Pods("ns").Update(pod)
+	assert.Nil(t, err)
+
+	err = c.RefreshMonEndpoints(clientset, info)
+	assert.Nil(t, err)
+	assert.Equal(t, "1.2.3.9:6790", info.Monitors["mon1"].Endpoint)
+	configMap, err := clientset.Core().ConfigMaps("ns").Get(EndpointConfigMapName)
+	assert.Nil(t, err)
+	assert.Equal(t, "mon0=1.2.3.4:6790,mon1=1.2.3.9:6790", configMap.Data[EndpointDataKey])
+
+	// the mon without a pod is removed from the endpoints
+	assert.Nil(t, clientset.Core().Pods("ns").Delete("mon1", &api.DeleteOptions{}))
+	err = c.RefreshMonEndpoints(clientset, info)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(info.Monitors))
+	configMap, err = clientset.Core().ConfigMaps("ns").Get(EndpointConfigMapName)
+	assert.Nil(t, err)
+	assert.Equal(t, "mon0=1.2.3.4:6790", configMap.Data[EndpointDataKey])
+
+	// a cluster info without mons is filled in
+	info = &mon.ClusterInfo{Name: "rookcluster", FSID: testClusterInfo().FSID}
+	err = c.RefreshMonEndpoints(clientset, info)
+	assert.Nil(t, err)
+	assert.Equal(t, "1.2.3.4:6790", info.Monitors["mon0"].Endpoint)
+
+	// the endpoints are not cleared when no mon is running
+	assert.Nil(t, clientset.Core().Pods("ns").Delete("mon0", &api.DeleteOptions{}))
+	assert.NotNil(t, c.RefreshMonEndpoints(clientset, info))
+	configMap, err = clientset.Core().ConfigMaps("ns").Get(EndpointConfigMapName)
+	assert.Nil(t, err)
+	assert.Equal(t, "mon0=1.2.3.4:6790", configMap.Data[EndpointDataKey])
+}
+
+func TestMonEndpointString(t *testing.T) {
+	tests := []struct {
+		name     string
+		mons     map[string]string
+		expected string
+	}{
+		{"none", map[string]string{}, ""},
+		{"ipv4", map[string]string{"mon1": "1.2.3.5", "mon0": "1.2.3.4"}, "mon0=1.2.3.4:6790,mon1=1.2.3.5:6790"},
+		{"ipv6", map[string]string{"mon0": "fe80::1", "mon1": "2001:db8::2"}, "mon0=[fe80::1]:6790,mon1=[2001:db8::2]:6790"},
+		{"mixed", map[string]string{"mon0": "1.2.3.4", "mon1": "::1"}, "mon0=1.2.3.4:6790,mon1=[::1]:6790"},
+		{"hostname", map[string]string{"mon0": "mon0.rook-mon.ns.svc"}, "mon0=mon0.rook-mon.ns.svc:6790"},
+	}
+	for _, test := range tests {
+		info := testClusterInfo()
+		for name, ip := range test.mons {
+			info.Monitors[name] = mon.ToCephMon(name, ip)
+		}
+		assert.Equal(t, test.expected, MonEndpointString(info), test.name)
+	}
+
+	// an endpoint that is already bracketed is unchanged
+	info := testClusterInfo()
+	info.Monitors["mon0"] = &mon.CephMonitorConfig{Name: "mon0", Endpoint: "[fe80::1]:6790"}
+	assert.Equal(t, "mon0=[fe80::1]:6790", MonEndpointString(info))
+}
+
+func TestMonEndpointStringV2(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		testMonPod("mon0", "ns", "1.2.3.4", v1.PodRunning),
+		testMonPod("mon1", "ns", "fe80::1", v1.PodRunning))
+	c := New("ns", nil, "myversion")
+	c.V2Port = 3300
+	c.Size = 2
+	c.PodStartDelay = time.Millisecond
+	mons := []*MonConfig{{Name: "mon0", Port: 6790, V2Port: 3300}, {Name: "mon1", Port: 6790, V2Port: 3300}}
+
+	info := testClusterInfo()
+	_, err := c.startPods(clientset, info, mons)
+	assert.Nil(t, err)
+	assert.Equal(t, "mon0=[v2:1.2.3.4:3300,v1:1.2.3.4:6790],mon1=[v2:[fe80::1]:3300,v1:[fe80::1]:6790]", MonEndpointString(info))
+
+	// the endpoints are parsed back from the config map
+	parsed := mon.ParseMonEndpoints(MonEndpointString(info))
+	assert.Equal(t, &mon.CephMonitorConfig{Name: "mon0", Endpoint: "1.2.3.4:6790", EndpointV2: "1.2.3.4:3300"}, parsed["mon0"])
+	assert.Equal(t, &mon.CephMonitorConfig{Name: "mon1", Endpoint: "[fe80::1]:6790", EndpointV2: "[fe80::1]:3300"}, parsed["mon1"])
+}
+
+func TestThrottleEndpointChanges(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	c := New("ns", nil, "myversion")
+	c.EndpointChangeInterval = time.Minute
+	saved := func() string {
+		configMap, err := clientset.Core().ConfigMaps("ns").Get(EndpointConfigMapName)
+		assert.Nil(t, err)
+		return configMap.Data[EndpointDataKey]
+	}
+
+	info := testClusterInfo()
+	info.Monitors["mon0"] = mon.ToCephMon("mon0", "1.2.3.4")
+	info.Monitors["mon1"] = mon.ToCephMon("mon1", "1.2.3.5")
+	err := c.saveEndpoints(clientset, "ns", info)
+	assert.Nil(t, err)
+
+	// the first change of a mon is saved
+	info.Monitors["mon1"] = mon.ToCephMon("mon1", "1.2.3.6")
+	err = c.saveEndpoints(clientset, "ns", info)
+	assert.Nil(t, err)
+	assert.Equal(t, "mon0=1.2.3.4:6790,mon1=1.2.3.6:6790", saved())
+
+	// the rapid changes are coalesced. other mons still change and new mons are added.
+	for _, ip := range []string{"1.2.3.7", "1.2.3.8", "1.2.3.9"} {
+		info.Monitors["mon1"] = mon.ToCephMon("mon1", ip)
+		err = c.saveEndpoints(clientset, "ns", info)
+		assert.Nil(t, err)
+	}
+	info.Monitors["mon0"] = mon.ToCephMon("mon0", "1.2.4.4")
+	info.Monitors["mon2"] = mon.ToCephMon("mon2", "1.2.4.6")
+	err = c.saveEndpoints(clientset, "ns", info)
+	assert.Nil(t, err)
+	assert.Equal(t, "mon0=1.2.4.4:6790,mon1=1.2.3.6:6790,mon2=1.2.4.6:6790", saved())
+
+	// the latest endpoint is saved after the interval
+	c.endpointChanged["mon1"] = time.Now().Add(-2 * time.Minute)
+	err = c.saveEndpoints(clientset, "ns", info)
+	assert.Nil(t, err)
+	assert.Equal(t, "mon0=1.2.4.4:6790,mon1=1.2.3.9:6790,mon2=1.2.4.6:6790", saved())
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/rook/rook/pkg/cephmgr/client"
+	"github.com/rook/rook/pkg/cephmgr/mon"
+	"k8s.io/client-go/1.5/kubernetes"
+	"k8s.io/client-go/1.5/pkg/labels"
+)
+
+// FailoverPlan is what the failover of a mon would do. The failed mon is removed and a new mon with an empty store
+// is started in its place.
+type FailoverPlan struct {
+	Mon string
+	// Replacement is the name of the new mon. It is empty when the mon is beyond the size of the cluster and is not
+	// replaced.
+	Replacement string
+	// TargetNode is the first of the CandidateNodes. The scheduler picks the node of the new mon from the candidates.
+	TargetNode     string
+	CandidateNodes []string
+	// RemoveFromMonMap is whether the mon is removed from the monmap before the new mon joins it
+	RemoveFromMonMap bool
+	MonMapBefore     []string
+	MonMapAfter      []string
+	// DataVolumeClaim is the claim of the mon data that is deleted with the mon. Empty without a claim.
+	DataVolumeClaim string
+}
+
+// SimulateFailover computes what the failover of the mon would do without changing the cluster or the cluster info.
+// The failover would fail with the same error, for example ErrQuorumAtRisk when the other mons would lose quorum.
+func (c *Cluster) SimulateFailover(clientset kubernetes.Interface, clusterInfo *mon.ClusterInfo, monName string) (*FailoverPlan, error) {
+	if _, ok := clusterInfo.Monitors[monName]; !ok {
+		return nil, fmt.Errorf("mon %s not found", monName)
+	}
+
+	conn, err := c.connect(clusterInfo)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Shutdown()
+
+	status, err := client.GetMonStatus(conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mon status. %+v", err)
+	}
+	inMonMap, err := checkRemovalQuorum(status, monName)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &FailoverPlan{Mon: monName, RemoveFromMonMap: inMonMap, MonMapBefore: []string{}, MonMapAfter: []string{}}
+	// the mons are started again up to the size of the cluster, so the new mon takes the name of the failed mon
+	for i := 0; i < c.size(); i++ {
+		if fmt.Sprintf("mon%d", i) == monName {
+			plan.Replacement = monName
+		}
+	}
+	for _, m := range status.MonMap.Mons {
+		plan.MonMapBefore = append(plan.MonMapBefore, m.Name)
+		if m.Name != monName {
+			plan.MonMapAfter = append(plan.MonMapAfter, m.Name)
+		}
+	}
+	if plan.Replacement != "" {
+		plan.MonMapAfter = append(plan.MonMapAfter, plan.Replacement)
+	}
+	sort.Strings(plan.MonMapBefore)
+	sort.Strings(plan.MonMapAfter)
+	if c.usePVC() {
+		plan.DataVolumeClaim = dataVolumeClaimName(monName)
+	}
+
+	if plan.Replacement != "" {
+		plan.CandidateNodes, err = c.failoverCandidateNodes(clientset, clusterInfo, monName)
+		if err != nil {
+			return nil, err
+		}
+		if len(plan.CandidateNodes) > 0 {
+			plan.TargetNode = plan.CandidateNodes[0]
+		}
+	}
+	return plan, nil
+}
+
+// the available nodes that match the node selector of the mons, sorted by name. with anti-affinity the nodes and
+// failure domains of the other mons are excluded.
+func (c *Cluster) failoverCandidateNodes(clientset kubernetes.Interface, clusterInfo *mon.ClusterInfo, monName string) ([]string, error) {
+	nodes, err := listAvailableNodes(clientset)
+	if err != nil {
+		return nil, err
+	}
+	antiAffinity, err := c.getAntiAffinity(clientset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get antiaffinity. %+v", err)
+	}
+
+	occupied := map[string]bool{}
+	if antiAffinity {
+		running, pending, err := c.pollPods(clientset, c.Namespace, clusterInfo.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get mon pods. %+v", err)
+		}
+		for _, p := range append(running, pending...) {
+			if p.Name != monName && p.Spec.NodeName != "" {
+				occupied[p.Spec.NodeName] = true
+			}
+		}
+	}
+	domains := map[string]bool{}
+	if c.FailureDomainLabel != "" {
+		for _, n := range nodes {
+			if occupied[n.Name] {
+				domains[n.Labels[c.FailureDomainLabel]] = true
+			}
+		}
+	}
+
+	selector := labels.SelectorFromSet(c.NodeSelector)
+	candidates := []string{}
+	for _, n := range nodes {
+		if !selector.Matches(labels.Set(n.Labels)) || occupied[n.Name] {
+			continue
+		}
+		if antiAffinity && c.FailureDomainLabel != "" {
+			// the anti-affinity only places the mon on the nodes with the label
+			if domain := n.Labels[c.FailureDomainLabel]; domain == "" || domains[domain] {
+				continue
+			}
+		}
+		candidates = append(candidates, n.Name)
+	}
+	sort.Strings(candidates)
+	return candidates, nil
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/rook/rook/pkg/cephmgr/client/test"
+	"github.com/rook/rook/pkg/cephmgr/mon"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/1.5/kubernetes/fake"
+	"k8s.io/client-go/1.5/pkg/api/resource"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+)
+
+func TestSimulateFailover(t *testing.T) {
+	pods := []*v1.Pod{}
+	for i, name := range []string{"mon0", "mon1", "mon2"} {
+		pod := testMonPod(name, "ns", "1.2.3.4", v1.PodRunning)
+		pod.Spec.NodeName = []string{"node0", "node1", "node2"}[i]
+		pods = append(pods, pod)
+	}
+	clientset := fake.NewSimpleClientset(pods[0], pods[1], pods[2],
+		testNode("node0", v1.ConditionTrue, false),
+		testNode("node1", v1.ConditionTrue, false),
+		testNode("node2", v1.ConditionTrue, false),
+		testNode("node3", v1.ConditionTrue, false),
+		testNode("node4", v1.ConditionFalse, false))
+
+	status := allInQuorumResponse
+	commands := []string{}
+	conn := &test.MockConnection{
+		MockMonCommand: func(args []byte) ([]byte, string, error) {
+			var cmd map[string]interface{}
+			assert.Nil(t, json.Unmarshal(args, &cmd))
+			commands = append(commands, cmd["prefix"].(string))
+			return []byte(status), "", nil
+		},
+	}
+	c := New("ns", &test.MockConnectionFactory{Conn: conn, Fsid: testClusterInfo().FSID, SecretKey: "mysecret"}, "myversion")
+	c.configDir = "/tmp"
+	info := testClusterInfo()
+	for _, name := range []string{"mon0", "mon1", "mon2"} {
+		info.Monitors[name] = mon.ToCephMon(name, "1.2.3.4")
+	}
+
+	plan, err := c.SimulateFailover(clientset, info, "mon1")
+	assert.Nil(t, err)
+	assert.Equal(t, "mon1", plan.Mon)
+	assert.Equal(t, "mon1", plan.Replacement)
+	assert.True(t, plan.RemoveFromMonMap)
+	assert.Equal(t, []string{"mon0", "mon1", "mon2"}, plan.MonMapBefore)
+	assert.Equal(t, []string{"mon0", "mon1", "mon2"}, plan.MonMapAfter)
+	assert.Equal(t, "", plan.DataVolumeClaim)
+
+	// the nodes of the other mons are excluded by the anti-affinity
+	assert.Equal(t, []string{"node1", "node3"}, plan.CandidateNodes)
+	assert.Equal(t, "node1", plan.TargetNode)
+
+	// nothing was changed
+	assert.Equal(t, []string{"mon_status"}, commands)
+	for _, action := range clientset.Actions() {
+		assert.True(t, action.GetVerb() == "get" || action.GetVerb() == "list", action.GetVerb())
+	}
+	assert.Equal(t, 3, len(info.Monitors))
+
+	// a mon beyond the size of the cluster is not replaced
+	c.Size = 2
+	c.DataVolumeSize = resource.MustParse("1Gi")
+	plan, err = c.SimulateFailover(clientset, info, "mon2")
+	assert.Nil(t, err)
+	assert.Equal(t, "", plan.Replacement)
+	assert.Equal(t, []string{"mon0", "mon1"}, plan.MonMapAfter)
+	assert.Equal(t, 0, len(plan.CandidateNodes))
+	assert.Equal(t, "mon2-data", plan.DataVolumeClaim)
+
+	// the failover would be refused when the other mons lose quorum
+	status = `{"quorum":[0,1],"monmap":{"mons":[{"name":"mon0","rank":0},{"name":"mon1","rank":1},{"name":"mon2","rank":2}]}}`
+	_, err = c.SimulateFailover(clientset, info, "mon1")
+	assert.Equal(t, ErrQuorumAtRisk, err)
+
+	_, err = c.SimulateFailover(clientset, info, "mon9")
+	assert.NotNil(t, err)
+}
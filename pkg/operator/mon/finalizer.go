@@ -0,0 +1,153 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/client-go/1.5/kubernetes"
+	"k8s.io/client-go/1.5/pkg/api"
+	"k8s.io/client-go/1.5/pkg/labels"
+)
+
+// the finalizer keeps the mon resource until the mon pods and their data are removed
+const monFinalizer = "mon.rook.io"
+
+// Delete removes the mon pods, the claims of their data and the resources rook created for the mons. The finalizer
+// of the mon resource is removed last so the resource is not deleted while the mons still exist.
+func (c *Cluster) Delete(clientset kubernetes.Interface) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+
+	// the cluster name is in the secret. the secret is removed with the other mon resources, but a backup is kept.
+	clusterName := ""
+	secret, err := clientset.Core().Secrets(c.Namespace).Get(c.SecretName)
+	if err != nil && !k8sutil.IsKubernetesResourceNotFoundError(err) {
+		return fmt.Errorf("failed to get mon secrets. %+v", err)
+	}
+	if err == nil {
+		info := c.clusterInfoFromSecret(secret)
+		clusterName = info.Name
+		if _, err := c.BackupClusterInfo(clientset, info); err != nil {
+			return err
+		}
+	}
+
+	// the mons of the namespace are listed without the cluster name in case the secret was lost
+	options := api.ListOptions{LabelSelector: labels.SelectorFromSet(map[string]string{k8sutil.AppAttr: appName})}
+	pods, err := clientset.Core().Pods(c.Namespace).List(options)
+	if err != nil {
+		return fmt.Errorf("failed to list mon pods. %+v", err)
+	}
+	for _, pod := range pods.Items {
+		logger.Infof("deleting mon %s", pod.Name)
+		if err := ignoreNotFound(clientset.Core().Pods(c.Namespace).Delete(pod.Name, &api.DeleteOptions{})); err != nil {
+			return fmt.Errorf("failed to delete mon pod %s. %+v", pod.Name, err)
+		}
+	}
+	for _, pod := range pods.Items {
+		if err := c.waitForPodToDelete(clientset, pod.Name); err != nil {
+			return err
+		}
+		if c.usePVC() {
+			if err := ignoreNotFound(clientset.Core().PersistentVolumeClaims(c.Namespace).Delete(dataVolumeClaimName(pod.Name), &api.DeleteOptions{})); err != nil {
+				return fmt.Errorf("failed to delete the data of mon %s. %+v", pod.Name, err)
+			}
+		}
+	}
+
+	if err := c.removeMonResources(clientset, c.Namespace, clusterName); err != nil {
+		return err
+	}
+	c.cache.invalidate(c.Namespace)
+
+	return c.removeFinalizer(clientset)
+}
+
+// add the finalizer to the mon resource. there is nothing to protect if the mons were started without a resource.
+func (c *Cluster) addFinalizer(clientset kubernetes.Interface) error {
+	return c.updateFinalizers(clientset, func(finalizers []string) []string {
+		if containsString(finalizers, monFinalizer) {
+			return nil
+		}
+		return append(finalizers, monFinalizer)
+	})
+}
+
+func (c *Cluster) removeFinalizer(clientset kubernetes.Interface) error {
+	return c.updateFinalizers(clientset, func(finalizers []string) []string {
+		if !containsString(finalizers, monFinalizer) {
+			return nil
+		}
+		remaining := []string{}
+		for _, f := range finalizers {
+			if f != monFinalizer {
+				remaining = append(remaining, f)
+			}
+		}
+		return remaining
+	})
+}
+
+// update the finalizers of the mon resource. the resource is read and written as raw json so the fields rook does
+// not know about are kept. the resource is not written if update returns nil.
+func (c *Cluster) updateFinalizers(clientset kubernetes.Interface, update func([]string) []string) error {
+	name := c.resourceName()
+	path := resourcePath(c.Namespace, name)
+	body, err := c.getResource(clientset, path)
+	if err != nil {
+		if k8sutil.IsKubernetesResourceNotFoundError(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to get mon resource %s. %+v", name, err)
+	}
+
+	var resource map[string]interface{}
+	if err := json.Unmarshal(body, &resource); err != nil {
+		return fmt.Errorf("failed to unmarshal mon resource %s. %+v", name, err)
+	}
+	metadata, ok := resource["metadata"].(map[string]interface{})
+	if !ok {
+		metadata = map[string]interface{}{}
+		resource["metadata"] = metadata
+	}
+	finalizers := []string{}
+	if items, ok := metadata["finalizers"].([]interface{}); ok {
+		for _, item := range items {
+			if f, ok := item.(string); ok {
+				finalizers = append(finalizers, f)
+			}
+		}
+	}
+
+	updated := update(finalizers)
+	if updated == nil {
+		return nil
+	}
+	metadata["finalizers"] = updated
+	if body, err = json.Marshal(resource); err != nil {
+		return fmt.Errorf("failed to marshal mon resource %s. %+v", name, err)
+	}
+	if err := c.putResource(clientset, path, body); err != nil {
+		return fmt.Errorf("failed to update the finalizers of mon resource %s. %+v", name, err)
+	}
+	logger.Infof("updated the finalizers of mon resource %s to %v", name, updated)
+	return nil
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/1.5/kubernetes"
+	"k8s.io/client-go/1.5/kubernetes/fake"
+	"k8s.io/client-go/1.5/pkg/api/errors"
+	"k8s.io/client-go/1.5/pkg/api/unversioned"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+	"k8s.io/client-go/1.5/pkg/runtime"
+	core "k8s.io/client-go/1.5/testing"
+)
+
+// the fake clientset does not serve the mon resource
+func noMonResource(clientset kubernetes.Interface, path string) ([]byte, error) {
+	return nil, errors.NewNotFound(unversioned.GroupResource{Group: resourceGroup, Resource: resourcePlural}, appName)
+}
+
+type monResourceObject struct {
+	Metadata struct {
+		Name       string   `json:"name"`
+		Finalizers []string `json:"finalizers"`
+	} `json:"metadata"`
+	Spec map[string]interface{} `json:"spec"`
+}
+
+func TestFinalizer(t *testing.T) {
+	c, _ := newTestHealthCluster(map[string]string{"mon_status": allInQuorumResponse})
+	c.Size = 1
+	c.PodStartDelay = time.Millisecond
+
+	// the mon resource is kept in memory as the api server would
+	stored := []byte(`{"apiVersion":"rook.io/v1","kind":"Mon","metadata":{"name":"mon","finalizers":["other"]},"spec":{"size":1}}`)
+	puts := 0
+	c.getResource = func(clientset kubernetes.Interface, path string) ([]byte, error) {
+		assert.Equal(t, "/apis/rook.io/v1/namespaces/ns/mons/mon", path)
+		return stored, nil
+	}
+	c.putResource = func(clientset kubernetes.Interface, path string, body []byte) error {
+		puts++
+		stored = body
+		return nil
+	}
+	finalizers := func() []string {
+		var resource monResourceObject
+		assert.Nil(t, json.Unmarshal(stored, &resource))
+		assert.Equal(t, 1, len(resource.Spec))
+		return resource.Metadata.Finalizers
+	}
+
+	clientset := fake.NewSimpleClientset(testMonSecret("ns"), testMonPod("mon0", "ns", "1.2.3.4", v1.PodRunning))
+	_, err := c.Start(clientset)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"other", monFinalizer}, finalizers())
+
+	// the finalizer is only added once
+	_, err = c.Start(clientset)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, puts)
+
+	// the finalizer is removed after the mons are gone
+	err = c.Delete(clientset)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"other"}, finalizers())
+	pods, err := clientset.Core().Pods("ns").List(listOptions("rookcluster"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(pods.Items))
+	_, err = clientset.Core().Secrets("ns").Get(appName)
+	assert.True(t, errors.IsNotFound(err))
+	_, err = clientset.Core().ConfigMaps("ns").Get(EndpointConfigMapName)
+	assert.True(t, errors.IsNotFound(err))
+}
+
+func TestDeleteKeepsFinalizerOnFailure(t *testing.T) {
+	c := New("ns", nil, "myversion")
+	c.PodStartRetries = 1
+	c.PodStartDelay = time.Millisecond
+	c.getResource = func(clientset kubernetes.Interface, path string) ([]byte, error) {
+		return []byte(`{"metadata":{"finalizers":["mon.rook.io"]}}`), nil
+	}
+	puts := 0
+	c.putResource = func(clientset kubernetes.Interface, path string, body []byte) error {
+		puts++
+		return nil
+	}
+
+	// the pod is never deleted
+	clientset := fake.NewSimpleClientset(testMonSecret("ns"), testMonPod("mon0", "ns", "1.2.3.4", v1.PodRunning))
+	clientset.PrependReactor("delete", "pods", func(action core.Action) (bool, runtime.Object, error) {
+		return true, nil, nil
+	})
+	err := c.Delete(clientset)
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, puts)
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/client-go/1.5/kubernetes"
+	"k8s.io/client-go/1.5/pkg/api"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+	"k8s.io/client-go/1.5/pkg/labels"
+)
+
+// MonInfo is a mon pod of any of the rook clusters
+type MonInfo struct {
+	Namespace string
+	Name      string
+	// Cluster is the name of the ceph cluster of the mon
+	Cluster string
+	Phase   v1.PodPhase
+	// IP is the pod ip. The mons of a public network can be listening on another ip of their node.
+	IP string
+}
+
+// ListAllMons returns the mon pods of the rook clusters in all namespaces, sorted by namespace and name
+func ListAllMons(clientset kubernetes.Interface) ([]MonInfo, error) {
+	opts := api.ListOptions{LabelSelector: labels.SelectorFromSet(map[string]string{k8sutil.AppAttr: appName})}
+	pods, err := clientset.Core().Pods(api.NamespaceAll).List(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the mon pods in all namespaces. %+v", err)
+	}
+
+	mons := []MonInfo{}
+	for _, pod := range pods.Items {
+		mons = append(mons, MonInfo{
+			Namespace: pod.Namespace,
+			Name:      pod.Name,
+			Cluster:   pod.Labels[monClusterAttr],
+			Phase:     pod.Status.Phase,
+			IP:        pod.Status.PodIP,
+		})
+	}
+	sort.Sort(byNamespaceAndName(mons))
+	return mons, nil
+}
+
+type byNamespaceAndName []MonInfo
+
+func (m byNamespaceAndName) Len() int      { return len(m) }
+func (m byNamespaceAndName) Swap(i, j int) { m[i], m[j] = m[j], m[i] }
+func (m byNamespaceAndName) Less(i, j int) bool {
+	if m[i].Namespace != m[j].Namespace {
+		return m[i].Namespace < m[j].Namespace
+	}
+	return m[i].Name < m[j].Name
+}
@@ -0,0 +1,46 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/1.5/kubernetes/fake"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+)
+
+func TestListAllMons(t *testing.T) {
+	other := &v1.Pod{ObjectMeta: v1.ObjectMeta{Name: "osd0", Namespace: "team-a", Labels: map[string]string{"app": "osd"}}}
+	clientset := fake.NewSimpleClientset(
+		testMonPod("mon1", "team-b", "1.2.4.5", v1.PodRunning),
+		testMonPod("mon0", "team-b", "1.2.4.4", v1.PodPending),
+		testMonPod("mon0", "team-a", "1.2.3.4", v1.PodRunning),
+		other)
+
+	mons, err := ListAllMons(clientset)
+	assert.Nil(t, err)
+	assert.Equal(t, []MonInfo{
+		{Namespace: "team-a", Name: "mon0", Cluster: "rookcluster", Phase: v1.PodRunning, IP: "1.2.3.4"},
+		{Namespace: "team-b", Name: "mon0", Cluster: "rookcluster", Phase: v1.PodPending, IP: "1.2.4.4"},
+		{Namespace: "team-b", Name: "mon1", Cluster: "rookcluster", Phase: v1.PodRunning, IP: "1.2.4.5"},
+	}, mons)
+
+	// no mons in the cluster
+	mons, err = ListAllMons(fake.NewSimpleClientset(other))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(mons))
+}
@@ -0,0 +1,358 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rook/rook/pkg/cephmgr/client"
+	"github.com/rook/rook/pkg/cephmgr/mon"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/client-go/1.5/kubernetes"
+	"k8s.io/client-go/1.5/pkg/api"
+)
+
+const (
+	// the default skew in seconds allowed by ceph (mon_clock_drift_allowed) before a mon reports MON_CLOCK_SKEW
+	maxClockSkew = 0.05
+)
+
+// open an admin connection to the running mons
+func (c *Cluster) connect(clusterInfo *mon.ClusterInfo) (client.Connection, error) {
+	if c.factory == nil {
+		return nil, errNilFactory
+	}
+	context := &clusterd.Context{ConfigDir: c.configDir}
+	conn, err := mon.ConnectToClusterAsAdmin(context, c.factory, clusterInfo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to cluster. %+v", err)
+	}
+	return conn, nil
+}
+
+// VerifySecrets checks that the mons accept the admin key stored in the mon secret. The mons reject the key
+// when the secret was changed after the cluster was created.
+func (c *Cluster) VerifySecrets(clusterInfo *mon.ClusterInfo) error {
+	conn, err := c.connect(clusterInfo)
+	if err != nil {
+		if isAuthError(err) {
+			return c.secretDriftError(err)
+		}
+		return err
+	}
+	conn.Shutdown()
+	return nil
+}
+
+// ceph fails the connection with EPERM or EACCES when the key does not match
+func isAuthError(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "Operation not permitted") || strings.Contains(msg, "Permission denied")
+}
+
+func (c *Cluster) secretDriftError(err error) error {
+	return fmt.Errorf("the mons rejected the admin key in secret %s. the secret may have been changed after the cluster was created. %+v", c.SecretName, err)
+}
+
+// QuorumMajority returns the number of mons that must be in quorum for a cluster of the given size
+func QuorumMajority(size int) int {
+	return size/2 + 1
+}
+
+// check whether all the mons in the cluster info are in quorum
+func (c *Cluster) inQuorum(clusterInfo *mon.ClusterInfo) (bool, error) {
+	conn, err := c.connect(clusterInfo)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Shutdown()
+
+	status, err := client.GetMonStatus(conn)
+	if err != nil {
+		return false, fmt.Errorf("failed to get mon status. %+v", err)
+	}
+
+	for name := range clusterInfo.Monitors {
+		if !monInQuorum(status, name) {
+			logger.Infof("mon %s is not in quorum", name)
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// QuorumStatus returns the number of mons required for quorum and the number of mons in quorum. The majority
+// is relative to the mons in the monmap, which may differ from the desired size during a rollout.
+func (c *Cluster) QuorumStatus(clusterInfo *mon.ClusterInfo) (int, int, error) {
+	required := QuorumMajority(c.size())
+	conn, err := c.connect(clusterInfo)
+	if err != nil {
+		return required, 0, err
+	}
+	defer conn.Shutdown()
+
+	status, err := client.GetMonStatus(conn)
+	if err != nil {
+		return required, 0, fmt.Errorf("failed to get mon status. %+v", err)
+	}
+
+	if len(status.MonMap.Mons) > 0 {
+		required = QuorumMajority(len(status.MonMap.Mons))
+	}
+	return required, len(status.Quorum), nil
+}
+
+// HasQuorum returns whether the mons have quorum, the number of mons in quorum, and the number of mons
+// required for quorum. A rolling operation can take another mon down only while the mons in quorum
+// exceed the required number. Quorum is reported as lost when the status cannot be retrieved.
+func (c *Cluster) HasQuorum(clusterInfo *mon.ClusterInfo) (bool, int, int) {
+	required, current, err := c.QuorumStatus(clusterInfo)
+	if err != nil {
+		logger.Warningf("failed to check mon quorum. %+v", err)
+		return false, 0, required
+	}
+	return current >= required, current, required
+}
+
+// WaitForQuorum waits for all the mons in the cluster info to be in quorum
+func (c *Cluster) WaitForQuorum(clusterInfo *mon.ClusterInfo) error {
+	for i := 0; i < c.PodStartRetries; i++ {
+		if c.deadlineExceeded() {
+			return ErrReconcileDeadlineExceeded
+		}
+		inQuorum, err := c.inQuorum(clusterInfo)
+		if err != nil {
+			logger.Warningf("failed to check mon quorum. %+v", err)
+		} else if inQuorum {
+			return nil
+		}
+
+		logger.Infof("waiting %v for the mons to form quorum", c.PodStartDelay)
+		<-time.After(c.PodStartDelay)
+	}
+
+	return fmt.Errorf("timed out waiting for the mons to form quorum")
+}
+
+// check whether the mon is in the mon map and its rank is in the quorum list
+func monInQuorum(status client.MonStatusResponse, name string) bool {
+	for _, m := range status.MonMap.Mons {
+		if m.Name != name {
+			continue
+		}
+		for _, rank := range status.Quorum {
+			if rank == m.Rank {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// CheckClockSkew returns the clock skew in seconds of each mon relative to the leader.
+// A warning is logged for each mon whose skew exceeds what ceph allows.
+func (c *Cluster) CheckClockSkew(clusterInfo *mon.ClusterInfo) (map[string]float64, error) {
+	conn, err := c.connect(clusterInfo)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Shutdown()
+
+	status, err := client.Status(conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ceph status. %+v", err)
+	}
+
+	skews := map[string]float64{}
+	for _, m := range status.Health.Timechecks.Mons {
+		skews[m.Name] = m.Skew
+		if math.Abs(m.Skew) > maxClockSkew {
+			logger.Warningf("mon %s has a clock skew of %.3fs (max allowed %.3fs). check ntp on its node.", m.Name, m.Skew, maxClockSkew)
+		}
+	}
+
+	return skews, nil
+}
+
+// Restart the mons that have been out of quorum for longer than the probe timeout. A mon that cannot reach
+// its peers stays in the probing state without crashing, so it would never join quorum on its own. Only the
+// mon itself reports its state, so a mon that is in the monmap but not in quorum is considered to be probing.
+// The deleted mon pods are started again by the next reconcile. The names of the restarted mons are returned.
+func (c *Cluster) restartStuckMons(clientset kubernetes.Interface, clusterInfo *mon.ClusterInfo) ([]string, error) {
+	conn, err := c.connect(clusterInfo)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Shutdown()
+
+	status, err := client.GetMonStatus(conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mon status. %+v", err)
+	}
+
+	c.probingLock.Lock()
+	defer c.probingLock.Unlock()
+	if c.probingSince == nil {
+		c.probingSince = map[string]time.Time{}
+	}
+
+	restarted := []string{}
+	for name := range clusterInfo.Monitors {
+		if monInQuorum(status, name) {
+			delete(c.probingSince, name)
+			continue
+		}
+
+		since, ok := c.probingSince[name]
+		if !ok {
+			c.probingSince[name] = time.Now()
+			continue
+		}
+		if time.Since(since) < c.ProbeTimeout {
+			continue
+		}
+
+		logger.Warningf("mon %s has not joined quorum for %v. restarting it", name, time.Since(since))
+		err := clientset.Core().Pods(c.Namespace).Delete(name, &api.DeleteOptions{})
+		if err != nil && !k8sutil.IsKubernetesResourceNotFoundError(err) {
+			return restarted, fmt.Errorf("failed to delete stuck mon pod %s. %+v", name, err)
+		}
+		delete(c.probingSince, name)
+		restarted = append(restarted, name)
+	}
+	sort.Strings(restarted)
+	return restarted, nil
+}
+
+// GetMonStoreSizes returns the size in bytes of the store of each mon as reported in the ceph health. The stores
+// can grow quickly, for example when compaction fails during a long recovery, and eventually fill the mon volumes.
+func (c *Cluster) GetMonStoreSizes(clusterInfo *mon.ClusterInfo) (map[string]int64, error) {
+	conn, err := c.connect(clusterInfo)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Shutdown()
+
+	status, err := client.Status(conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ceph status. %+v", err)
+	}
+
+	sizes := map[string]int64{}
+	for _, service := range status.Health.Details.Services {
+		for _, m := range service["mons"] {
+			sizes[m.Name] = int64(m.StoreStats.BytesTotal)
+		}
+	}
+	return sizes, nil
+}
+
+// CephHealth is the overall health of the ceph cluster
+type CephHealth struct {
+	// Status is HEALTH_OK, HEALTH_WARN, or HEALTH_ERR
+	Status string
+	// Checks are the problems that make the cluster unhealthy, sorted by name. The ceph of this release reports the
+	// problems without a name, so only their severity and summary are set and the detail is in Detail.
+	Checks []CephHealthCheck
+	// Detail are the detail lines of the health, for example the addresses of the down mons. The newer ceph
+	// releases report the detail in the checks instead.
+	Detail []string
+}
+
+// CephHealthCheck is a problem reported in the ceph health, for example MON_DOWN with the names of the down mons
+// in the detail
+type CephHealthCheck struct {
+	Name     string
+	Severity string
+	Summary  string
+	Detail   []string
+}
+
+// the health checks of the health detail command of luminous and newer. the mons of this release report the
+// overall_status, summary, and detail of client.HealthStatus instead.
+type healthChecks struct {
+	Status string `json:"status"`
+	Checks map[string]struct {
+		Severity string `json:"severity"`
+		Summary  struct {
+			Message string `json:"message"`
+		} `json:"summary"`
+		Detail []struct {
+			Message string `json:"message"`
+		} `json:"detail"`
+	} `json:"checks"`
+}
+
+// GetCephHealth returns the health of the ceph cluster with the detail of each health check
+func (c *Cluster) GetCephHealth(clusterInfo *mon.ClusterInfo) (*CephHealth, error) {
+	conn, err := c.connect(clusterInfo)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Shutdown()
+
+	cmd := map[string]interface{}{"prefix": "health", "detail": "detail"}
+	buf, err := client.ExecuteMonCommand(conn, cmd, "health detail")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ceph health. %+v", err)
+	}
+
+	var checks healthChecks
+	if err := json.Unmarshal(buf, &checks); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal ceph health. %+v. raw response: %s", err, string(buf))
+	}
+	health := &CephHealth{Status: checks.Status, Checks: []CephHealthCheck{}, Detail: []string{}}
+	if health.Status != "" {
+		// a newer image reports named health checks. its overall_status is only kept for compatibility.
+		for name, check := range checks.Checks {
+			messages := []string{}
+			for _, d := range check.Detail {
+				messages = append(messages, d.Message)
+			}
+			health.Checks = append(health.Checks, CephHealthCheck{Name: name, Severity: check.Severity, Summary: check.Summary.Message, Detail: messages})
+		}
+	} else {
+		var status client.HealthStatus
+		if err := json.Unmarshal(buf, &status); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal ceph health. %+v. raw response: %s", err, string(buf))
+		}
+		health.Status = status.OverallStatus
+		for _, s := range status.Summary {
+			health.Checks = append(health.Checks, CephHealthCheck{Severity: s.Severity, Summary: s.Summary})
+		}
+		for _, d := range status.Detail {
+			health.Detail = append(health.Detail, fmt.Sprintf("%v", d))
+		}
+	}
+	if health.Status == "" {
+		return nil, fmt.Errorf("ceph health has no status. raw response: %s", string(buf))
+	}
+	sort.Stable(byCheckName(health.Checks))
+	return health, nil
+}
+
+type byCheckName []CephHealthCheck
+
+func (h byCheckName) Len() int           { return len(h) }
+func (h byCheckName) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h byCheckName) Less(i, j int) bool { return h[i].Name < h[j].Name }
@@ -0,0 +1,254 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rook/rook/pkg/cephmgr/client"
+	"github.com/rook/rook/pkg/cephmgr/client/test"
+	"github.com/rook/rook/pkg/cephmgr/mon"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/1.5/kubernetes/fake"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+)
+
+// create a cluster connected to a mock ceph cluster that responds to the given mon commands
+func newTestHealthCluster(responses map[string]string) (*Cluster, *mon.ClusterInfo) {
+	conn := &test.MockConnection{
+		MockMonCommand: func(args []byte) ([]byte, string, error) {
+			for prefix, response := range responses {
+				if strings.Contains(string(args), prefix) {
+					return []byte(response), "", nil
+				}
+			}
+			return []byte{}, "", nil
+		},
+	}
+	factory := &test.MockConnectionFactory{Conn: conn, Fsid: testClusterInfo().FSID, SecretKey: "mysecret"}
+	c := New("ns", factory, "myversion")
+	c.configDir = "/tmp"
+
+	info := testClusterInfo()
+	info.Monitors["mon0"] = mon.ToCephMon("mon0", "1.2.3.4")
+	return c, info
+}
+
+func TestCheckClockSkew(t *testing.T) {
+	c, info := newTestHealthCluster(map[string]string{
+		`"prefix":"status"`: `{"health":{"health":{"health_services":[]},"timechecks":{"epoch":4,"round":10,"round_status":"finished",` +
+			`"mons":[{"name":"mon0","skew":0.000000,"latency":0.000000,"health":"HEALTH_OK"},` +
+			`{"name":"mon1","skew":-0.200000,"latency":0.001000,"health":"HEALTH_WARN","details":"clock skew 0.2s > max 0.05s"}]},` +
+			`"summary":[{"severity":"HEALTH_WARN","summary":"Monitor clock skew detected "}],"overall_status":"HEALTH_WARN",` +
+			`"detail":["mon.mon1 addr 1.2.3.5:6790\/0 clock skew 0.2s > max 0.05s (latency 0.001s)"]},"fsid":"22ae0d50-c4bc-4cfb-9cf4-341acbe35302"}`,
+	})
+
+	skews, err := c.CheckClockSkew(info)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(skews))
+	assert.Equal(t, 0.0, skews["mon0"])
+	assert.Equal(t, -0.2, skews["mon1"])
+}
+
+func TestHasQuorum(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   string
+		quorum   bool
+		current  int
+		required int
+	}{
+		{"all", allInQuorumResponse, true, 3, 2},
+		{"one down", `{"quorum":[0,2],"monmap":{"mons":[{"name":"mon0","rank":0},{"name":"mon1","rank":1},{"name":"mon2","rank":2}]}}`, true, 2, 2},
+		{"lost", `{"quorum":[0],"monmap":{"mons":[{"name":"mon0","rank":0},{"name":"mon1","rank":1},{"name":"mon2","rank":2}]}}`, false, 1, 2},
+		{"single mon", test.SuccessfulMonStatusResponse, true, 1, 1},
+		{"five mons", `{"quorum":[0,1,2],"monmap":{"mons":[{"name":"a","rank":0},{"name":"b","rank":1},` +
+			`{"name":"c","rank":2},{"name":"d","rank":3},{"name":"e","rank":4}]}}`, true, 3, 3},
+		{"no status", `not json`, false, 0, 2},
+	}
+	for _, tc := range tests {
+		c, info := newTestHealthCluster(map[string]string{"mon_status": tc.status})
+		quorum, current, required := c.HasQuorum(info)
+		assert.Equal(t, tc.quorum, quorum, tc.name)
+		assert.Equal(t, tc.current, current, tc.name)
+		assert.Equal(t, tc.required, required, tc.name)
+	}
+}
+
+func TestQuorumMajority(t *testing.T) {
+	tests := []struct {
+		size     int
+		majority int
+	}{
+		{1, 1}, {2, 2}, {3, 2}, {4, 3}, {5, 3}, {6, 4}, {7, 4}, {8, 5}, {9, 5},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, tc.majority, QuorumMajority(tc.size), fmt.Sprintf("size %d", tc.size))
+	}
+}
+
+func TestQuorumStatus(t *testing.T) {
+	c, info := newTestHealthCluster(map[string]string{
+		"mon_status": `{"quorum":[0],"monmap":{"mons":[{"name":"mon0","rank":0},{"name":"mon1","rank":1},{"name":"mon2","rank":2}]}}`,
+	})
+	required, present, err := c.QuorumStatus(info)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, required)
+	assert.Equal(t, 1, present)
+
+	// the desired size is the majority when the status is not available
+	c, info = newTestHealthCluster(map[string]string{"mon_status": `not json`})
+	c.Size = 5
+	required, present, err = c.QuorumStatus(info)
+	assert.NotNil(t, err)
+	assert.Equal(t, 3, required)
+	assert.Equal(t, 0, present)
+}
+
+func TestRestartStuckMons(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		testMonPod("mon0", "ns", "1.2.3.4", v1.PodRunning),
+		testMonPod("mon1", "ns", "1.2.3.5", v1.PodRunning))
+
+	// mon1 is in the monmap but never joins quorum
+	c, info := newTestHealthCluster(map[string]string{"mon_status": `{"quorum":[0],"monmap":{"mons":[` +
+		`{"name":"mon0","rank":0},{"name":"mon1","rank":1}]}}`})
+	info.Monitors["mon1"] = mon.ToCephMon("mon1", "1.2.3.5")
+
+	// the first time the mon is seen out of quorum starts the timer
+	restarted, err := c.restartStuckMons(clientset, info)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(restarted))
+	assert.Equal(t, 1, len(c.probingSince))
+
+	// the mon is restarted after probing longer than the timeout
+	c.probingSince["mon1"] = time.Now().Add(-time.Hour)
+	restarted, err = c.restartStuckMons(clientset, info)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"mon1"}, restarted)
+	_, err = clientset.Core().Pods("ns").Get("mon1")
+	assert.NotNil(t, err)
+	_, err = clientset.Core().Pods("ns").Get("mon0")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(c.probingSince))
+}
+
+// a connection to mons that reject the stored key
+type rejectedConnection struct {
+	*test.MockConnection
+}
+
+func (c *rejectedConnection) Connect() error {
+	return fmt.Errorf("cephd: Operation not permitted")
+}
+
+type rejectingFactory struct {
+	test.MockConnectionFactory
+}
+
+func (f *rejectingFactory) NewConnWithClusterAndUser(clusterName string, userName string) (client.Connection, error) {
+	return &rejectedConnection{&test.MockConnection{}}, nil
+}
+
+func TestVerifySecrets(t *testing.T) {
+	c, info := newTestHealthCluster(map[string]string{})
+	assert.Nil(t, c.VerifySecrets(info))
+
+	c.factory = &rejectingFactory{}
+	err := c.VerifySecrets(info)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "rejected the admin key in secret mon")
+	}
+
+	// the mons are not waited on when the key is stale
+	clientset := fake.NewSimpleClientset(
+		testMonSecret("ns"),
+		testMonPod("mon0", "ns", "1.2.3.4", v1.PodRunning),
+		testMonPod("mon1", "ns", "1.2.3.5", v1.PodRunning),
+		testMonPod("mon2", "ns", "1.2.3.6", v1.PodRunning))
+	_, requeue, err := c.EnsureMons(clientset)
+	assert.NotNil(t, err)
+	assert.Equal(t, time.Duration(0), requeue)
+}
+
+func TestGetMonStoreSizes(t *testing.T) {
+	c, info := newTestHealthCluster(map[string]string{
+		`"prefix":"status"`: `{"health":{"health":{"health_services":[{"mons":[` +
+			`{"name":"mon0","store_stats":{"bytes_total":1048576}},` +
+			`{"name":"mon1","store_stats":{"bytes_total":2147483648}}]}]}}}`,
+	})
+
+	sizes, err := c.GetMonStoreSizes(info)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int64{"mon0": 1048576, "mon1": 2147483648}, sizes)
+
+	// a failed status is returned
+	c, info = newTestHealthCluster(map[string]string{`"prefix":"status"`: "not json"})
+	_, err = c.GetMonStoreSizes(info)
+	assert.NotNil(t, err)
+}
+
+// the health detail of a mon of this ceph release with a mon down
+const healthDetailResponse = `{"health":{"health_services":[{"mons":[{"name":"mon0","kb_total":64891708,"kb_used":34813204,` +
+	`"kb_avail":26759160,"avail_percent":41,"last_updated":"2016-10-26 17:03:36.573444","store_stats":{"bytes_total":14871920,` +
+	`"bytes_sst":0,"bytes_log":2833842,"bytes_misc":12038078,"last_updated":"0.000000"},"health":"HEALTH_OK"}]}]},` +
+	`"timechecks":{"epoch":4,"round":0,"round_status":"finished"},` +
+	`"summary":[{"severity":"HEALTH_WARN","summary":"too many PGs per OSD (2048 > max 300)"},` +
+	`{"severity":"HEALTH_WARN","summary":"1 mons down, quorum 0,1 mon0,mon1"}],"overall_status":"HEALTH_WARN",` +
+	`"detail":["too many PGs per OSD (2048 > max 300)","mon.mon2 (rank 2) addr 10.0.0.3:6790\/0 is down (out of quorum)"]}`
+
+func TestGetCephHealth(t *testing.T) {
+	c, info := newTestHealthCluster(map[string]string{`"prefix":"health"`: healthDetailResponse})
+	health, err := c.GetCephHealth(info)
+	assert.Nil(t, err)
+	assert.Equal(t, "HEALTH_WARN", health.Status)
+	assert.Equal(t, []CephHealthCheck{
+		{Severity: "HEALTH_WARN", Summary: "too many PGs per OSD (2048 > max 300)"},
+		{Severity: "HEALTH_WARN", Summary: "1 mons down, quorum 0,1 mon0,mon1"},
+	}, health.Checks)
+	assert.Equal(t, []string{"too many PGs per OSD (2048 > max 300)", "mon.mon2 (rank 2) addr 10.0.0.3:6790/0 is down (out of quorum)"}, health.Detail)
+
+	// a healthy cluster has no checks
+	c, info = newTestHealthCluster(map[string]string{`"prefix":"health"`: `{"health":{"health_services":[]},` +
+		`"timechecks":{"epoch":4,"round":0,"round_status":"finished"},"summary":[],"overall_status":"HEALTH_OK","detail":[]}`})
+	health, err = c.GetCephHealth(info)
+	assert.Nil(t, err)
+	assert.Equal(t, "HEALTH_OK", health.Status)
+	assert.Equal(t, 0, len(health.Checks))
+
+	// the named checks of a newer image
+	c, info = newTestHealthCluster(map[string]string{
+		`"prefix":"health"`: `{"checks":{` +
+			`"OSD_DOWN":{"severity":"HEALTH_WARN","summary":{"message":"1 osds down"},"detail":[{"message":"osd.2 is down"}]},` +
+			`"MON_DOWN":{"severity":"HEALTH_WARN","summary":{"message":"1/3 mons down, quorum mon0,mon1"},"detail":[{"message":"mon.mon2 is down"}]}},` +
+			`"status":"HEALTH_WARN"}`,
+	})
+	health, err = c.GetCephHealth(info)
+	assert.Nil(t, err)
+	assert.Equal(t, "HEALTH_WARN", health.Status)
+	assert.Equal(t, []CephHealthCheck{
+		{Name: "MON_DOWN", Severity: "HEALTH_WARN", Summary: "1/3 mons down, quorum mon0,mon1", Detail: []string{"mon.mon2 is down"}},
+		{Name: "OSD_DOWN", Severity: "HEALTH_WARN", Summary: "1 osds down", Detail: []string{"osd.2 is down"}},
+	}, health.Checks)
+
+	// a response without a status is an error
+	c, info = newTestHealthCluster(map[string]string{`"prefix":"health"`: `{}`})
+	_, err = c.GetCephHealth(info)
+	assert.NotNil(t, err)
+}
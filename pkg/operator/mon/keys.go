@@ -0,0 +1,67 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"fmt"
+
+	"github.com/rook/rook/pkg/cephmgr/client"
+	"github.com/rook/rook/pkg/cephmgr/mon"
+)
+
+// KeyGenerator generates the ceph keys of a new cluster
+type KeyGenerator interface {
+	GenerateMonSecret() (string, error)
+	GenerateAdminSecret() (string, error)
+}
+
+// the default key generator creates the keys with the ceph connection factory
+type factoryKeyGenerator struct {
+	factory client.ConnectionFactory
+}
+
+func (g *factoryKeyGenerator) GenerateMonSecret() (string, error) {
+	return g.factory.NewSecretKey()
+}
+
+func (g *factoryKeyGenerator) GenerateAdminSecret() (string, error) {
+	return g.factory.NewSecretKey()
+}
+
+func (c *Cluster) keyGenerator() KeyGenerator {
+	if c.KeyGenerator != nil {
+		return c.KeyGenerator
+	}
+	return &factoryKeyGenerator{factory: c.factory}
+}
+
+// create the fsid and keys of a new cluster
+func (c *Cluster) createClusterInfo() (*mon.ClusterInfo, error) {
+	fsid, err := c.factory.NewFsid()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create fsid. %+v", err)
+	}
+	keys := c.keyGenerator()
+	monSecret, err := keys.GenerateMonSecret()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate the mon secret. %+v", err)
+	}
+	adminSecret, err := keys.GenerateAdminSecret()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate the admin secret. %+v", err)
+	}
+	return mon.NewClusterInfo(fsid, monSecret, adminSecret), nil
+}
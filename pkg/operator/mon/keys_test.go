@@ -0,0 +1,70 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rook/rook/pkg/cephmgr/client/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/1.5/kubernetes/fake"
+)
+
+type stubKeyGenerator struct {
+	err error
+}
+
+func (g *stubKeyGenerator) GenerateMonSecret() (string, error) {
+	return "hsm-mon-key", g.err
+}
+
+func (g *stubKeyGenerator) GenerateAdminSecret() (string, error) {
+	return "hsm-admin-key", g.err
+}
+
+func TestKeyGenerator(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	convertSecretStringData(clientset)
+	c := New("ns", &test.MockConnectionFactory{Fsid: "myfsid", SecretKey: "mysecret"}, "myversion")
+	c.KeyGenerator = &stubKeyGenerator{}
+
+	info, err := c.initClusterInfo(clientset)
+	assert.Nil(t, err)
+	assert.Equal(t, "myfsid", info.FSID)
+	assert.Equal(t, "hsm-mon-key", info.MonitorSecret)
+	assert.Equal(t, "hsm-admin-key", info.AdminSecret)
+
+	// the generated keys are saved
+	secret, err := clientset.Core().Secrets("ns").Get(appName)
+	assert.Nil(t, err)
+	assert.Equal(t, "hsm-mon-key", string(secret.Data[monSecretName]))
+	assert.Equal(t, "hsm-admin-key", string(secret.Data[adminSecretName]))
+
+	// the cluster is not created when the keys cannot be generated
+	clientset = fake.NewSimpleClientset()
+	c.KeyGenerator = &stubKeyGenerator{err: fmt.Errorf("mock hsm failure")}
+	_, err = c.initClusterInfo(clientset)
+	assert.NotNil(t, err)
+	_, err = clientset.Core().Secrets("ns").Get(appName)
+	assert.NotNil(t, err)
+
+	// the factory generates the keys by default
+	c.KeyGenerator = nil
+	info, err = c.initClusterInfo(fake.NewSimpleClientset())
+	assert.Nil(t, err)
+	assert.Equal(t, "mysecret", info.MonitorSecret)
+}
@@ -16,7 +16,46 @@ limitations under the License.
 package mon
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/coreos/pkg/capnslog"
 )
 
 var logger = capnslog.NewPackageLogger("github.com/rook/rook-operator", "op-mon")
+
+// waitLog logs the message of each iteration of a wait. A message that is the same as the last one is logged at
+// most once per interval so a slow start of many mons does not flood the log. The suppressed messages are counted
+// in the summary at the end of the wait.
+type waitLog struct {
+	name       string
+	interval   time.Duration
+	logf       func(format string, args ...interface{})
+	now        func() time.Time
+	last       string
+	lastLogged time.Time
+	suppressed int
+}
+
+func newWaitLog(name string, interval time.Duration) *waitLog {
+	return &waitLog{name: name, interval: interval, logf: logger.Infof, now: time.Now}
+}
+
+func (w *waitLog) log(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	now := w.now()
+	if msg == w.last && now.Sub(w.lastLogged) < w.interval {
+		w.suppressed++
+		return
+	}
+	w.logf("%s", msg)
+	w.last = msg
+	w.lastLogged = now
+}
+
+// log the number of suppressed messages, if any
+func (w *waitLog) summary() {
+	if w.suppressed > 0 {
+		w.logf("suppressed %d repeated messages while waiting for %s", w.suppressed, w.name)
+	}
+}
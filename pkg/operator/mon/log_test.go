@@ -0,0 +1,56 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWaitLog(t *testing.T) {
+	logged := []string{}
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	w := newWaitLog("pod mon0", 30*time.Second)
+	w.logf = func(format string, args ...interface{}) { logged = append(logged, fmt.Sprintf(format, args...)) }
+	w.now = func() time.Time { return now }
+
+	// a wait of two minutes with a check every six seconds logs the same message once per 30s
+	for i := 0; i < 20; i++ {
+		w.log("waiting %v for pod %s to start. status=%v", 6*time.Second, "mon0", "Pending")
+		now = now.Add(6 * time.Second)
+	}
+	assert.Equal(t, 4, len(logged))
+
+	// a changed message is logged right away
+	w.log("pod %s is running but has no ip yet", "mon0")
+	assert.Equal(t, 5, len(logged))
+	assert.Equal(t, "pod mon0 is running but has no ip yet", logged[4])
+
+	w.summary()
+	assert.Equal(t, 6, len(logged))
+	assert.Equal(t, "suppressed 16 repeated messages while waiting for pod mon0", logged[5])
+
+	// nothing is summarized when nothing was suppressed
+	logged = []string{}
+	w = newWaitLog("pod mon1", 30*time.Second)
+	w.logf = func(format string, args ...interface{}) { logged = append(logged, fmt.Sprintf(format, args...)) }
+	w.log("waiting for pod %s", "mon1")
+	w.summary()
+	assert.Equal(t, 1, len(logged))
+}
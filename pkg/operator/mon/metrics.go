@@ -0,0 +1,113 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/rook/rook/pkg/cephmgr/mon"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/client-go/1.5/kubernetes"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+	"k8s.io/client-go/1.5/pkg/util/intstr"
+)
+
+const (
+	metricsServiceName   = "rook-ceph-mon-metrics"
+	metricsContainerName = "exporter"
+	defaultMetricsPort   = 9128
+	adminSocketEnvVar    = "CEPH_ADMIN_SOCKET"
+	prometheusScrapeAttr = "prometheus.io/scrape"
+	prometheusPortAttr   = "prometheus.io/port"
+)
+
+func (c *Cluster) metricsPort() int32 {
+	if c.MetricsPort == 0 {
+		return defaultMetricsPort
+	}
+	return c.MetricsPort
+}
+
+// add the exporter sidecar that serves the metrics of the mon's admin socket, and the annotations
+// prometheus discovers the pod by
+func (c *Cluster) addMetricsExporter(pod *v1.Pod, config *MonConfig, clusterInfo *mon.ClusterInfo) {
+	if c.MetricsExporterImage == "" {
+		return
+	}
+
+	exporter := v1.Container{
+		Name:            metricsContainerName,
+		Image:           c.MetricsExporterImage,
+		ImagePullPolicy: c.getImagePullPolicy(),
+		Ports: []v1.ContainerPort{
+			{
+				Name:          "metrics",
+				ContainerPort: c.metricsPort(),
+				Protocol:      v1.ProtocolTCP,
+			},
+		},
+		// the admin socket is on the data volume of the mon
+		VolumeMounts: []v1.VolumeMount{{Name: k8sutil.DataDirVolume, MountPath: k8sutil.DataDir, ReadOnly: true}},
+		Env:          []v1.EnvVar{{Name: adminSocketEnvVar, Value: monAdminSocketPath(clusterInfo, config)}},
+	}
+	pod.Spec.Containers = append(pod.Spec.Containers, exporter)
+	pod.Annotations[prometheusScrapeAttr] = "true"
+	pod.Annotations[prometheusPortAttr] = strconv.Itoa(int(c.metricsPort()))
+}
+
+// start the service that prometheus scrapes the mon metrics from
+func (c *Cluster) startMetricsService(clientset kubernetes.Interface, clusterInfo *mon.ClusterInfo) error {
+	labels := getLabels(clusterInfo.Name)
+	s := &v1.Service{
+		ObjectMeta: v1.ObjectMeta{
+			Name:            metricsServiceName,
+			Namespace:       c.Namespace,
+			Labels:          labels,
+			OwnerReferences: c.ownerReferences(),
+			Annotations: map[string]string{
+				prometheusScrapeAttr: "true",
+				prometheusPortAttr:   strconv.Itoa(int(c.metricsPort())),
+			},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{
+				{
+					Name:       "metrics",
+					Port:       c.metricsPort(),
+					TargetPort: intstr.FromInt(int(c.metricsPort())),
+					Protocol:   v1.ProtocolTCP,
+				},
+			},
+			Selector: labels,
+		},
+	}
+	if c.OperatorID != "" {
+		s.Annotations[operatorIDAnnotation] = c.OperatorID
+	}
+
+	_, err := clientset.Core().Services(c.Namespace).Create(s)
+	if err != nil {
+		if !k8sutil.IsKubernetesResourceAlreadyExistError(err) {
+			return fmt.Errorf("failed to create mon metrics service. %+v", err)
+		}
+		logger.Infof("mon metrics service already exists")
+		return nil
+	}
+
+	logger.Infof("mon metrics service started")
+	return nil
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/1.5/kubernetes/fake"
+)
+
+func TestMetricsExporter(t *testing.T) {
+	config := &MonConfig{Name: "mon0", Port: 6790}
+	c := New("ns", nil, "myversion")
+	pod := c.makeMonPod(config, testClusterInfo(), true, false)
+	assert.Equal(t, 1, len(pod.Spec.Containers))
+	assert.Equal(t, "", pod.Annotations[prometheusScrapeAttr])
+
+	c.MetricsExporterImage = "ceph-exporter:v1"
+	pod = c.makeMonPod(config, testClusterInfo(), true, false)
+	if assert.Equal(t, 2, len(pod.Spec.Containers)) {
+		exporter := pod.Spec.Containers[1]
+		assert.Equal(t, "ceph-exporter:v1", exporter.Image)
+		assert.Equal(t, int32(9128), exporter.Ports[0].ContainerPort)
+		assert.Equal(t, monAdminSocketPath(testClusterInfo(), config), exporter.Env[0].Value)
+	}
+	assert.Equal(t, "true", pod.Annotations[prometheusScrapeAttr])
+	assert.Equal(t, "9128", pod.Annotations[prometheusPortAttr])
+
+	// the service for the scrape target is started with the mons
+	clientset := fake.NewSimpleClientset()
+	startCreatedPods(clientset)
+	c.PodStartDelay = time.Millisecond
+	c.MetricsPort = 9999
+	_, err := c.startPods(clientset, testClusterInfo(), []*MonConfig{config})
+	assert.Nil(t, err)
+	s, err := clientset.Core().Services("ns").Get(metricsServiceName)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(9999), s.Spec.Ports[0].Port)
+	assert.Equal(t, "9999", s.Annotations[prometheusPortAttr])
+	assert.Equal(t, getLabels("rookcluster"), s.Spec.Selector)
+}
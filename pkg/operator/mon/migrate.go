@@ -0,0 +1,350 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/rook/rook/pkg/cephmgr/mon"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/client-go/1.5/kubernetes"
+	"k8s.io/client-go/1.5/pkg/api"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+)
+
+const (
+	// the config map in the old namespace that records the progress of a migration
+	migrationName         = "mon-migration"
+	migrationNamespaceKey = "namespace"
+	migrationMonsKey      = "mons"
+)
+
+// MigrateNamespace moves the mons to another namespace. The mon secrets and endpoints are copied to the new
+// namespace. The mons are then moved one at a time: the mon is removed from the monmap in the old namespace and
+// started in the new namespace as a joining mon that syncs its store from the other mons, so quorum and the cluster
+// state are kept. The remaining mon resources in the old namespace are removed once all of the mons were moved. The
+// moved mons are recorded in the old namespace, where they are not started again. A migration that fails resumes
+// with the mons that were not moved yet. A single mon cannot be migrated since it is the only copy of the cluster
+// state. No other operation changes the mons during the migration.
+func (c *Cluster) MigrateNamespace(clientset kubernetes.Interface, newNamespace string) error {
+	if newNamespace == c.Namespace {
+		return fmt.Errorf("the mons are already in namespace %s", newNamespace)
+	}
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+	oldNamespace := c.Namespace
+
+	moved, err := c.loadMigration(clientset, oldNamespace, newNamespace)
+	if err != nil {
+		return err
+	}
+	clusterInfo, err := c.initClusterInfo(clientset)
+	if err != nil {
+		return fmt.Errorf("failed to get mon secrets. %+v", err)
+	}
+
+	// the mons of both namespaces are in the monmap while the mons are moved
+	clusterInfo.Monitors = map[string]*mon.CephMonitorConfig{}
+	remaining, err := c.addRunningMons(clientset, clusterInfo, oldNamespace)
+	if err != nil {
+		return err
+	}
+	started, err := c.addRunningMons(clientset, clusterInfo, newNamespace)
+	if err != nil {
+		return err
+	}
+	if len(clusterInfo.Monitors) < 2 {
+		return fmt.Errorf("cannot migrate %d mons. a single mon holds the only copy of the cluster state and cannot be removed", len(clusterInfo.Monitors))
+	}
+
+	for _, name := range []string{c.SecretName, storageClassSecretName} {
+		if err := copySecret(clientset, name, oldNamespace, newNamespace); err != nil {
+			return err
+		}
+	}
+	if err := copyConfigMap(clientset, EndpointConfigMapName, oldNamespace, newNamespace); err != nil {
+		return err
+	}
+
+	// a mon that was removed from the old namespace but did not start in the new namespace is moved again
+	names := remaining
+	for _, name := range moved {
+		if !containsString(remaining, name) && !containsString(started, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	logger.Infof("moving mons %v of cluster %s to namespace %s", names, clusterInfo.Name, newNamespace)
+	if err := c.moveMons(clientset, clusterInfo, names, moved, oldNamespace, newNamespace); err != nil {
+		return fmt.Errorf("failed to move the mons to namespace %s. %+v", newNamespace, err)
+	}
+
+	c.Namespace = newNamespace
+	info, requeue, err := c.ensureMons(clientset)
+	if err == nil && requeue != 0 {
+		err = c.WaitForQuorum(info)
+	}
+	if err != nil {
+		// the migration resumes from the old namespace
+		c.Namespace = oldNamespace
+		return fmt.Errorf("failed to reconcile the mons in namespace %s. %+v", newNamespace, err)
+	}
+
+	logger.Infof("mons are in quorum in namespace %s. removing the mon resources in namespace %s", newNamespace, oldNamespace)
+	c.cache.invalidate(oldNamespace)
+	return c.removeMonResources(clientset, oldNamespace, clusterInfo.Name)
+}
+
+// add the running mons in the namespace to the cluster info. returns the names of the mons, sorted.
+func (c *Cluster) addRunningMons(clientset kubernetes.Interface, clusterInfo *mon.ClusterInfo, namespace string) ([]string, error) {
+	running, _, err := c.pollPods(clientset, namespace, clusterInfo.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mon pods in namespace %s. %+v", namespace, err)
+	}
+	names := []string{}
+	for _, p := range running {
+		if c.monIP(p) == "" {
+			continue
+		}
+		clusterInfo.Monitors[p.Name] = c.cephMon(namespace, p.Name, c.monIP(p))
+		names = append(names, p.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Move the mons one at a time. The mon is removed from the monmap first since the new mon has the same name. The
+// new mon joins the monmap of the other mons, and quorum must be restored before the next mon is moved. Each mon is
+// recorded as moved before it is removed so that it is neither started again in the old namespace nor lost when
+// the move fails.
+func (c *Cluster) moveMons(clientset kubernetes.Interface, clusterInfo *mon.ClusterInfo, names, moved []string, oldNamespace, newNamespace string) error {
+	for _, name := range names {
+		if !containsString(moved, name) {
+			moved = append(moved, name)
+		}
+		if err := c.saveMigration(clientset, clusterInfo, oldNamespace, newNamespace, moved); err != nil {
+			return err
+		}
+
+		if err := c.removeMon(clientset, clusterInfo, oldNamespace, name, false); err != nil {
+			return fmt.Errorf("failed to remove mon %s from namespace %s. %+v", name, oldNamespace, err)
+		}
+		if err := c.startMovedMon(clientset, clusterInfo, newNamespace, name); err != nil {
+			return fmt.Errorf("failed to start mon %s in namespace %s. %+v", name, newNamespace, err)
+		}
+		// the clients in the old namespace find the moved mon
+		if err := c.saveEndpoints(clientset, oldNamespace, clusterInfo); err != nil {
+			return err
+		}
+		if err := c.WaitForQuorum(clusterInfo); err != nil {
+			return err
+		}
+		logger.Infof("moved mon %s to namespace %s", name, newNamespace)
+	}
+	return nil
+}
+
+// start the mon in the namespace as a joining mon of the mons in the cluster info
+func (c *Cluster) startMovedMon(clientset kubernetes.Interface, clusterInfo *mon.ClusterInfo, namespace, name string) error {
+	if err := c.saveConfigOverride(clientset, namespace, clusterInfo); err != nil {
+		return err
+	}
+	if c.Subdomain != "" {
+		if err := c.startService(clientset, namespace, clusterInfo); err != nil {
+			return fmt.Errorf("failed to start mon service. %+v", err)
+		}
+	}
+	antiAffinity, err := c.getAntiAffinity(clientset)
+	if err != nil {
+		return fmt.Errorf("failed to get antiaffinity. %+v", err)
+	}
+
+	config := &MonConfig{Name: name, Port: c.port(), V2Port: c.V2Port}
+	if err := c.createDataVolumeClaims(clientset, namespace, clusterInfo, []*MonConfig{config}); err != nil {
+		return fmt.Errorf("failed to create mon data volume. %+v", err)
+	}
+	monPod := c.makeMonPod(config, clusterInfo, antiAffinity, false)
+	monPod.Namespace = namespace
+	if _, err := clientset.Core().Pods(namespace).Create(monPod); err != nil && !k8sutil.IsKubernetesResourceAlreadyExistError(err) {
+		return createPodError(monPod.Name, err)
+	}
+	running, err := c.waitForPodToStart(clientset, monPod)
+	if err != nil {
+		return err
+	}
+	clusterInfo.Monitors[name] = c.cephMon(namespace, name, c.monIP(running))
+	return c.saveEndpoints(clientset, namespace, clusterInfo)
+}
+
+// the mons already moved by a migration to the namespace that did not finish. an error if the mons are being
+// migrated to another namespace.
+func (c *Cluster) loadMigration(clientset kubernetes.Interface, namespace, newNamespace string) ([]string, error) {
+	configMap, err := clientset.Core().ConfigMaps(namespace).Get(migrationName)
+	if err != nil {
+		if k8sutil.IsKubernetesResourceNotFoundError(err) {
+			return []string{}, nil
+		}
+		return nil, fmt.Errorf("failed to get mon migration. %+v", err)
+	}
+	if c.foreign(configMap.ObjectMeta) {
+		return []string{}, nil
+	}
+	if target := configMap.Data[migrationNamespaceKey]; target != newNamespace {
+		return nil, fmt.Errorf("the mons are being migrated to namespace %s", target)
+	}
+	if configMap.Data[migrationMonsKey] == "" {
+		return []string{}, nil
+	}
+	return strings.Split(configMap.Data[migrationMonsKey], ","), nil
+}
+
+// record the mons that are moved to the new namespace
+func (c *Cluster) saveMigration(clientset kubernetes.Interface, clusterInfo *mon.ClusterInfo, namespace, newNamespace string, moved []string) error {
+	data := map[string]string{migrationNamespaceKey: newNamespace, migrationMonsKey: strings.Join(moved, ",")}
+	configMap, err := clientset.Core().ConfigMaps(namespace).Get(migrationName)
+	if err != nil {
+		if !k8sutil.IsKubernetesResourceNotFoundError(err) {
+			return fmt.Errorf("failed to get mon migration. %+v", err)
+		}
+		configMap = &v1.ConfigMap{
+			ObjectMeta: v1.ObjectMeta{
+				Name:            migrationName,
+				Namespace:       namespace,
+				Labels:          getLabels(clusterInfo.Name),
+				Annotations:     c.operatorAnnotations(),
+				OwnerReferences: c.ownerReferences(),
+			},
+			Data: data,
+		}
+		if _, err := clientset.Core().ConfigMaps(namespace).Create(configMap); err != nil {
+			return fmt.Errorf("failed to create mon migration. %+v", err)
+		}
+		return nil
+	}
+
+	configMap.Data = data
+	if _, err := clientset.Core().ConfigMaps(namespace).Update(configMap); err != nil {
+		return fmt.Errorf("failed to update mon migration. %+v", err)
+	}
+	return nil
+}
+
+// the mons that were moved by a migration that did not finish are not started in the namespace they were moved from
+func (c *Cluster) checkMigration(clientset kubernetes.Interface) error {
+	configMap, err := clientset.Core().ConfigMaps(c.Namespace).Get(migrationName)
+	if err != nil {
+		if k8sutil.IsKubernetesResourceNotFoundError(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to get mon migration. %+v", err)
+	}
+	if c.foreign(configMap.ObjectMeta) {
+		return nil
+	}
+	return fmt.Errorf("mons %s are being migrated to namespace %s. resume the migration to reconcile the mons",
+		configMap.Data[migrationMonsKey], configMap.Data[migrationNamespaceKey])
+}
+
+// copy the secret to another namespace. a secret that was already copied is kept.
+func copySecret(clientset kubernetes.Interface, name, from, to string) error {
+	secret, err := clientset.Core().Secrets(from).Get(name)
+	if err != nil {
+		if k8sutil.IsKubernetesResourceNotFoundError(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to get secret %s. %+v", name, err)
+	}
+
+	copied := &v1.Secret{
+		ObjectMeta: v1.ObjectMeta{Name: name, Namespace: to, Labels: secret.Labels},
+		Data:       secret.Data,
+		StringData: secret.StringData,
+		Type:       secret.Type,
+	}
+	if _, err := clientset.Core().Secrets(to).Create(copied); err != nil && !k8sutil.IsKubernetesResourceAlreadyExistError(err) {
+		return fmt.Errorf("failed to copy secret %s to namespace %s. %+v", name, to, err)
+	}
+	return nil
+}
+
+// copy the config map to another namespace. a config map that was already copied is kept.
+func copyConfigMap(clientset kubernetes.Interface, name, from, to string) error {
+	configMap, err := clientset.Core().ConfigMaps(from).Get(name)
+	if err != nil {
+		if k8sutil.IsKubernetesResourceNotFoundError(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to get config map %s. %+v", name, err)
+	}
+
+	copied := &v1.ConfigMap{
+		ObjectMeta: v1.ObjectMeta{Name: name, Namespace: to, Labels: configMap.Labels},
+		Data:       configMap.Data,
+	}
+	if _, err := clientset.Core().ConfigMaps(to).Create(copied); err != nil && !k8sutil.IsKubernetesResourceAlreadyExistError(err) {
+		return fmt.Errorf("failed to copy config map %s to namespace %s. %+v", name, to, err)
+	}
+	return nil
+}
+
+// delete the mon pods and the resources rook created for the mons in the namespace
+func (c *Cluster) removeMonResources(clientset kubernetes.Interface, namespace, clusterName string) error {
+	pods, err := clientset.Core().Pods(namespace).List(listOptions(clusterName))
+	if err != nil {
+		return fmt.Errorf("failed to list mon pods in namespace %s. %+v", namespace, err)
+	}
+	for _, pod := range pods.Items {
+		if err := ignoreNotFound(clientset.Core().Pods(namespace).Delete(pod.Name, &api.DeleteOptions{})); err != nil {
+			return fmt.Errorf("failed to delete mon pod %s. %+v", pod.Name, err)
+		}
+	}
+
+	for _, name := range []string{EndpointConfigMapName, configOverrideName, StatusConfigMapName, monMapBackupName, migrationName} {
+		if err := ignoreNotFound(clientset.Core().ConfigMaps(namespace).Delete(name, &api.DeleteOptions{})); err != nil {
+			return fmt.Errorf("failed to delete config map %s. %+v", name, err)
+		}
+	}
+	if err := ignoreNotFound(clientset.Policy().PodDisruptionBudgets(namespace).Delete(pdbName, &api.DeleteOptions{})); err != nil {
+		return fmt.Errorf("failed to delete mon disruption budget. %+v", err)
+	}
+	if c.Subdomain != "" {
+		if err := ignoreNotFound(clientset.Core().Services(namespace).Delete(c.Subdomain, &api.DeleteOptions{})); err != nil {
+			return fmt.Errorf("failed to delete mon service. %+v", err)
+		}
+	}
+	if c.MetricsExporterImage != "" {
+		if err := ignoreNotFound(clientset.Core().Services(namespace).Delete(metricsServiceName, &api.DeleteOptions{})); err != nil {
+			return fmt.Errorf("failed to delete mon metrics service. %+v", err)
+		}
+	}
+	for _, name := range []string{c.SecretName, storageClassSecretName} {
+		if err := ignoreNotFound(clientset.Core().Secrets(namespace).Delete(name, &api.DeleteOptions{})); err != nil {
+			return fmt.Errorf("failed to delete secret %s. %+v", name, err)
+		}
+	}
+	return nil
+}
+
+func ignoreNotFound(err error) error {
+	if err != nil && k8sutil.IsKubernetesResourceNotFoundError(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/1.5/kubernetes/fake"
+	"k8s.io/client-go/1.5/pkg/api/errors"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+	"k8s.io/client-go/1.5/pkg/runtime"
+	core "k8s.io/client-go/1.5/testing"
+)
+
+func TestMigrateNamespace(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		testMonSecret("ns"),
+		testMonPod("mon0", "ns", "1.2.3.4", v1.PodRunning),
+		testMonPod("mon1", "ns", "1.2.3.5", v1.PodRunning),
+		testMonPod("mon2", "ns", "1.2.3.6", v1.PodRunning))
+	startCreatedPods(clientset)
+	// record the order in which the mons are removed and created
+	actions := []string{}
+	clientset.PrependReactor("*", "pods", func(action core.Action) (bool, runtime.Object, error) {
+		switch action.GetVerb() {
+		case "create":
+			pod := action.(core.CreateAction).GetObject().(*v1.Pod)
+			// a bootstrap mon would create a new monmap with an empty store
+			assert.Contains(t, pod.Spec.Containers[0].Command[2], "--mon-endpoints=")
+			actions = append(actions, "create "+action.GetNamespace()+"/"+pod.Name)
+		case "delete":
+			actions = append(actions, "delete "+action.GetNamespace()+"/"+action.(core.DeleteAction).GetName())
+		}
+		return false, nil, nil
+	})
+	c, info := newTestHealthCluster(map[string]string{"mon_status": allInQuorumResponse})
+	c.PodStartDelay = time.Millisecond
+	assert.Nil(t, c.saveEndpoints(clientset, "ns", info))
+
+	assert.NotNil(t, c.MigrateNamespace(clientset, "ns"))
+
+	err := c.MigrateNamespace(clientset, "ns2")
+	assert.Nil(t, err)
+	assert.Equal(t, "ns2", c.Namespace)
+
+	// the mons were moved one at a time so the other mons kept quorum
+	assert.Equal(t, []string{
+		"delete ns/mon0", "create ns2/mon0",
+		"delete ns/mon1", "create ns2/mon1",
+		"delete ns/mon2", "create ns2/mon2",
+	}, actions)
+
+	// the secrets were copied and the mons recreated in the new namespace
+	secret, err := clientset.Core().Secrets("ns2").Get(appName)
+	assert.Nil(t, err)
+	assert.Equal(t, "adminsecret", string(secret.Data[adminSecretName]))
+	pods, err := clientset.Core().Pods("ns2").List(listOptions("rookcluster"))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(pods.Items))
+	_, err = clientset.Core().ConfigMaps("ns2").Get(EndpointConfigMapName)
+	assert.Nil(t, err)
+
+	// the old namespace was cleaned up
+	pods, err = clientset.Core().Pods("ns").List(listOptions("rookcluster"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(pods.Items))
+	_, err = clientset.Core().Secrets("ns").Get(appName)
+	assert.NotNil(t, err)
+	_, err = clientset.Core().ConfigMaps("ns").Get(EndpointConfigMapName)
+	assert.NotNil(t, err)
+}
+
+func TestMigrateSingleMon(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		testMonSecret("ns"),
+		testMonPod("mon0", "ns", "1.2.3.4", v1.PodRunning))
+	c, _ := newTestHealthCluster(map[string]string{"mon_status": allInQuorumResponse})
+
+	// the only mon cannot be removed from the monmap
+	assert.NotNil(t, c.MigrateNamespace(clientset, "ns2"))
+	assert.Equal(t, "ns", c.Namespace)
+	pods, err := clientset.Core().Pods("ns").List(listOptions("rookcluster"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pods.Items))
+	_, err = clientset.Core().Secrets("ns2").Get(appName)
+	assert.NotNil(t, err)
+}
+
+func TestMigrateResume(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		testMonSecret("ns"),
+		testMonPod("mon0", "ns", "1.2.3.4", v1.PodRunning),
+		testMonPod("mon1", "ns", "1.2.3.5", v1.PodRunning),
+		testMonPod("mon2", "ns", "1.2.3.6", v1.PodRunning))
+	startCreatedPods(clientset)
+	// mon1 cannot be created in the new namespace the first time
+	failCreate := true
+	clientset.PrependReactor("create", "pods", func(action core.Action) (bool, runtime.Object, error) {
+		if action.GetNamespace() == "ns2" && action.(core.CreateAction).GetObject().(*v1.Pod).Name == "mon1" && failCreate {
+			failCreate = false
+			return true, nil, fmt.Errorf("quota exceeded")
+		}
+		return false, nil, nil
+	})
+	c, _ := newTestHealthCluster(map[string]string{"mon_status": allInQuorumResponse})
+	c.PodStartDelay = time.Millisecond
+
+	assert.NotNil(t, c.MigrateNamespace(clientset, "ns2"))
+	assert.Equal(t, "ns", c.Namespace)
+	configMap, err := clientset.Core().ConfigMaps("ns").Get(migrationName)
+	assert.Nil(t, err)
+	assert.Equal(t, "ns2", configMap.Data[migrationNamespaceKey])
+	assert.Equal(t, "mon0,mon1", configMap.Data[migrationMonsKey])
+
+	// the moved mons are not started again in the old namespace
+	_, _, err = c.EnsureMons(clientset)
+	assert.NotNil(t, err)
+	_, err = clientset.Core().Pods("ns").Get("mon1")
+	assert.True(t, errors.IsNotFound(err))
+
+	// the migration cannot move to another namespace before it is finished
+	assert.NotNil(t, c.MigrateNamespace(clientset, "ns3"))
+
+	// the migration resumes with mon1 that was removed but not started, and mon2
+	assert.Nil(t, c.MigrateNamespace(clientset, "ns2"))
+	assert.Equal(t, "ns2", c.Namespace)
+	pods, err := clientset.Core().Pods("ns2").List(listOptions("rookcluster"))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(pods.Items))
+	_, err = clientset.Core().ConfigMaps("ns").Get(migrationName)
+	assert.True(t, errors.IsNotFound(err))
+}
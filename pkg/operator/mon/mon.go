@@ -17,234 +17,1019 @@ package mon
 
 import (
 	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/rook/rook/pkg/cephmgr/client"
 	"github.com/rook/rook/pkg/cephmgr/mon"
 	"github.com/rook/rook/pkg/operator/k8sutil"
+	rookversion "github.com/rook/rook/pkg/version"
 	"k8s.io/client-go/1.5/kubernetes"
 	"k8s.io/client-go/1.5/pkg/api"
+	"k8s.io/client-go/1.5/pkg/api/resource"
 	"k8s.io/client-go/1.5/pkg/api/v1"
+	"k8s.io/client-go/1.5/pkg/labels"
 )
 
 const (
 	appName           = "mon"
 	monNodeAttr       = "mon_node"
 	monClusterAttr    = "mon_cluster"
-	tprName           = "mon.rook.io"
 	fsidSecretName    = "fsid"
 	monSecretName     = "mon-secret"
 	adminSecretName   = "admin-secret"
 	clusterSecretName = "cluster-name"
+	fsidAnnotation    = "rook.io/fsid"
+
+	// the path where the service account admission controller mounts the api token
+	serviceAccountTokenDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	serviceAccountVolume   = "no-service-account-token"
+
+	// how soon to reconcile again when the mons are not yet in quorum
+	quorumRequeueDelay = 10 * time.Second
+
+	// the time the mon has to start listening before the liveness probe counts failures
+	livenessInitialDelaySeconds = 60
+	// the length of a period of the startup grace period
+	startupPeriodSeconds = 10
+
+	// the custom ca bundle is mounted from the ca.crt key of the config map
+	caBundleVolumeName = "ca-bundle"
+	caBundleDir        = "/etc/rook/ca"
+	caBundleKey        = "ca.crt"
+	caBundleEnvVar     = "SSL_CERT_FILE"
+
+	// the volume of the keyring when the keyring is not in the data dir
+	keyringVolumeName = "mon-keyring"
+
+	// the reason of the PodScheduled condition when no node fits the pod
+	podReasonUnschedulable = "Unschedulable"
+
+	// dnsClusterFirstWithHostNet is the policy that keeps cluster DNS resolution working for pods on the host network
+	dnsClusterFirstWithHostNet v1.DNSPolicy = "ClusterFirstWithHostNet"
 )
 
+var fsidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// ErrLockTimeout is returned when another mon operation did not finish within the LockTimeout. The operation can be retried.
+var ErrLockTimeout = fmt.Errorf("timed out waiting for another mon operation to finish")
+
+var errNilFactory = fmt.Errorf("the mon cluster requires a ceph connection factory. pass a non-nil factory to New")
+
 type Cluster struct {
-	Namespace    string
-	Keyring      string
+	Namespace string
+	Keyring   string
+	// SecretName is the secret where the mon keys are stored
+	SecretName string
+	// SecretKeyMap maps the default data keys of the secret (fsid, mon-secret, admin-secret, cluster-name)
+	// to the keys of a secret created by other tooling
+	SecretKeyMap map[string]string
 	ClusterName  string
+	// Version is the tag of the rook image, or a sha256:<hex> digest that pins the image
 	Version      string
 	MasterHost   string
 	Size         int
 	Paused       bool
 	AntiAffinity bool
+	// FailureDomainLabel is the node label, for example failure-domain.beta.kubernetes.io/zone, of the domains the mons
+	// are spread across instead of the nodes. There must be a domain for each mon.
+	FailureDomainLabel string
+	// DevMode runs a single mon for development and test clusters
+	DevMode      bool
 	Port         int32
-	factory      client.ConnectionFactory
+	HostNetwork  bool
+	DNSPolicy    v1.DNSPolicy
+	CacheTTL     time.Duration
+	Subdomain    string
+	MonResources v1.ResourceRequirements
+	// GuaranteedQoS raises the resource requests of the mons to their limits so the kubelet evicts the mons
+	// last under node pressure. Ignored in dev mode.
+	GuaranteedQoS bool
+	// Tolerations let the mons run on tainted nodes. The mons are restarted one at a time when the tolerations change
+	// so they keep running on nodes that get a new taint.
+	Tolerations []v1.Toleration
+	// PublicNetwork is the network in CIDR notation that the mons bind to when their nodes have several networks.
+	// It is set as the public_network of the mons.
+	PublicNetwork string
+	// V2Port is the port of the messenger v2 protocol that the mons listen on in addition to Port, for example 3300.
+	// The mons only have the legacy protocol when it is 0. It is rejected until the ceph in the rook image is nautilus.
+	V2Port int32
+	// DataVolumeSize stores the mon data on a persistent volume claim of this size when set
+	DataVolumeSize         resource.Quantity
+	DataVolumeStorageClass string
+	DataVolumeEncrypted    bool
+	// MonDiskWarnPercent is how full in percent the data volume of a mon can be before CheckMonDiskSpace warns
+	MonDiskWarnPercent int
+	// PodStartRetries and PodStartDelay bound how long to wait for each mon pod to start
+	PodStartRetries int
+	PodStartDelay   time.Duration
+	// UnschedulableTimeout is how long a mon pod can be unschedulable because of its affinity before the wait for
+	// it stops early. The scheduler retries the pod, for example after another pod was deleted, so the pod is
+	// given some time. 0 waits for the full pod start timeout.
+	UnschedulableTimeout time.Duration
+	// ReconcileDeadline bounds the total time a reconcile waits and retries across all of the mons. A reconcile that
+	// does not finish in time fails with ErrReconcileDeadlineExceeded. There is no deadline when zero.
+	ReconcileDeadline time.Duration
+	// ImagePullPolicy defaults to Always for the mutable latest tag and IfNotPresent for pinned versions
+	ImagePullPolicy v1.PullPolicy
+	// MaxConcurrentPodOps bounds the number of mon pods that are created at the same time. Mons that
+	// start together do not see each other's endpoints, so mons are started one at a time by default.
+	MaxConcurrentPodOps int
+	// ProvisionerCaps are the ceph caps of a dedicated key for the storage class secret, for example
+	// []string{"mon", "allow r", "osd", "allow rwx pool=rbd"}. The admin key is used when not set.
+	ProvisionerCaps []string
+	// NodeSelector is added to the default selector that requires linux nodes. Arch optionally requires
+	// nodes of the architecture of the rook image.
+	NodeSelector map[string]string
+	Arch         string
+	// Env is added to the environment of the mon container
+	Env []v1.EnvVar
+	// WaitForQuorumOnStart makes Start wait for the mons to form quorum before returning
+	WaitForQuorumOnStart bool
+	// DisableServiceAccountToken keeps the long-lived service account token out of the mon pods. The mons
+	// do not call the api server.
+	DisableServiceAccountToken bool
+	// WaitForReady makes Start wait for each mon pod to be ready rather than only running
+	WaitForReady bool
+	// PodSpecMutator customizes each mon pod after rook has set all of its fields, just before the pod is created.
+	// Changes to the fields rook relies on, such as the labels, name, and command, can break the mons.
+	PodSpecMutator func(*v1.Pod)
+	// AutoScaleMons grows the number of mons to the largest odd number that fits on the available nodes,
+	// up to MaxMons. The mons are never scaled down automatically.
+	AutoScaleMons bool
+	MaxMons       int
+	// MaxMonCount is the most mons the cluster can be sized to. Quorum latency grows with the number of mons.
+	// AutoScaleMons stops at this count.
+	MaxMonCount int
+	// CABundleConfigMap is a config map with a ca.crt key that is mounted in the mon pods and trusted instead of the
+	// system certs, for example in environments that intercept tls
+	CABundleConfigMap string
+	// KeyringMountPath is the path in the mon container of the keyring the mon daemon reads, for custom entrypoints
+	// that expect the keyring in a fixed place. The dir of the path is mounted in the pod. The keyring is in the data
+	// dir when it is empty.
+	KeyringMountPath string
+	// MetricsExporterImage adds a sidecar with this image to each mon that exports the metrics of the mon's
+	// admin socket on MetricsPort. The pods and a service are annotated so prometheus discovers them.
+	MetricsExporterImage string
+	MetricsPort          int32
+	// LivenessFailureThreshold and LivenessPeriodSeconds tune the liveness probe of the mons. The defaults
+	// tolerate a busy mon for a few minutes before it is restarted.
+	LivenessFailureThreshold int32
+	LivenessPeriodSeconds    int32
+	// StartupProbeFailureThreshold gives the mon this many periods of 10 seconds to initialize its store, for example
+	// on the first boot, before the liveness probe counts failures. The kubernetes api of the operator has no startup
+	// probe, so the liveness probe is delayed by the grace period instead, also when the mon starts quickly. 0 keeps
+	// the default delay of a minute.
+	StartupProbeFailureThreshold int32
+	// LockTimeout bounds the wait for another reconcile of the mons to finish, for example one that waits on a wedged mon
+	LockTimeout time.Duration
+	// EndpointChangeInterval is how often the saved endpoint of a mon can change. A mon that is rescheduled again
+	// within the interval keeps its saved endpoint until the interval passed, so the clients that cache the endpoints
+	// only see the latest endpoint. The endpoints always change when mons are added or removed. 0 saves every change.
+	EndpointChangeInterval time.Duration
+	// ProbeTimeout is how long a mon can stay out of quorum before it is restarted
+	ProbeTimeout time.Duration
+	// FailoverGracePeriod is how long a mon can be down before the health watchdog replaces it with a new mon
+	FailoverGracePeriod time.Duration
+	// SecretBackupFunc archives the secrets of a new cluster before they are saved. Losing the secrets
+	// means losing the cluster. A backup failure aborts the creation unless IgnoreSecretBackupErrors is set.
+	SecretBackupFunc         func(info *mon.ClusterInfo) error
+	IgnoreSecretBackupErrors bool
+	// MaxClusterInfoBackups is the number of backups of the mon secret that BackupClusterInfo keeps
+	MaxClusterInfoBackups int
+	// DNSSrvName is the srv record the mons bootstrap their peers from when the mon ips cannot be pinned
+	DNSSrvName string
+	// ConfirmForceQuorumRecovery allows ForceQuorumRecovery to discard the lost mons
+	ConfirmForceQuorumRecovery bool
+	// KeyGenerator generates the keys of a new cluster, for example in a hardware security module. The keys are
+	// generated with the ceph connection factory when not set.
+	KeyGenerator KeyGenerator
+	// OperatorVersion is recorded on the mon pods. It defaults to the version of the operator binary.
+	OperatorVersion string
+	// OperatorID identifies the operator instance when several operators run in the cluster. It is recorded on the
+	// objects created for the mons, and the objects that another operator created are not modified.
+	OperatorID string
+	// ConfigOverrides are ceph settings added to the global section of the mon config. The mons are
+	// restarted one at a time when the overrides change.
+	ConfigOverrides map[string]string
+	factory         client.ConnectionFactory
+	configDir       string
+	waitLogInterval time.Duration
+	resourceType    string
+	cache           *clusterInfoCache
+	opsLock         chan struct{}
+	probingLock     sync.Mutex
+	probingSince    map[string]time.Time
+	downLock        sync.Mutex
+	downSince       map[string]time.Time
+	deadlineLock    sync.Mutex
+	deadline        time.Time
+	createdLock     sync.Mutex
+	created         map[string]time.Time
+	endpointsLock   sync.Mutex
+	endpointChanged map[string]time.Time
+	watchdogLock    sync.Mutex
+	watchdogInfo    *mon.ClusterInfo
+	autoScaledSize  int
+	podLogs         func(clientset kubernetes.Interface, namespace, name string, opts *v1.PodLogOptions) ([]byte, error)
+	getResource     func(clientset kubernetes.Interface, path string) ([]byte, error)
+	putResource     func(clientset kubernetes.Interface, path string, body []byte) error
+	getStorageClass func(clientset kubernetes.Interface, name string) ([]byte, error)
+	lookupSRV       func(service, proto, name string) (string, []*net.SRV, error)
+	dial            func(network, address string, timeout time.Duration) (net.Conn, error)
+	// the mon resource that owns the objects created for the mons. nil if the resource does not exist.
+	owner *v1.OwnerReference
 }
 
 type MonConfig struct {
 	Name string
 	Port int32
+	// V2Port is the port of the messenger v2 protocol. 0 if the mon only has the legacy protocol.
+	V2Port int32
+	// Resources overrides the cluster-wide MonResources for this mon when set
+	Resources *v1.ResourceRequirements
+	// forceQuorum starts the mon with a monmap that only has itself
+	forceQuorum bool
 }
 
-func New(namespace string, factory client.ConnectionFactory, version string) *Cluster {
-	return &Cluster{
-		Namespace:    namespace,
-		Version:      version,
-		Size:         3,
-		factory:      factory,
-		AntiAffinity: true,
+// New creates the mon cluster with the default settings. The options change the defaults.
+func New(namespace string, factory client.ConnectionFactory, version string, options ...Option) *Cluster {
+	c := &Cluster{
+		Namespace:                namespace,
+		Version:                  version,
+		OperatorVersion:          rookversion.Version,
+		SecretName:               appName,
+		Size:                     3,
+		factory:                  factory,
+		AntiAffinity:             true,
+		configDir:                k8sutil.DataDir,
+		PodStartRetries:          15,
+		PodStartDelay:            6 * time.Second,
+		UnschedulableTimeout:     30 * time.Second,
+		waitLogInterval:          30 * time.Second,
+		ProbeTimeout:             5 * time.Minute,
+		FailoverGracePeriod:      10 * time.Minute,
+		MaxConcurrentPodOps:      1,
+		WaitForQuorumOnStart:     true,
+		GuaranteedQoS:            true,
+		MaxMons:                  5,
+		MaxMonCount:              7,
+		MaxClusterInfoBackups:    5,
+		MonDiskWarnPercent:       70,
+		LivenessFailureThreshold: 5,
+		LivenessPeriodSeconds:    30,
+		LockTimeout:              5 * time.Minute,
+		opsLock:                  make(chan struct{}, 1),
+		cache:                    newClusterInfoCache(),
+		podLogs:                  getPodLogs,
+		getResource:              getRESTResource,
+		putResource:              putRESTResource,
+		getStorageClass:          getRawStorageClass,
+		lookupSRV:                net.LookupSRV,
+		dial:                     net.DialTimeout,
 	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
 }
 
-func (c *Cluster) Start(clientset *kubernetes.Clientset) (*mon.ClusterInfo, error) {
+// Start starts the mons. Unless WaitForQuorumOnStart is false, Start returns only after the mons are in quorum.
+// The mon resource gets a finalizer so it is not deleted before Delete removes the mons, and owns the objects
+// created for the mons.
+func (c *Cluster) Start(clientset kubernetes.Interface) (*mon.ClusterInfo, error) {
+	if err := c.loadOwner(clientset); err != nil {
+		return nil, err
+	}
+	clusterInfo, requeue, err := c.EnsureMons(clientset)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.addFinalizer(clientset); err != nil {
+		return nil, err
+	}
+	if c.WaitForQuorumOnStart && requeue != 0 {
+		if err := c.WaitForQuorum(clusterInfo); err != nil {
+			return nil, err
+		}
+	}
+	if c.WaitForReady {
+		for name := range clusterInfo.Monitors {
+			if err := c.waitForPodReady(clientset, name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return clusterInfo, nil
+}
+
+// EnsureMons starts the mons and checks whether they have formed quorum. A non-zero requeue duration
+// is returned when the caller should reconcile again soon. Zero is returned when the mons are in steady state.
+func (c *Cluster) EnsureMons(clientset kubernetes.Interface) (*mon.ClusterInfo, time.Duration, error) {
 	logger.Infof("start running mons")
+	if c.factory == nil {
+		return nil, 0, errNilFactory
+	}
+	if err := c.lock(); err != nil {
+		return nil, 0, err
+	}
+	defer c.unlock()
+	return c.ensureMons(clientset)
+}
+
+// start the mons in the namespace of the cluster. the caller holds the ops lock.
+func (c *Cluster) ensureMons(clientset kubernetes.Interface) (*mon.ClusterInfo, time.Duration, error) {
+	// the spec is validated before the resource, the keys of a new cluster, or any other object is created
+	if c.DevMode && c.Size != 1 {
+		logger.Infof("running a single mon in dev mode")
+	}
+	if c.AutoScaleMons && !c.DevMode {
+		if err := c.autoScale(clientset); err != nil {
+			return nil, 0, fmt.Errorf("failed to scale the mons. %+v", err)
+		}
+	}
+	if err := c.validateSize(c.size()); err != nil {
+		return nil, 0, err
+	}
+	if err := k8sutil.ValidateImageVersion(c.Version); err != nil {
+		return nil, 0, err
+	}
+	if err := c.validatePublicNetwork(); err != nil {
+		return nil, 0, err
+	}
+	if err := c.validateV2Port(); err != nil {
+		return nil, 0, err
+	}
+	if err := c.validateKeyringMountPath(); err != nil {
+		return nil, 0, err
+	}
+	if err := c.validateDNSSrv(); err != nil {
+		return nil, 0, err
+	}
+	mons := []*MonConfig{}
+	for i := 0; i < c.size(); i++ {
+		mons = append(mons, &MonConfig{Name: fmt.Sprintf("mon%d", i), Port: c.port(), V2Port: c.V2Port})
+	}
+
+	// the mons that were moved to another namespace must not be started again here
+	if err := c.checkMigration(clientset); err != nil {
+		return nil, 0, err
+	}
+
+	err := c.registerResource(clientset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to register the mon resource. %+v", err)
+	}
 
 	clusterInfo, err := c.initClusterInfo(clientset)
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize ceph cluster info. %+v", err)
+		return nil, 0, fmt.Errorf("failed to initialize ceph cluster info. %+v", err)
 	}
-	mons := []*MonConfig{}
-	for i := 0; i < c.Size; i++ {
-		mons = append(mons, &MonConfig{Name: fmt.Sprintf("mon%d", i), Port: int32(mon.Port)})
+	if err := c.saveConfigOverride(clientset, c.Namespace, clusterInfo); err != nil {
+		return nil, 0, err
 	}
 
-	err = c.startPods(clientset, clusterInfo, mons)
+	failed, err := c.startPods(clientset, clusterInfo, mons)
 	if err != nil {
-		return nil, fmt.Errorf("failed to start mon pods. %+v", err)
+		return nil, 0, fmt.Errorf("failed to start mon pods. %+v", err)
+	}
+	if len(failed) > 0 {
+		logger.Warningf("mons %v failed to start", failed)
+		return clusterInfo, quorumRequeueDelay, nil
 	}
 
-	return clusterInfo, nil
+	inQuorum, err := c.inQuorum(clusterInfo)
+	if err != nil {
+		if isAuthError(err) {
+			// waiting does not help when the stored key is stale
+			return nil, 0, c.secretDriftError(err)
+		}
+		logger.Warningf("failed to check mon quorum. %+v", err)
+		return clusterInfo, quorumRequeueDelay, nil
+	}
+	if !inQuorum {
+		logger.Infof("mons are not yet in quorum")
+		if _, err := c.restartStuckMons(clientset, clusterInfo); err != nil {
+			logger.Warningf("failed to restart stuck mons. %+v", err)
+		}
+		return clusterInfo, quorumRequeueDelay, nil
+	}
+
+	if err := c.saveProvisionerKey(clientset, clusterInfo); err != nil {
+		return nil, 0, err
+	}
+
+	// only roll out config changes while the mons are healthy
+	if err := c.restartChangedMons(clientset, clusterInfo, mons); err != nil {
+		return nil, 0, fmt.Errorf("failed to restart mons with a changed config. %+v", err)
+	}
+	if _, err := c.relocateColocatedMons(clientset, clusterInfo, mons); err != nil {
+		return nil, 0, fmt.Errorf("failed to spread the mons across nodes. %+v", err)
+	}
+
+	return clusterInfo, 0, nil
 }
 
 // Retrieve the ceph cluster info if it already exists.
 // If a new cluster create new keys.
-func (c *Cluster) initClusterInfo(clientset *kubernetes.Clientset) (*mon.ClusterInfo, error) {
-	secrets, err := clientset.Secrets(c.Namespace).Get(appName)
+func (c *Cluster) initClusterInfo(clientset kubernetes.Interface) (*mon.ClusterInfo, error) {
+	if c.CacheTTL > 0 {
+		if info := c.cache.get(c.Namespace, c.CacheTTL); info != nil {
+			logger.Debugf("using cached monitor secrets for cluster %s", info.Name)
+			return info, nil
+		}
+	}
+
+	secrets, err := clientset.Core().Secrets(c.Namespace).Get(c.SecretName)
 	if err != nil {
 		if !k8sutil.IsKubernetesResourceNotFoundError(err) {
 			return nil, fmt.Errorf("failed to get mon secrets. %+v", err)
 		}
+		if err := c.checkNoExistingMons(clientset); err != nil {
+			return nil, err
+		}
 
 		return c.createMonSecretsAndSave(clientset)
 	}
 
-	info := &mon.ClusterInfo{
-		Name:          string(secrets.Data[clusterSecretName]),
-		FSID:          string(secrets.Data[fsidSecretName]),
-		MonitorSecret: string(secrets.Data[monSecretName]),
-		AdminSecret:   string(secrets.Data[adminSecretName]),
-		Monitors:      map[string]*mon.CephMonitorConfig{},
+	info := c.clusterInfoFromSecret(secrets)
+	if err := validateClusterInfo(info); err != nil {
+		return nil, fmt.Errorf("invalid mon secret %s. %+v", c.SecretName, err)
 	}
 	logger.Infof("found existing monitor secrets for cluster %s with fsid %s", info.Name, info.FSID)
+	c.cache.set(c.Namespace, info)
 	return info, nil
 }
 
-func (c *Cluster) createMonSecretsAndSave(clientset *kubernetes.Clientset) (*mon.ClusterInfo, error) {
+// New keys orphan the data of an existing cluster. Mon pods without the secret mean the secret was lost or
+// could not be read, so a new cluster is not created until someone investigates.
+func (c *Cluster) checkNoExistingMons(clientset kubernetes.Interface) error {
+	options := api.ListOptions{LabelSelector: labels.SelectorFromSet(map[string]string{k8sutil.AppAttr: appName})}
+	pods, err := clientset.Core().Pods(c.Namespace).List(options)
+	if err != nil {
+		return fmt.Errorf("failed to check for existing mon pods. %+v", err)
+	}
+	if len(pods.Items) > 0 {
+		return fmt.Errorf("mon secret %s not found but %d mon pods exist in namespace %s. refusing to create a new cluster. "+
+			"restore the secret or delete the mon pods of the old cluster", c.SecretName, len(pods.Items), c.Namespace)
+	}
+	return nil
+}
+
+// only one operation changes the mons at a time. a channel is used rather than a mutex so the wait can time out.
+func (c *Cluster) lock() error {
+	select {
+	case c.opsLock <- struct{}{}:
+		return nil
+	case <-time.After(c.LockTimeout):
+		return ErrLockTimeout
+	}
+}
+
+func (c *Cluster) unlock() {
+	<-c.opsLock
+}
+
+// the data key in the secret for the default key
+func (c *Cluster) secretKey(key string) string {
+	if mapped, ok := c.SecretKeyMap[key]; ok {
+		return mapped
+	}
+	return key
+}
+
+func (c *Cluster) clusterInfoFromSecret(secrets *v1.Secret) *mon.ClusterInfo {
+	return &mon.ClusterInfo{
+		Name:          string(secrets.Data[c.secretKey(clusterSecretName)]),
+		FSID:          string(secrets.Data[c.secretKey(fsidSecretName)]),
+		MonitorSecret: string(secrets.Data[c.secretKey(monSecretName)]),
+		AdminSecret:   string(secrets.Data[c.secretKey(adminSecretName)]),
+		Monitors:      map[string]*mon.CephMonitorConfig{},
+	}
+}
+
+// check that the secrets loaded for the cluster are complete so that a missing key is not found only when connecting
+func validateClusterInfo(info *mon.ClusterInfo) error {
+	if info.Name == "" {
+		return fmt.Errorf("missing cluster name")
+	}
+	if info.FSID == "" {
+		return fmt.Errorf("missing fsid")
+	}
+	if !fsidPattern.MatchString(info.FSID) {
+		return fmt.Errorf("fsid %s is not a valid uuid", info.FSID)
+	}
+	if info.MonitorSecret == "" {
+		return fmt.Errorf("missing mon secret")
+	}
+	if info.AdminSecret == "" {
+		return fmt.Errorf("missing admin secret")
+	}
+	return nil
+}
+
+// the data of the mon secret
+func (c *Cluster) secretData(info *mon.ClusterInfo) map[string]string {
+	return map[string]string{
+		c.secretKey(clusterSecretName): info.Name,
+		c.secretKey(fsidSecretName):    info.FSID,
+		c.secretKey(monSecretName):     info.MonitorSecret,
+		c.secretKey(adminSecretName):   info.AdminSecret,
+	}
+}
+
+func (c *Cluster) createMonSecretsAndSave(clientset kubernetes.Interface) (*mon.ClusterInfo, error) {
 	logger.Infof("creating mon secrets for a new cluster")
-	info, err := mon.CreateClusterInfo(c.factory, "")
+	info, err := c.createClusterInfo()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create mon secrets. %+v", err)
 	}
+	if c.SecretBackupFunc != nil {
+		if err := c.SecretBackupFunc(info); err != nil {
+			if !c.IgnoreSecretBackupErrors {
+				return nil, fmt.Errorf("failed to back up mon secrets. %+v", err)
+			}
+			logger.Warningf("failed to back up mon secrets. %+v", err)
+		}
+	}
 
 	// store the secrets for internal usage of the rook pods
-	secrets := map[string]string{
-		clusterSecretName: info.Name,
-		fsidSecretName:    info.FSID,
-		monSecretName:     info.MonitorSecret,
-		adminSecretName:   info.AdminSecret,
-	}
 	secret := &v1.Secret{
-		ObjectMeta: v1.ObjectMeta{Name: appName},
-		StringData: secrets,
+		ObjectMeta: v1.ObjectMeta{Name: c.SecretName, Namespace: c.Namespace, Annotations: c.operatorAnnotations(), OwnerReferences: c.ownerReferences()},
+		StringData: c.secretData(info),
 		Type:       k8sutil.RookType,
 	}
-	_, err = clientset.Secrets(c.Namespace).Create(secret)
+	_, err = clientset.Core().Secrets(c.Namespace).Create(secret)
+	c.cache.invalidate(c.Namespace)
 	if err != nil {
-		return nil, fmt.Errorf("failed to save mon secrets. %+v", err)
-	}
+		if !k8sutil.IsKubernetesResourceAlreadyExistError(err) {
+			return nil, fmt.Errorf("failed to save mon secrets. %+v", err)
+		}
 
-	// store the secret for usage by the storage class
-	storageClassSecret := map[string]string{
-		"key": info.AdminSecret,
-	}
-	secret = &v1.Secret{
-		ObjectMeta: v1.ObjectMeta{Name: "rook-admin"},
-		StringData: storageClassSecret,
-		Type:       k8sutil.RbdType,
+		// another reconcile created the secrets first. use its secrets instead of the ones generated here.
+		existing, err := clientset.Core().Secrets(c.Namespace).Get(c.SecretName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get mon secrets. %+v", err)
+		}
+		info = c.clusterInfoFromSecret(existing)
+		if err := validateClusterInfo(info); err != nil {
+			return nil, fmt.Errorf("invalid mon secret %s. %+v", c.SecretName, err)
+		}
+		logger.Infof("mon secrets were already created for cluster %s with fsid %s", info.Name, info.FSID)
+		return info, nil
 	}
-	_, err = clientset.Secrets(c.Namespace).Create(secret)
-	if err != nil {
-		if !k8sutil.IsKubernetesResourceAlreadyExistError(err) {
-			return nil, fmt.Errorf("failed to save rook-admin secret. %+v", err)
+
+	// store the secret for usage by the storage class. with restricted caps the provisioner key is
+	// created after the mons are in quorum.
+	if len(c.ProvisionerCaps) == 0 {
+		if err := c.saveStorageClassSecret(clientset, info.AdminSecret); err != nil {
+			return nil, err
 		}
-		logger.Infof("rook-admin secret already exists")
-	} else {
-		logger.Infof("saved rook-admin secret")
 	}
 
 	return info, nil
 }
 
-func (c *Cluster) startPods(clientset *kubernetes.Clientset, clusterInfo *mon.ClusterInfo, mons []*MonConfig) error {
+// a pod rejected by an admission webhook will be rejected again until the mon settings or the policy change, so
+// the error names the webhook and the policy instead of failing like any other create
+func createPodError(name string, err error) error {
+	if webhook, reason, ok := k8sutil.AdmissionWebhookRejection(err); ok {
+		return fmt.Errorf("mon pod %s was rejected by admission webhook %s: %s. change the mon settings or the policy so the pod is allowed", name, webhook, reason)
+	}
+	return fmt.Errorf("failed to create mon pod %s. %+v", name, err)
+}
+
+// Start the mon pods that are not running yet. A mon that fails to start does not fail the whole
+// cluster as long as enough mons are running to form quorum. The names of the failed mons are returned.
+func (c *Cluster) startPods(clientset kubernetes.Interface, clusterInfo *mon.ClusterInfo, mons []*MonConfig) ([]string, error) {
+	if err := c.validateEnv(); err != nil {
+		return nil, err
+	}
+
 	// schedule the mons on different nodes if we have enough nodes to be unique
 	antiAffinity, err := c.getAntiAffinity(clientset)
 	if err != nil {
-		return fmt.Errorf("failed to get antiaffinity. %+v", err)
+		return nil, fmt.Errorf("failed to get antiaffinity. %+v", err)
+	}
+
+	if err := c.reconcileLabels(clientset, clusterInfo); err != nil {
+		return nil, err
 	}
 
-	running, pending, err := c.pollPods(clientset, clusterInfo.Name)
+	running, pending, err := c.pollPods(clientset, c.Namespace, clusterInfo.Name)
 	if err != nil {
-		return fmt.Errorf("failed to get mon pods. %+v", err)
+		return nil, fmt.Errorf("failed to get mon pods. %+v", err)
+	}
+	if running, err = c.removeForeignPods(clientset, clusterInfo, running); err != nil {
+		return nil, err
+	}
+	if pending, err = c.removeForeignPods(clientset, clusterInfo, pending); err != nil {
+		return nil, err
 	}
 	logger.Infof("%d running, %d pending pods", len(running), len(pending))
 
+	if err := c.startPodDisruptionBudget(clientset, clusterInfo); err != nil {
+		return nil, err
+	}
+
+	if c.Subdomain != "" {
+		if err := c.startService(clientset, c.Namespace, clusterInfo); err != nil {
+			return nil, fmt.Errorf("failed to start mon service. %+v", err)
+		}
+	}
+	if c.MetricsExporterImage != "" {
+		if err := c.startMetricsService(clientset, clusterInfo); err != nil {
+			return nil, err
+		}
+	}
+
 	clusterInfo.Monitors = map[string]*mon.CephMonitorConfig{}
+	c.resetCreated()
+	addressed := 0
 	for _, m := range running {
-		clusterInfo.Monitors[m.Name] = mon.ToCephMon(m.Name, m.Status.PodIP)
+		if c.monIP(m) == "" {
+			// the mon is recorded when its ip is assigned
+			continue
+		}
+		clusterInfo.Monitors[m.Name] = c.cephMon(c.Namespace, m.Name, c.monIP(m))
+		c.captureFailureDomain(clientset, clusterInfo, m)
+		c.recordCreated(m)
+		addressed++
 	}
 
-	if len(running) == c.Size {
+	if addressed == c.size() {
 		logger.Infof("pods are already running")
-		return nil
+		return nil, c.saveEndpoints(clientset, c.Namespace, clusterInfo)
 	}
 
+	if err := c.createDataVolumeClaims(clientset, c.Namespace, clusterInfo, mons); err != nil {
+		return nil, fmt.Errorf("failed to create mon data volumes. %+v", err)
+	}
+
+	// the semaphore bounds the number of mons that are created and awaited at the same time
+	sem := make(chan struct{}, c.maxConcurrentPodOps())
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	var createErr error
 	started := 0
 	alreadyRunning := 0
-	for _, m := range mons {
-		monPod := c.makeMonPod(m, clusterInfo, antiAffinity)
-		logger.Debugf("Starting pod: %+v", monPod)
-		_, err := clientset.Pods(c.Namespace).Create(monPod)
-		if err != nil {
-			if !k8sutil.IsKubernetesResourceAlreadyExistError(err) {
-				return fmt.Errorf("failed to create mon pod %s. %+v", c.Namespace, err)
+	failed := []string{}
+	// without any running mons this is a new cluster. only the first mon of the pass bootstraps the monmap, also
+	// when it fails to start.
+	newCluster := len(clusterInfo.Monitors) == 0
+	for i, m := range mons {
+		sem <- struct{}{}
+		mutex.Lock()
+		if createErr != nil {
+			// the remaining mons are not created after a failure
+			mutex.Unlock()
+			<-sem
+			break
+		}
+		bootstrap := newCluster && i == 0
+		monPod := c.makeMonPod(m, clusterInfo, antiAffinity, bootstrap)
+		mutex.Unlock()
+
+		wg.Add(1)
+		go func(m *MonConfig, monPod *v1.Pod, bootstrap bool) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			logger.Debugf("Starting pod: %+v", monPod)
+			_, err := clientset.Core().Pods(c.Namespace).Create(monPod)
+			mutex.Lock()
+			if err != nil {
+				if !k8sutil.IsKubernetesResourceAlreadyExistError(err) {
+					createErr = createPodError(monPod.Name, err)
+					mutex.Unlock()
+					return
+				}
+				alreadyRunning++
+				logger.Infof("mon pod %s already exists", monPod.Name)
+			} else {
+				started++
+			}
+			mutex.Unlock()
+
+			running, err := c.waitForPodToStart(clientset, monPod)
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				if bootstrap {
+					// the other mons cannot form quorum without the monmap of the bootstrap mon
+					createErr = fmt.Errorf("bootstrap mon %s failed to start. %+v", m.Name, err)
+					return
+				}
+				logger.Warningf("failed to start pod %s. %+v", monPod.Name, err)
+				failed = append(failed, m.Name)
+				return
+			}
+			clusterInfo.Monitors[m.Name] = c.cephMon(c.Namespace, m.Name, c.monIP(running))
+			c.captureFailureDomain(clientset, clusterInfo, running)
+			c.recordCreated(running)
+
+			// persist the endpoints as each mon comes up so an operator restart resumes with the mons started so far
+			if err := c.saveEndpoints(clientset, c.Namespace, clusterInfo); err != nil {
+				logger.Warningf("failed to save mon endpoints after starting mon %s. %+v", m.Name, err)
 			}
-			alreadyRunning++
-			logger.Infof("mon pod %s already exists", monPod.Name)
-		} else {
-			started++
+		}(m, monPod, bootstrap)
+
+		// the other mons must not be created until they can join the monmap of the bootstrap mon
+		if bootstrap {
+			wg.Wait()
 		}
+	}
+	wg.Wait()
+	if createErr != nil {
+		return nil, createErr
+	}
+	sort.Strings(failed)
 
-		podIP, err := c.waitForPodToStart(clientset, monPod)
-		if err != nil {
-			return fmt.Errorf("failed to start pod %s. %+v", monPod.Name, err)
+	if err := c.saveEndpoints(clientset, c.Namespace, clusterInfo); err != nil {
+		return failed, err
+	}
+
+	logger.Infof("started %d/%d mons (%d already running)", (started + alreadyRunning), c.size(), alreadyRunning)
+	if len(failed) > 0 {
+		if len(clusterInfo.Monitors) < QuorumMajority(c.size()) {
+			return failed, fmt.Errorf("mons %v failed to start. %d/%d mons are running, not enough for quorum", failed, len(clusterInfo.Monitors), c.size())
 		}
-		clusterInfo.Monitors[m.Name] = mon.ToCephMon(m.Name, podIP)
+		logger.Warningf("mons %v failed to start. %d/%d mons are running, enough for quorum", failed, len(clusterInfo.Monitors), c.size())
 	}
+	return failed, nil
+}
 
-	logger.Infof("started %d/%d mons (%d already running)", (started + alreadyRunning), c.Size, alreadyRunning)
-	return nil
+func (c *Cluster) maxConcurrentPodOps() int {
+	if c.MaxConcurrentPodOps < 1 {
+		return 1
+	}
+	return c.MaxConcurrentPodOps
+}
+
+// MonCreationTimes returns the creation time of each running mon pod found or started by the last reconcile
+func (c *Cluster) MonCreationTimes() map[string]time.Time {
+	c.createdLock.Lock()
+	defer c.createdLock.Unlock()
+	result := map[string]time.Time{}
+	for name, t := range c.created {
+		result[name] = t
+	}
+	return result
+}
+
+func (c *Cluster) resetCreated() {
+	c.createdLock.Lock()
+	defer c.createdLock.Unlock()
+	c.created = map[string]time.Time{}
 }
 
-func (c *Cluster) waitForPodToStart(clientset *kubernetes.Clientset, pod *v1.Pod) (string, error) {
+func (c *Cluster) recordCreated(pod *v1.Pod) {
+	c.createdLock.Lock()
+	defer c.createdLock.Unlock()
+	if c.created == nil {
+		c.created = map[string]time.Time{}
+	}
+	c.created[pod.Name] = pod.CreationTimestamp.Time
+}
+
+// wait for the pod to be running and return the running pod
+func (c *Cluster) waitForPodToStart(clientset kubernetes.Interface, pod *v1.Pod) (*v1.Pod, error) {
+
+	waitLog := newWaitLog("pod "+pod.Name, c.waitLogInterval)
+	defer waitLog.summary()
 
 	// Poll the status of the pods to see if they are ready
 	// FIX: Get status instead of just waiting
-	for i := 0; i < 15; i++ {
+	for i := 0; i < c.PodStartRetries; i++ {
+		if c.deadlineExceeded() {
+			return nil, ErrReconcileDeadlineExceeded
+		}
 		// wait and try again
-		delay := 6
-		logger.Infof("waiting %ds for pod %s to start. status=%v", delay, pod.Name, pod.Status.Phase)
-		<-time.After(time.Duration(delay) * time.Second)
+		waitLog.log("waiting %v for pod %s to start. status=%v", c.PodStartDelay, pod.Name, pod.Status.Phase)
+		<-time.After(c.PodStartDelay)
 
-		pod, err := clientset.Core().Pods(c.Namespace).Get(pod.Name)
+		current, err := clientset.Core().Pods(pod.Namespace).Get(pod.Name)
 		if err != nil {
-			return "", fmt.Errorf("failed to get mon pod %s. %+v", pod.Name, err)
+			return nil, fmt.Errorf("failed to get mon pod %s. %+v", pod.Name, err)
+		}
+
+		if cond := affinityUnschedulable(current); cond != nil && c.UnschedulableTimeout > 0 &&
+			time.Since(cond.LastTransitionTime.Time) >= c.UnschedulableTimeout {
+			return nil, fmt.Errorf("mon pod %s cannot be scheduled because of its affinity: %s. add nodes for the mons or set antiAffinity to false in the mon resource",
+				pod.Name, cond.Message)
 		}
 
-		if pod.Status.Phase == v1.PodRunning {
+		if current.Status.Phase == v1.PodRunning {
+			if c.monIP(current) == "" {
+				// a blank endpoint would corrupt the monmap. the ip is assigned shortly after the pod is running.
+				waitLog.log("pod %s is running but has no ip yet", pod.Name)
+				continue
+			}
+			if monContainerDown(current) {
+				// a sidecar can keep the pod running while the mon is down
+				waitLog.log("pod %s is running but its mon container is not", pod.Name)
+				continue
+			}
 			logger.Infof("pod %s started", pod.Name)
-			return pod.Status.PodIP, nil
+			return current, nil
+		}
+	}
+
+	return nil, fmt.Errorf("timed out waiting for pod %s to start", pod.Name)
+}
+
+// wait for the pod to report the ready condition
+func (c *Cluster) waitForPodReady(clientset kubernetes.Interface, name string) error {
+	waitLog := newWaitLog("pod "+name, c.waitLogInterval)
+	defer waitLog.summary()
+
+	for i := 0; i < c.PodStartRetries; i++ {
+		if c.deadlineExceeded() {
+			return ErrReconcileDeadlineExceeded
+		}
+		pod, err := clientset.Core().Pods(c.Namespace).Get(name)
+		if err != nil {
+			return fmt.Errorf("failed to get mon pod %s. %+v", name, err)
+		}
+		if podReady(pod) {
+			logger.Infof("pod %s is ready", name)
+			return nil
 		}
+
+		waitLog.log("waiting %v for pod %s to be ready", c.PodStartDelay, name)
+		<-time.After(c.PodStartDelay)
 	}
 
-	return "", fmt.Errorf("timed out waiting for pod %s to start", pod.Name)
+	return fmt.Errorf("timed out waiting for pod %s to be ready", name)
+}
+
+func podReady(pod *v1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
 }
 
 // detect whether we have a big enough cluster to run services on different nodes.
 // the anti-affinity will prevent pods of the same type of running on the same node.
-func (c *Cluster) getAntiAffinity(clientset *kubernetes.Clientset) (bool, error) {
+func (c *Cluster) getAntiAffinity(clientset kubernetes.Interface) (bool, error) {
+	if !c.AntiAffinity {
+		return false, nil
+	}
+	if c.size() <= 1 {
+		// a single mon has no other mons to be spread from
+		return false, nil
+	}
+
+	if c.FailureDomainLabel != "" {
+		// the mons are required to be spread across the domains rather than placed together when there are too few
+		domains, err := availableDomains(clientset, c.FailureDomainLabel)
+		if err != nil {
+			return false, err
+		}
+		if domains < c.size() {
+			return false, fmt.Errorf("there are %d %s failure domains available for %d monitors", domains, c.FailureDomainLabel, c.size())
+		}
+		return true, nil
+	}
+
+	available, err := availableNodes(clientset)
+	if err != nil {
+		return false, err
+	}
+
+	logger.Infof("there are %d nodes available for %d monitors", available, c.size())
+	return available >= c.size(), nil
+}
+
+// the number of nodes where a mon can be scheduled
+func availableNodes(clientset kubernetes.Interface) (int, error) {
+	nodes, err := listAvailableNodes(clientset)
+	if err != nil {
+		return 0, err
+	}
+	return len(nodes), nil
+}
+
+// the number of distinct values of the failure domain label on the available nodes. nodes without the label are not counted.
+func availableDomains(clientset kubernetes.Interface, label string) (int, error) {
+	nodes, err := listAvailableNodes(clientset)
+	if err != nil {
+		return 0, err
+	}
+	domains := map[string]bool{}
+	for _, n := range nodes {
+		if domain, ok := n.Labels[label]; ok && domain != "" {
+			domains[domain] = true
+		}
+	}
+	return len(domains), nil
+}
+
+func listAvailableNodes(clientset kubernetes.Interface) ([]v1.Node, error) {
 	nodeOptions := api.ListOptions{}
 	nodeOptions.TypeMeta.Kind = "Node"
-	nodes, err := clientset.Nodes().List(nodeOptions)
+	nodes, err := clientset.Core().Nodes().List(nodeOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nodes in cluster. %+v", err)
+	}
+
+	available := []v1.Node{}
+	for _, n := range nodes.Items {
+		if nodeAvailable(n) {
+			available = append(available, n)
+		}
+	}
+	return available, nil
+}
+
+// grow the number of mons with the number of available nodes. the size is never reduced automatically so
+// that the mons do not flap when nodes come and go.
+func (c *Cluster) autoScale(clientset kubernetes.Interface) error {
+	available, err := availableNodes(clientset)
 	if err != nil {
-		return false, fmt.Errorf("failed to get nodes in cluster. %+v", err)
+		return err
+	}
+	max := c.MaxMons
+	if c.MaxMonCount > 0 && (max <= 0 || max > c.MaxMonCount) {
+		max = c.MaxMonCount
+	}
+	size := autoScaleSize(available, max)
+	if size > c.size() {
+		logger.Infof("growing the mons from %d to %d for %d available nodes", c.size(), size, available)
+		c.autoScaledSize = size
+	}
+	return nil
+}
+
+// the number of mons to run. dev mode runs a single mon whatever the size is. the auto scaled size is kept apart
+// from Size so that the configured size is not overwritten.
+func (c *Cluster) size() int {
+	if c.DevMode {
+		return 1
+	}
+	if c.AutoScaleMons && c.autoScaledSize > c.Size {
+		return c.autoScaledSize
+	}
+	return c.Size
+}
+
+// the port of the mons. 6790 unless Port is set.
+func (c *Cluster) port() int32 {
+	if c.Port == 0 {
+		return int32(mon.Port)
 	}
+	return c.Port
+}
+
+// the size must be at least one mon and at most MaxMonCount mons
+func (c *Cluster) validateSize(size int) error {
+	if size < 1 {
+		return fmt.Errorf("invalid mon count %d. at least one mon is required", size)
+	}
+	if c.MaxMonCount > 0 && size > c.MaxMonCount {
+		return fmt.Errorf("%d mons exceed the maximum of %d mons. quorum latency grows with the number of mons", size, c.MaxMonCount)
+	}
+	return nil
+}
+
+// the largest odd number of mons that fits on the nodes, up to the max
+func autoScaleSize(nodes, max int) int {
+	size := nodes
+	if max > 0 && size > max {
+		size = max
+	}
+	if size%2 == 0 {
+		size--
+	}
+	if size < 1 {
+		size = 1
+	}
+	return size
+}
 
-	logger.Infof("there are %d nodes available for %d monitors", len(nodes.Items), c.Size)
-	return len(nodes.Items) >= c.Size, nil
+// a node is available for a mon if it is ready and not cordoned
+func nodeAvailable(node v1.Node) bool {
+	if node.Spec.Unschedulable {
+		return false
+	}
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
 }
 
-func (c *Cluster) GetMonPodsRunning(clientset *kubernetes.Clientset, clusterName string) (int, int, error) {
-	running, pending, err := c.pollPods(clientset, clusterName)
+func (c *Cluster) GetMonPodsRunning(clientset kubernetes.Interface, clusterName string) (int, int, error) {
+	running, pending, err := c.pollPods(clientset, c.Namespace, clusterName)
 	if err != nil {
 		return 0, 0, fmt.Errorf("failed to get mon pods. %+v", err)
 	}
@@ -0,0 +1,822 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rook/rook/pkg/cephmgr/client/test"
+	"github.com/rook/rook/pkg/cephmgr/mon"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/1.5/kubernetes/fake"
+	"k8s.io/client-go/1.5/pkg/api"
+	"k8s.io/client-go/1.5/pkg/api/errors"
+	"k8s.io/client-go/1.5/pkg/api/resource"
+	"k8s.io/client-go/1.5/pkg/api/unversioned"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+	"k8s.io/client-go/1.5/pkg/runtime"
+	core "k8s.io/client-go/1.5/testing"
+)
+
+// the mon status when mon0, mon1, and mon2 are all in quorum
+const allInQuorumResponse = `{"quorum":[0,1,2],"monmap":{"mons":[` +
+	`{"name":"mon0","rank":0},{"name":"mon1","rank":1},{"name":"mon2","rank":2}]}}`
+
+func testMonSecret(namespace string) *v1.Secret {
+	return &v1.Secret{
+		ObjectMeta: v1.ObjectMeta{Name: appName, Namespace: namespace},
+		Data: map[string][]byte{
+			clusterSecretName: []byte("rookcluster"),
+			fsidSecretName:    []byte("22ae0d50-c4bc-4cfb-9cf4-341acbe35302"),
+			monSecretName:     []byte("monsecret"),
+			adminSecretName:   []byte("adminsecret"),
+		},
+		Type: k8sutil.RookType,
+	}
+}
+
+// the api server stores the string data of a secret in its data. the fake clientset does not.
+func convertSecretStringData(clientset *fake.Clientset) {
+	clientset.PrependReactor("create", "secrets", func(action core.Action) (bool, runtime.Object, error) {
+		secret := action.(core.CreateAction).GetObject().(*v1.Secret)
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		for k, v := range secret.StringData {
+			secret.Data[k] = []byte(v)
+		}
+		return false, nil, nil
+	})
+}
+
+func TestClusterInfoCache(t *testing.T) {
+	clientset := fake.NewSimpleClientset(testMonSecret("ns"))
+	c := New("ns", nil, "myversion")
+	c.CacheTTL = time.Minute
+
+	info, err := c.initClusterInfo(clientset)
+	assert.Nil(t, err)
+	assert.Equal(t, "rookcluster", info.Name)
+	assert.Equal(t, 1, len(clientset.Actions()))
+
+	// the second read within the ttl is served from the cache
+	info.Monitors["mon0"] = nil
+	info, err = c.initClusterInfo(clientset)
+	assert.Nil(t, err)
+	assert.Equal(t, "22ae0d50-c4bc-4cfb-9cf4-341acbe35302", info.FSID)
+	assert.Equal(t, 0, len(info.Monitors))
+	assert.Equal(t, 1, len(clientset.Actions()))
+
+	// the cache is not used when disabled
+	c.CacheTTL = 0
+	_, err = c.initClusterInfo(clientset)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(clientset.Actions()))
+}
+
+func testMonPod(name, namespace, podIP string, phase v1.PodPhase) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: v1.ObjectMeta{Name: name, Namespace: namespace, Labels: getLabels("rookcluster")},
+		Status:     v1.PodStatus{Phase: phase, PodIP: podIP},
+	}
+}
+
+func TestEnsureMonsRequeue(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		testMonSecret("ns"),
+		testMonPod("mon0", "ns", "1.2.3.4", v1.PodRunning),
+		testMonPod("mon1", "ns", "1.2.3.5", v1.PodRunning),
+		testMonPod("mon2", "ns", "1.2.3.6", v1.PodRunning))
+
+	// only mon0 is in quorum
+	c, _ := newTestHealthCluster(map[string]string{"mon_status": test.SuccessfulMonStatusResponse})
+	info, requeue, err := c.EnsureMons(clientset)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(info.Monitors))
+	assert.Equal(t, quorumRequeueDelay, requeue)
+
+	// all mons are in quorum
+	c, _ = newTestHealthCluster(map[string]string{"mon_status": allInQuorumResponse})
+	info, requeue, err = c.EnsureMons(clientset)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(info.Monitors))
+	assert.Equal(t, time.Duration(0), requeue)
+}
+
+func TestEnsureMonsValidateFirst(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	c, _ := newTestHealthCluster(map[string]string{"mon_status": allInQuorumResponse})
+	c.PublicNetwork = "10.0.0.0"
+
+	// a bad spec is rejected before the keys of a new cluster are generated and saved
+	_, _, err := c.EnsureMons(clientset)
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, len(clientset.Actions()))
+
+	// the ceph in the image cannot parse the addresses of the v2 port
+	c.PublicNetwork = ""
+	c.V2Port = 3300
+	_, _, err = c.EnsureMons(clientset)
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "v2 port 3300 is not supported"))
+	assert.Equal(t, 0, len(clientset.Actions()))
+}
+
+func TestStartPodsPartialFailure(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		testMonPod("mon0", "ns", "1.2.3.4", v1.PodRunning),
+		testMonPod("mon1", "ns", "1.2.3.5", v1.PodRunning))
+	c := New("ns", nil, "myversion")
+	c.PodStartRetries = 2
+	c.PodStartDelay = time.Millisecond
+	mons := []*MonConfig{{Name: "mon0", Port: 6790}, {Name: "mon1", Port: 6790}, {Name: "mon2", Port: 6790}}
+
+	// mon2 never starts, but two of three mons are enough for quorum
+	info := testClusterInfo()
+	failed, err := c.startPods(clientset, info, mons)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"mon2"}, failed)
+	assert.Equal(t, 2, len(info.Monitors))
+
+	// a single running mon out of three is not enough
+	clientset = fake.NewSimpleClientset(testMonPod("mon0", "ns", "1.2.3.4", v1.PodRunning))
+	failed, err = c.startPods(clientset, testClusterInfo(), mons)
+	assert.NotNil(t, err)
+	assert.Equal(t, []string{"mon1", "mon2"}, failed)
+}
+
+func TestStartPodsStopAfterCreateFailure(t *testing.T) {
+	clientset := fake.NewSimpleClientset(testMonPod("mon0", "ns", "1.2.3.4", v1.PodRunning))
+	clientset.PrependReactor("create", "pods", func(action core.Action) (bool, runtime.Object, error) {
+		if action.(core.CreateAction).GetObject().(*v1.Pod).Name == "mon1" {
+			return true, nil, fmt.Errorf("quota exceeded")
+		}
+		return false, nil, nil
+	})
+	c := New("ns", nil, "myversion")
+	c.PodStartDelay = time.Millisecond
+	mons := []*MonConfig{{Name: "mon0", Port: 6790}, {Name: "mon1", Port: 6790}, {Name: "mon2", Port: 6790}}
+
+	// mon2 is not created after the create of mon1 failed
+	_, err := c.startPods(clientset, testClusterInfo(), mons)
+	assert.NotNil(t, err)
+	_, err = clientset.Core().Pods("ns").Get("mon2")
+	assert.True(t, errors.IsNotFound(err))
+}
+
+func TestStartPodsBootstrapFailure(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	c := New("ns", nil, "myversion")
+	c.PodStartRetries = 2
+	c.PodStartDelay = time.Millisecond
+	mons := []*MonConfig{{Name: "mon0", Port: 6790}, {Name: "mon1", Port: 6790}, {Name: "mon2", Port: 6790}}
+
+	// the bootstrap mon is not tolerated to fail. no other mon is created without its monmap.
+	_, err := c.startPods(clientset, testClusterInfo(), mons)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "bootstrap mon mon0")
+	_, err = clientset.Core().Pods("ns").Get("mon1")
+	assert.True(t, errors.IsNotFound(err))
+}
+
+func TestStartPodsAdmissionRejection(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "pods", func(action core.Action) (bool, runtime.Object, error) {
+		return true, nil, &errors.StatusError{ErrStatus: unversioned.Status{
+			Status:  unversioned.StatusFailure,
+			Code:    http.StatusForbidden,
+			Reason:  unversioned.StatusReasonForbidden,
+			Message: `admission webhook "validation.gatekeeper.sh" denied the request: [mon-must-have-limits] container mon has no memory limit`,
+		}}
+	})
+	c := New("ns", nil, "myversion")
+	c.PodStartDelay = time.Millisecond
+
+	_, err := c.startPods(clientset, testClusterInfo(), []*MonConfig{{Name: "mon0", Port: 6790}})
+	assert.NotNil(t, err)
+	assert.Equal(t, "mon pod mon0 was rejected by admission webhook validation.gatekeeper.sh: [mon-must-have-limits] container mon has no memory limit. "+
+		"change the mon settings or the policy so the pod is allowed", err.Error())
+
+	// other errors are not mistaken for a rejection
+	clientset = fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "pods", func(action core.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("connection refused")
+	})
+	_, err = c.startPods(clientset, testClusterInfo(), []*MonConfig{{Name: "mon0", Port: 6790}})
+	assert.Equal(t, "failed to create mon pod mon0. connection refused", err.Error())
+}
+
+func TestStartPodsConcurrencyLimit(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	startCreatedPods(clientset)
+
+	// a pod operation is in flight from the time the pod is created until it is found running
+	var inFlight, maxInFlight int32
+	clientset.PrependReactor("create", "pods", func(action core.Action) (bool, runtime.Object, error) {
+		if n := atomic.AddInt32(&inFlight, 1); n > atomic.LoadInt32(&maxInFlight) {
+			atomic.StoreInt32(&maxInFlight, n)
+		}
+		return false, nil, nil
+	})
+	clientset.PrependReactor("get", "pods", func(action core.Action) (bool, runtime.Object, error) {
+		atomic.AddInt32(&inFlight, -1)
+		return false, nil, nil
+	})
+
+	c := New("ns", nil, "myversion")
+	c.Size = 5
+	c.MaxConcurrentPodOps = 2
+	c.PodStartDelay = 10 * time.Millisecond
+	mons := []*MonConfig{}
+	for _, name := range []string{"mon0", "mon1", "mon2", "mon3", "mon4"} {
+		mons = append(mons, &MonConfig{Name: name, Port: 6790})
+	}
+
+	info := testClusterInfo()
+	failed, err := c.startPods(clientset, info, mons)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(failed))
+	assert.Equal(t, 5, len(info.Monitors))
+	assert.Equal(t, int32(2), maxInFlight)
+}
+
+func testNode(name string, ready v1.ConditionStatus, unschedulable bool) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: v1.ObjectMeta{Name: name},
+		Spec:       v1.NodeSpec{Unschedulable: unschedulable},
+		Status:     v1.NodeStatus{Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: ready}}},
+	}
+}
+
+func TestAntiAffinityReadyNodes(t *testing.T) {
+	c := New("ns", nil, "myversion")
+
+	// only two of the nodes can run a mon
+	clientset := fake.NewSimpleClientset(
+		testNode("node0", v1.ConditionTrue, false),
+		testNode("node1", v1.ConditionTrue, false),
+		testNode("node2", v1.ConditionFalse, false),
+		testNode("node3", v1.ConditionUnknown, false),
+		testNode("node4", v1.ConditionTrue, true))
+	antiAffinity, err := c.getAntiAffinity(clientset)
+	assert.Nil(t, err)
+	assert.False(t, antiAffinity)
+
+	clientset = fake.NewSimpleClientset(
+		testNode("node0", v1.ConditionTrue, false),
+		testNode("node1", v1.ConditionTrue, false),
+		testNode("node2", v1.ConditionTrue, false),
+		testNode("node3", v1.ConditionFalse, false))
+	antiAffinity, err = c.getAntiAffinity(clientset)
+	assert.Nil(t, err)
+	assert.True(t, antiAffinity)
+}
+
+func TestAntiAffinityFailureDomains(t *testing.T) {
+	zone := "failure-domain.beta.kubernetes.io/zone"
+	c := New("ns", nil, "myversion")
+	c.FailureDomainLabel = zone
+
+	// four nodes in two zones are not enough for three mons
+	nodes := []runtime.Object{}
+	for i, z := range []string{"a", "a", "b", "b", ""} {
+		node := testNode(fmt.Sprintf("node%d", i), v1.ConditionTrue, false)
+		node.Labels = map[string]string{zone: z}
+		nodes = append(nodes, node)
+	}
+	clientset := fake.NewSimpleClientset(nodes...)
+	antiAffinity, err := c.getAntiAffinity(clientset)
+	assert.NotNil(t, err)
+	assert.False(t, antiAffinity)
+
+	node := testNode("node5", v1.ConditionTrue, false)
+	node.Labels = map[string]string{zone: "c"}
+	_, err = clientset.Core().Nodes().Create(node)
+	assert.Nil(t, err)
+	antiAffinity, err = c.getAntiAffinity(clientset)
+	assert.Nil(t, err)
+	assert.True(t, antiAffinity)
+}
+
+func TestStartPodsForeignFSID(t *testing.T) {
+	// mon1 was left behind by a previous cluster in the namespace
+	foreign := testMonPod("mon1", "ns", "1.2.3.5", v1.PodRunning)
+	foreign.Annotations = map[string]string{fsidAnnotation: "previous-fsid"}
+	current := testMonPod("mon0", "ns", "1.2.3.4", v1.PodRunning)
+	current.Annotations = map[string]string{fsidAnnotation: testClusterInfo().FSID}
+	clientset := fake.NewSimpleClientset(current, foreign, testMonPod("mon2", "ns", "1.2.3.6", v1.PodRunning))
+	startCreatedPods(clientset)
+
+	c := New("ns", nil, "myversion")
+	c.PodStartDelay = time.Millisecond
+	mons := []*MonConfig{{Name: "mon0", Port: 6790}, {Name: "mon1", Port: 6790}, {Name: "mon2", Port: 6790}}
+
+	info := testClusterInfo()
+	failed, err := c.startPods(clientset, info, mons)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(failed))
+
+	// the foreign mon was replaced by a mon of the current cluster
+	assert.Equal(t, "10.0.0.1:6790", info.Monitors["mon1"].Endpoint)
+	pod, err := clientset.Core().Pods("ns").Get("mon1")
+	assert.Nil(t, err)
+	assert.Equal(t, info.FSID, pod.Annotations[fsidAnnotation])
+	assert.Equal(t, "1.2.3.4:6790", info.Monitors["mon0"].Endpoint)
+}
+
+func TestStartWaitForQuorum(t *testing.T) {
+	newClientset := func() *fake.Clientset {
+		return fake.NewSimpleClientset(
+			testMonSecret("ns"),
+			testMonPod("mon0", "ns", "1.2.3.4", v1.PodRunning),
+			testMonPod("mon1", "ns", "1.2.3.5", v1.PodRunning),
+			testMonPod("mon2", "ns", "1.2.3.6", v1.PodRunning))
+	}
+
+	// the mons form quorum on the fourth mon_status. the first two are the quorum check and
+	// the check for stuck mons in EnsureMons.
+	statusCalls := 0
+	conn := &test.MockConnection{
+		MockMonCommand: func(args []byte) ([]byte, string, error) {
+			statusCalls++
+			if statusCalls < 4 {
+				return []byte(test.SuccessfulMonStatusResponse), "", nil
+			}
+			return []byte(allInQuorumResponse), "", nil
+		},
+	}
+	c := New("ns", &test.MockConnectionFactory{Conn: conn}, "myversion")
+	c.configDir = "/tmp"
+	c.PodStartDelay = time.Millisecond
+	c.getResource = noMonResource
+
+	info, err := c.Start(newClientset())
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(info.Monitors))
+	assert.Equal(t, 4, statusCalls)
+
+	// without the gate Start returns before quorum
+	statusCalls = 0
+	c.WaitForQuorumOnStart = false
+	info, err = c.Start(newClientset())
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(info.Monitors))
+	assert.Equal(t, 2, statusCalls)
+}
+
+func TestCreateMonSecretsAlreadyExist(t *testing.T) {
+	// another reconcile creates the secrets after this reconcile found them missing
+	clientset := fake.NewSimpleClientset(testMonSecret("ns"))
+	gets := 0
+	clientset.PrependReactor("get", "secrets", func(action core.Action) (bool, runtime.Object, error) {
+		gets++
+		if gets == 1 {
+			return true, nil, errors.NewNotFound(unversioned.GroupResource{Resource: "secrets"}, appName)
+		}
+		return false, nil, nil
+	})
+	c := New("ns", &test.MockConnectionFactory{Fsid: "myfsid", SecretKey: "mysecret"}, "myversion")
+
+	info, err := c.initClusterInfo(clientset)
+	assert.Nil(t, err)
+	assert.Equal(t, "22ae0d50-c4bc-4cfb-9cf4-341acbe35302", info.FSID)
+	assert.Equal(t, "monsecret", info.MonitorSecret)
+	assert.Equal(t, 2, gets)
+}
+
+func TestNewClusterWithExistingMons(t *testing.T) {
+	// the secret is missing but the mons of a cluster are still running
+	clientset := fake.NewSimpleClientset(testMonPod("mon0", "ns", "1.2.3.4", v1.PodRunning))
+	c := New("ns", &test.MockConnectionFactory{Fsid: "myfsid", SecretKey: "mysecret"}, "myversion")
+
+	info, err := c.initClusterInfo(clientset)
+	assert.NotNil(t, err)
+	assert.Nil(t, info)
+	_, err = clientset.Core().Secrets("ns").Get(appName)
+	assert.True(t, errors.IsNotFound(err))
+
+	// a new cluster is created once the old mons are gone
+	err = clientset.Core().Pods("ns").Delete("mon0", nil)
+	assert.Nil(t, err)
+	info, err = c.initClusterInfo(clientset)
+	assert.Nil(t, err)
+	assert.NotNil(t, info)
+}
+
+func TestCustomSecretName(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	c := New("ns", &test.MockConnectionFactory{Fsid: "myfsid", SecretKey: "mysecret"}, "myversion")
+	c.SecretName = "my-mon-keys"
+
+	// the secrets of a new cluster are written with the custom name
+	info, err := c.initClusterInfo(clientset)
+	assert.Nil(t, err)
+	assert.Equal(t, "myfsid", info.FSID)
+	secret, err := clientset.Core().Secrets("ns").Get("my-mon-keys")
+	assert.Nil(t, err)
+	assert.Equal(t, "myfsid", secret.StringData[fsidSecretName])
+	_, err = clientset.Core().Secrets("ns").Get(appName)
+	assert.NotNil(t, err)
+
+	// existing secrets are read with the custom name
+	clientset = fake.NewSimpleClientset(testMonSecret("ns"))
+	_, err = c.initClusterInfo(clientset)
+	assert.Nil(t, err)
+	assert.Equal(t, "my-mon-keys", clientset.Actions()[0].(core.GetAction).GetName())
+
+	// the mon pods read their keys from the custom secret
+	pod := c.makeMonPod(&MonConfig{Name: "mon0", Port: 6790}, testClusterInfo(), true, false)
+	assert.Equal(t, "my-mon-keys", pod.Spec.Containers[0].Env[1].ValueFrom.SecretKeyRef.Name)
+	assert.Equal(t, "my-mon-keys", pod.Spec.Containers[0].Env[2].ValueFrom.SecretKeyRef.Name)
+
+	// and so do the pods of the other daemons
+	assert.Equal(t, "my-mon-keys", c.MonSecret().MonSecretEnvVar().ValueFrom.SecretKeyRef.Name)
+	assert.Equal(t, "my-mon-keys", c.MonSecret().AdminSecretEnvVar().ValueFrom.SecretKeyRef.Name)
+	assert.Equal(t, appName, DefaultMonSecret().MonSecretEnvVar().ValueFrom.SecretKeyRef.Name)
+}
+
+func TestNilFactory(t *testing.T) {
+	c := New("ns", nil, "myversion")
+	c.getResource = noMonResource
+
+	_, err := c.Start(fake.NewSimpleClientset(testMonSecret("ns")))
+	assert.Equal(t, errNilFactory, err)
+	_, err = c.CheckClockSkew(testClusterInfo())
+	assert.Equal(t, errNilFactory, err)
+}
+
+func TestStartWaitForReady(t *testing.T) {
+	c, _ := newTestHealthCluster(map[string]string{"mon_status": allInQuorumResponse})
+	c.Size = 1
+	c.WaitForReady = true
+	c.PodStartRetries = 2
+	c.PodStartDelay = time.Millisecond
+	c.getResource = noMonResource
+
+	// the pod is running but not ready
+	pod := testMonPod("mon0", "ns", "1.2.3.4", v1.PodRunning)
+	pod.Status.Conditions = []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionFalse}}
+	_, err := c.Start(fake.NewSimpleClientset(testMonSecret("ns"), pod))
+	assert.NotNil(t, err)
+
+	pod.Status.Conditions[0].Status = v1.ConditionTrue
+	info, err := c.Start(fake.NewSimpleClientset(testMonSecret("ns"), pod))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(info.Monitors))
+
+	// only running is required without the option
+	c.WaitForReady = false
+	pod.Status.Conditions[0].Status = v1.ConditionFalse
+	_, err = c.Start(fake.NewSimpleClientset(testMonSecret("ns"), pod))
+	assert.Nil(t, err)
+}
+
+func TestMonCreationTimes(t *testing.T) {
+	older := testMonPod("mon0", "ns", "1.2.3.4", v1.PodRunning)
+	older.CreationTimestamp = unversioned.NewTime(time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC))
+	newer := testMonPod("mon1", "ns", "1.2.3.5", v1.PodRunning)
+	newer.CreationTimestamp = unversioned.NewTime(time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC))
+	clientset := fake.NewSimpleClientset(older, newer)
+
+	c := New("ns", nil, "myversion")
+	c.Size = 2
+	mons := []*MonConfig{{Name: "mon0", Port: 6790}, {Name: "mon1", Port: 6790}}
+	_, err := c.startPods(clientset, testClusterInfo(), mons)
+	assert.Nil(t, err)
+
+	created := c.MonCreationTimes()
+	assert.Equal(t, 2, len(created))
+	assert.Equal(t, older.CreationTimestamp.Time, created["mon0"])
+	assert.True(t, created["mon0"].Before(created["mon1"]))
+}
+
+func TestSecretKeyMap(t *testing.T) {
+	// a secret created by other tooling with its own key names
+	secret := &v1.Secret{
+		ObjectMeta: v1.ObjectMeta{Name: appName, Namespace: "ns"},
+		Data: map[string][]byte{
+			"cluster":   []byte("othercluster"),
+			"uuid":      []byte("22ae0d50-c4bc-4cfb-9cf4-341acbe35302"),
+			"mon.key":   []byte("othermonsecret"),
+			"admin.key": []byte("otheradminsecret"),
+		},
+	}
+	c := New("ns", nil, "myversion")
+	c.SecretKeyMap = map[string]string{
+		clusterSecretName: "cluster",
+		fsidSecretName:    "uuid",
+		monSecretName:     "mon.key",
+		adminSecretName:   "admin.key",
+	}
+
+	info, err := c.initClusterInfo(fake.NewSimpleClientset(secret))
+	assert.Nil(t, err)
+	assert.Equal(t, "othercluster", info.Name)
+	assert.Equal(t, "22ae0d50-c4bc-4cfb-9cf4-341acbe35302", info.FSID)
+	assert.Equal(t, "othermonsecret", info.MonitorSecret)
+	assert.Equal(t, "otheradminsecret", info.AdminSecret)
+
+	// new secrets are written with the mapped keys
+	clientset := fake.NewSimpleClientset()
+	c.factory = &test.MockConnectionFactory{Fsid: "myfsid", SecretKey: "mysecret"}
+	_, err = c.initClusterInfo(clientset)
+	assert.Nil(t, err)
+	created, err := clientset.Core().Secrets("ns").Get(appName)
+	assert.Nil(t, err)
+	assert.Equal(t, "myfsid", created.StringData["uuid"])
+	assert.Equal(t, "", created.StringData[fsidSecretName])
+
+	// the mon pods read the mapped keys
+	pod := c.makeMonPod(&MonConfig{Name: "mon0", Port: 6790}, info, true, false)
+	assert.Equal(t, "mon.key", pod.Spec.Containers[0].Env[1].ValueFrom.SecretKeyRef.Key)
+	assert.Equal(t, "admin.key", pod.Spec.Containers[0].Env[2].ValueFrom.SecretKeyRef.Key)
+
+	// and so do the pods of the other daemons
+	assert.Equal(t, MonSecret{Name: appName, MonKey: "mon.key", AdminKey: "admin.key"}, c.MonSecret())
+	assert.Equal(t, "mon.key", c.MonSecret().MonSecretEnvVar().ValueFrom.SecretKeyRef.Key)
+	assert.Equal(t, "admin.key", c.MonSecret().AdminSecretEnvVar().ValueFrom.SecretKeyRef.Key)
+}
+
+func TestValidateClusterInfo(t *testing.T) {
+	assert.Nil(t, validateClusterInfo(testClusterInfo()))
+
+	tests := []struct {
+		name   string
+		modify func(info *mon.ClusterInfo)
+		errMsg string
+	}{
+		{"name", func(info *mon.ClusterInfo) { info.Name = "" }, "missing cluster name"},
+		{"fsid", func(info *mon.ClusterInfo) { info.FSID = "" }, "missing fsid"},
+		{"invalid fsid", func(info *mon.ClusterInfo) { info.FSID = "not-a-uuid" }, "fsid not-a-uuid is not a valid uuid"},
+		{"mon secret", func(info *mon.ClusterInfo) { info.MonitorSecret = "" }, "missing mon secret"},
+		{"admin secret", func(info *mon.ClusterInfo) { info.AdminSecret = "" }, "missing admin secret"},
+	}
+	for _, tt := range tests {
+		info := testClusterInfo()
+		tt.modify(info)
+		err := validateClusterInfo(info)
+		if assert.NotNil(t, err, tt.name) {
+			assert.Equal(t, tt.errMsg, err.Error(), tt.name)
+		}
+	}
+
+	// a secret with a blank key is rejected when it is loaded
+	secret := testMonSecret("ns")
+	secret.Data[adminSecretName] = []byte{}
+	c := New("ns", nil, "myversion")
+	_, err := c.initClusterInfo(fake.NewSimpleClientset(secret))
+	assert.NotNil(t, err)
+}
+
+func TestDevModeSingleMon(t *testing.T) {
+	clientset := fake.NewSimpleClientset(testMonSecret("ns"), testNode("node0", v1.ConditionTrue, false))
+	startCreatedPods(clientset)
+	c, _ := newTestHealthCluster(map[string]string{"mon_status": test.SuccessfulMonStatusResponse})
+	c.PodStartDelay = time.Millisecond
+	c.DevMode = true
+
+	info, requeue, err := c.EnsureMons(clientset)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(0), requeue)
+	// the configured size is kept
+	assert.Equal(t, 3, c.Size)
+	assert.Equal(t, 1, c.size())
+	assert.Equal(t, 1, len(info.Monitors))
+	pods, err := clientset.Core().Pods("ns").List(api.ListOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pods.Items))
+	assert.Equal(t, "", pods.Items[0].Annotations[api.AffinityAnnotationKey])
+
+	pdb, err := clientset.Policy().PodDisruptionBudgets("ns").Get(pdbName)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, pdb.Spec.MinAvailable.IntValue())
+
+	// a config change is applied to the single mon even though quorum is lost while it restarts
+	c.ConfigOverrides = map[string]string{"debug_mon": "10"}
+	clientset.ClearActions()
+	_, _, err = c.EnsureMons(clientset)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"delete mon0", "create mon0"}, podRestarts(clientset))
+}
+
+func TestSecretBackupFunc(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	c := New("ns", &test.MockConnectionFactory{Fsid: "myfsid", SecretKey: "mysecret"}, "myversion")
+	var backedUp *mon.ClusterInfo
+	c.SecretBackupFunc = func(info *mon.ClusterInfo) error {
+		backedUp = info
+		return nil
+	}
+
+	info, err := c.initClusterInfo(clientset)
+	assert.Nil(t, err)
+	if assert.NotNil(t, backedUp) {
+		assert.Equal(t, "myfsid", backedUp.FSID)
+		assert.Equal(t, info.AdminSecret, backedUp.AdminSecret)
+		assert.Equal(t, info.MonitorSecret, backedUp.MonitorSecret)
+	}
+
+	// existing secrets are not backed up again
+	backedUp = nil
+	_, err = c.initClusterInfo(fake.NewSimpleClientset(testMonSecret("ns")))
+	assert.Nil(t, err)
+	assert.Nil(t, backedUp)
+
+	// a failed backup aborts the creation before the secrets are saved
+	clientset = fake.NewSimpleClientset()
+	c.SecretBackupFunc = func(info *mon.ClusterInfo) error { return fmt.Errorf("mock backup failure") }
+	_, err = c.initClusterInfo(clientset)
+	assert.NotNil(t, err)
+	_, err = clientset.Core().Secrets("ns").Get(appName)
+	assert.True(t, k8sutil.IsKubernetesResourceNotFoundError(err))
+
+	// unless backup errors are ignored
+	c.IgnoreSecretBackupErrors = true
+	_, err = c.initClusterInfo(clientset)
+	assert.Nil(t, err)
+	_, err = clientset.Core().Secrets("ns").Get(appName)
+	assert.Nil(t, err)
+}
+
+func TestAutoScaleMons(t *testing.T) {
+	tests := []struct {
+		nodes    int
+		max      int
+		expected int
+	}{
+		{0, 5, 1},
+		{1, 5, 1},
+		{2, 5, 1},
+		{3, 5, 3},
+		{4, 5, 3},
+		{5, 5, 5},
+		{10, 5, 5},
+		{10, 6, 5},
+		{10, 7, 7},
+		{9, 0, 9},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, autoScaleSize(tt.nodes, tt.max), "nodes=%d max=%d", tt.nodes, tt.max)
+	}
+
+	// the size grows with the nodes but does not shrink when nodes are lost
+	nodes := []runtime.Object{}
+	for i := 0; i < 5; i++ {
+		nodes = append(nodes, testNode(fmt.Sprintf("node%d", i), v1.ConditionTrue, false))
+	}
+	clientset := fake.NewSimpleClientset(nodes...)
+	c := New("ns", nil, "myversion")
+	c.AutoScaleMons = true
+	assert.Nil(t, c.autoScale(clientset))
+	assert.Equal(t, 5, c.size())
+	assert.Equal(t, 3, c.Size)
+
+	assert.Nil(t, clientset.Core().Nodes().Delete("node4", &api.DeleteOptions{}))
+	assert.Nil(t, clientset.Core().Nodes().Delete("node3", &api.DeleteOptions{}))
+	assert.Nil(t, c.autoScale(clientset))
+	assert.Equal(t, 5, c.size())
+	assert.Equal(t, 3, c.Size)
+}
+
+func TestWaitForPodIP(t *testing.T) {
+	clientset := fake.NewSimpleClientset(testMonPod("mon0", "ns", "", v1.PodRunning))
+	// the ip is assigned on the third poll
+	var gets int32
+	clientset.PrependReactor("get", "pods", func(action core.Action) (bool, runtime.Object, error) {
+		if atomic.AddInt32(&gets, 1) < 3 {
+			return false, nil, nil
+		}
+		return true, testMonPod("mon0", "ns", "1.2.3.4", v1.PodRunning), nil
+	})
+	c := New("ns", nil, "myversion")
+	c.PodStartDelay = time.Millisecond
+
+	pod, err := c.waitForPodToStart(clientset, testMonPod("mon0", "ns", "", v1.PodPending))
+	assert.Nil(t, err)
+	assert.Equal(t, "1.2.3.4", pod.Status.PodIP)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&gets))
+
+	// a mon without an ip is not recorded with a blank endpoint
+	info := testClusterInfo()
+	c.PodStartRetries = 1
+	clientset = fake.NewSimpleClientset(testMonPod("mon0", "ns", "", v1.PodRunning))
+	_, err = c.startPods(clientset, info, []*MonConfig{{Name: "mon0", Port: 6790}})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "bootstrap mon mon0")
+	assert.Equal(t, 0, len(info.Monitors))
+}
+
+func TestWaitForMonContainer(t *testing.T) {
+	// the exporter sidecar is running while the mon container waits to restart
+	pod := testMonPod("mon0", "ns", "1.2.3.4", v1.PodRunning)
+	pod.Status.ContainerStatuses = []v1.ContainerStatus{
+		{Name: metricsContainerName, State: v1.ContainerState{Running: &v1.ContainerStateRunning{}}},
+		{Name: MonContainerName, State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}},
+	}
+	status := monContainerStatus(pod)
+	assert.Equal(t, MonContainerName, status.Name)
+	assert.Equal(t, "CrashLoopBackOff", status.State.Waiting.Reason)
+	assert.True(t, monContainerDown(pod))
+
+	c := New("ns", nil, "myversion")
+	c.PodStartRetries = 2
+	c.PodStartDelay = time.Millisecond
+	clientset := fake.NewSimpleClientset(pod)
+	_, err := c.waitForPodToStart(clientset, pod)
+	assert.NotNil(t, err)
+
+	// the pod is started once the mon container runs
+	pod.Status.ContainerStatuses[1].State = v1.ContainerState{Running: &v1.ContainerStateRunning{}}
+	assert.False(t, monContainerDown(pod))
+	clientset = fake.NewSimpleClientset(pod)
+	_, err = c.waitForPodToStart(clientset, pod)
+	assert.Nil(t, err)
+}
+
+func TestWaitForUnschedulablePod(t *testing.T) {
+	pod := testMonPod("mon2", "ns", "", v1.PodPending)
+	pod.Status.Conditions = []v1.PodCondition{{
+		Type:               v1.PodScheduled,
+		Status:             v1.ConditionFalse,
+		Reason:             podReasonUnschedulable,
+		Message:            "0/2 nodes are available: 2 node(s) didn't match pod anti-affinity rules.",
+		LastTransitionTime: unversioned.NewTime(time.Now()),
+	}}
+	c := New("ns", nil, "myversion")
+	c.PodStartRetries = 1000
+	c.PodStartDelay = time.Millisecond
+	c.UnschedulableTimeout = 20 * time.Millisecond
+
+	// the wait stops soon after the pod is unschedulable for the timeout instead of after all the retries
+	start := time.Now()
+	_, err := c.waitForPodToStart(fake.NewSimpleClientset(pod), pod)
+	if assert.NotNil(t, err) {
+		assert.True(t, strings.Contains(err.Error(), "didn't match pod anti-affinity rules"))
+		assert.True(t, strings.Contains(err.Error(), "add nodes"))
+	}
+	assert.True(t, time.Since(start) < 500*time.Millisecond)
+
+	// other reasons do not stop the wait early
+	pod.Status.Conditions[0].Message = "0/2 nodes are available: 2 Insufficient cpu."
+	c.PodStartRetries = 30
+	_, err = c.waitForPodToStart(fake.NewSimpleClientset(pod), pod)
+	if assert.NotNil(t, err) {
+		assert.True(t, strings.Contains(err.Error(), "timed out"))
+	}
+}
+
+func TestEnsureMonsLockTimeout(t *testing.T) {
+	clientset := fake.NewSimpleClientset(testMonSecret("ns"))
+	c, _ := newTestHealthCluster(map[string]string{"mon_status": allInQuorumResponse})
+	c.LockTimeout = 10 * time.Millisecond
+
+	// another reconcile holds the lock
+	assert.Nil(t, c.lock())
+	start := time.Now()
+	_, _, err := c.EnsureMons(clientset)
+	assert.Equal(t, ErrLockTimeout, err)
+	assert.True(t, time.Since(start) < time.Second)
+	assert.Equal(t, 0, len(clientset.Actions()))
+
+	// the lock can be taken again once it is released
+	c.unlock()
+	assert.Nil(t, c.lock())
+	c.unlock()
+}
+
+func TestMutatorsLockTimeout(t *testing.T) {
+	clientset := fake.NewSimpleClientset(testMonSecret("ns"))
+	c, _ := newTestHealthCluster(map[string]string{"mon_status": allInQuorumResponse})
+	c.LockTimeout = 10 * time.Millisecond
+	info := testClusterInfo()
+
+	// the operations that change the mons wait for the operation that holds the lock
+	assert.Nil(t, c.lock())
+	assert.Equal(t, ErrLockTimeout, c.RemoveMon(clientset, info, "mon0"))
+	assert.Equal(t, ErrLockTimeout, c.GracefulRemoveMon(clientset, info, "mon0"))
+	assert.Equal(t, ErrLockTimeout, c.RefreshMonEndpoints(clientset, info))
+	assert.Equal(t, ErrLockTimeout, c.ExpandMonVolume(clientset, "mon0", resource.MustParse("20Gi")))
+	assert.Equal(t, ErrLockTimeout, c.CompactMonStore(info, ""))
+	assert.Equal(t, ErrLockTimeout, c.Resize(clientset, 5))
+	assert.Equal(t, 0, len(clientset.Actions()))
+	c.unlock()
+}
@@ -0,0 +1,265 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/rook/rook/pkg/cephmgr/client"
+	"github.com/rook/rook/pkg/cephmgr/mon"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/client-go/1.5/kubernetes"
+	"k8s.io/client-go/1.5/pkg/api"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+)
+
+const (
+	monMapBackupName = "mon-map-backup"
+	monMapBackupKey  = "monmap"
+)
+
+// the response from the mon dump command
+type monMap struct {
+	Epoch int                  `json:"epoch"`
+	FSID  string               `json:"fsid"`
+	Mons  []client.MonMapEntry `json:"mons"`
+}
+
+func (c *Cluster) getMonMap(conn client.Connection) ([]byte, *monMap, error) {
+	cmd := map[string]interface{}{"prefix": "mon dump"}
+	buf, err := client.ExecuteMonCommand(conn, cmd, "mon dump")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get the monmap. %+v", err)
+	}
+
+	var m monMap
+	if err := json.Unmarshal(buf, &m); err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal the monmap. %+v. raw response: %s", err, string(buf))
+	}
+	return buf, &m, nil
+}
+
+// ExportMonMap returns the current monmap of the cluster. A copy is saved in a config map
+// so the mon membership can be restored after the loss of mons.
+func (c *Cluster) ExportMonMap(clientset kubernetes.Interface, clusterInfo *mon.ClusterInfo) ([]byte, error) {
+	conn, err := c.connect(clusterInfo)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Shutdown()
+
+	data, m, err := c.getMonMap(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.saveMonMapBackup(clientset, clusterInfo, data); err != nil {
+		return nil, err
+	}
+
+	logger.Infof("exported monmap epoch %d with %d mons", m.Epoch, len(m.Mons))
+	return data, nil
+}
+
+// the backup is not owned by the mon resource so it outlives the cluster. a backup of another operator or of
+// another cluster is not overwritten.
+func (c *Cluster) saveMonMapBackup(clientset kubernetes.Interface, clusterInfo *mon.ClusterInfo, data []byte) error {
+	configMap, err := clientset.Core().ConfigMaps(c.Namespace).Get(monMapBackupName)
+	if err != nil {
+		if !k8sutil.IsKubernetesResourceNotFoundError(err) {
+			return fmt.Errorf("failed to get the monmap backup. %+v", err)
+		}
+
+		configMap = &v1.ConfigMap{
+			ObjectMeta: v1.ObjectMeta{
+				Name:        monMapBackupName,
+				Namespace:   c.Namespace,
+				Labels:      getLabels(clusterInfo.Name),
+				Annotations: c.operatorAnnotations(),
+			},
+			Data: map[string]string{monMapBackupKey: string(data)},
+		}
+		if _, err := clientset.Core().ConfigMaps(c.Namespace).Create(configMap); err != nil {
+			return fmt.Errorf("failed to save the monmap backup. %+v", err)
+		}
+		return nil
+	}
+
+	if c.foreign(configMap.ObjectMeta) {
+		return fmt.Errorf("the monmap backup %s belongs to another operator", monMapBackupName)
+	}
+	var saved monMap
+	if err := json.Unmarshal([]byte(configMap.Data[monMapBackupKey]), &saved); err == nil && saved.FSID != "" && saved.FSID != clusterInfo.FSID {
+		return fmt.Errorf("the monmap backup %s belongs to the cluster with fsid %s", monMapBackupName, saved.FSID)
+	}
+	configMap.Data = map[string]string{monMapBackupKey: string(data)}
+	if _, err := clientset.Core().ConfigMaps(c.Namespace).Update(configMap); err != nil {
+		return fmt.Errorf("failed to update the monmap backup. %+v", err)
+	}
+	return nil
+}
+
+// ImportMonMap restores the mon membership from an exported monmap. Mons in the monmap that are
+// missing from the cluster are added before mons that are not in the monmap are removed.
+func (c *Cluster) ImportMonMap(clusterInfo *mon.ClusterInfo, data []byte) error {
+	var desired monMap
+	if err := json.Unmarshal(data, &desired); err != nil {
+		return fmt.Errorf("failed to unmarshal the monmap to import. %+v", err)
+	}
+	if desired.FSID != clusterInfo.FSID {
+		return fmt.Errorf("monmap fsid %s does not match the cluster fsid %s", desired.FSID, clusterInfo.FSID)
+	}
+
+	conn, err := c.connect(clusterInfo)
+	if err != nil {
+		return err
+	}
+	defer conn.Shutdown()
+
+	_, current, err := c.getMonMap(conn)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range desired.Mons {
+		if findMonMapEntry(current, m.Name) != nil {
+			continue
+		}
+		logger.Infof("adding mon %s at %s from the monmap", m.Name, m.Address)
+		cmd := map[string]interface{}{"prefix": "mon add", "name": m.Name, "addr": m.Address}
+		if _, err := client.ExecuteMonCommand(conn, cmd, "mon add"); err != nil {
+			return fmt.Errorf("failed to add mon %s. %+v", m.Name, err)
+		}
+	}
+
+	for _, m := range current.Mons {
+		if findMonMapEntry(&desired, m.Name) != nil {
+			continue
+		}
+		logger.Infof("removing mon %s that is not in the monmap", m.Name)
+		cmd := map[string]interface{}{"prefix": "mon remove", "name": m.Name}
+		if _, err := client.ExecuteMonCommand(conn, cmd, "mon remove"); err != nil {
+			return fmt.Errorf("failed to remove mon %s. %+v", m.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// ForceQuorumRecovery recovers the cluster after the permanent loss of a majority of the mons. The lost mons are
+// removed and the surviving mon is restarted with a monmap that only has itself so it forms quorum alone.
+// The other mons are then rebuilt as new mons. The data of the lost mons is discarded, so the recovery
+// must be confirmed with ConfirmForceQuorumRecovery. The mon data must be on persistent volume claims so the store
+// of the survivor outlives the restart of its pod.
+func (c *Cluster) ForceQuorumRecovery(clientset kubernetes.Interface, clusterInfo *mon.ClusterInfo, survivingMon string) error {
+	if !c.ConfirmForceQuorumRecovery {
+		return fmt.Errorf("force quorum recovery discards the lost mons. set ConfirmForceQuorumRecovery to confirm")
+	}
+	if _, ok := clusterInfo.Monitors[survivingMon]; !ok {
+		return fmt.Errorf("surviving mon %s is not in the cluster", survivingMon)
+	}
+	if !c.usePVC() {
+		// the survivor is restarted to inject the monmap, which would wipe a store in an emptyDir
+		return fmt.Errorf("force quorum recovery requires the mon data on persistent volume claims. the store of mon %s is "+
+			"in an emptyDir that is lost when its pod is restarted", survivingMon)
+	}
+	if ok, current, required := c.HasQuorum(clusterInfo); ok {
+		return fmt.Errorf("the mons have quorum with %d mons where %d are required. refusing to force quorum", current, required)
+	}
+	if _, err := c.BackupClusterInfo(clientset, clusterInfo); err != nil {
+		return err
+	}
+
+	if err := c.forceSingleMonQuorum(clientset, clusterInfo, survivingMon); err != nil {
+		return err
+	}
+
+	logger.Infof("mon %s formed quorum alone. rebuilding the other mons", survivingMon)
+	if _, _, err := c.EnsureMons(clientset); err != nil {
+		return fmt.Errorf("failed to rebuild the mons. %+v", err)
+	}
+	return nil
+}
+
+func (c *Cluster) forceSingleMonQuorum(clientset kubernetes.Interface, clusterInfo *mon.ClusterInfo, survivingMon string) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+
+	if _, err := clientset.Core().Pods(c.Namespace).Get(survivingMon); err != nil {
+		return fmt.Errorf("failed to get the pod of surviving mon %s. %+v", survivingMon, err)
+	}
+
+	// the lost mons must not come back with their old monmap
+	lost := []string{}
+	for name := range clusterInfo.Monitors {
+		if name != survivingMon {
+			lost = append(lost, name)
+		}
+	}
+	sort.Strings(lost)
+	for _, name := range lost {
+		logger.Warningf("removing lost mon %s", name)
+		err := clientset.Core().Pods(c.Namespace).Delete(name, &api.DeleteOptions{})
+		if err != nil && !k8sutil.IsKubernetesResourceNotFoundError(err) {
+			return fmt.Errorf("failed to delete the pod of lost mon %s. %+v", name, err)
+		}
+		if err := c.waitForPodToDelete(clientset, name); err != nil {
+			return err
+		}
+		if c.usePVC() {
+			err := clientset.Core().PersistentVolumeClaims(c.Namespace).Delete(dataVolumeClaimName(name), &api.DeleteOptions{})
+			if err != nil && !k8sutil.IsKubernetesResourceNotFoundError(err) {
+				return fmt.Errorf("failed to delete the data of lost mon %s. %+v", name, err)
+			}
+		}
+		delete(clusterInfo.Monitors, name)
+	}
+	if err := c.saveEndpoints(clientset, c.Namespace, clusterInfo); err != nil {
+		return err
+	}
+
+	antiAffinity, err := c.getAntiAffinity(clientset)
+	if err != nil {
+		return fmt.Errorf("failed to get antiaffinity. %+v", err)
+	}
+
+	// the survivor injects a monmap with only itself before it starts
+	logger.Warningf("forcing quorum on mon %s", survivingMon)
+	config := &MonConfig{Name: survivingMon, Port: c.port(), V2Port: c.V2Port, forceQuorum: true}
+	if err := c.restartMon(clientset, clusterInfo, config, antiAffinity); err != nil {
+		return fmt.Errorf("failed to force quorum on mon %s. %+v", survivingMon, err)
+	}
+
+	// restart the survivor without the flag so a later restart does not drop the rebuilt mons from the monmap
+	config.forceQuorum = false
+	if err := c.restartMon(clientset, clusterInfo, config, antiAffinity); err != nil {
+		return fmt.Errorf("failed to restart mon %s after forcing quorum. %+v", survivingMon, err)
+	}
+	return nil
+}
+
+func findMonMapEntry(m *monMap, name string) *client.MonMapEntry {
+	for i := range m.Mons {
+		if m.Mons[i].Name == name {
+			return &m.Mons[i]
+		}
+	}
+	return nil
+}
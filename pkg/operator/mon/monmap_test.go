@@ -0,0 +1,211 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rook/rook/pkg/cephmgr/client"
+	"github.com/rook/rook/pkg/cephmgr/client/test"
+	"github.com/rook/rook/pkg/cephmgr/mon"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/1.5/kubernetes/fake"
+	"k8s.io/client-go/1.5/pkg/api/resource"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+	"k8s.io/client-go/1.5/pkg/runtime"
+	core "k8s.io/client-go/1.5/testing"
+)
+
+func TestExportImportMonMap(t *testing.T) {
+	info := testClusterInfo()
+	info.Monitors["mon0"] = mon.ToCephMon("mon0", "1.2.3.4")
+
+	// a mock ceph cluster that keeps its monmap in memory
+	current := &monMap{Epoch: 3, FSID: info.FSID, Mons: []client.MonMapEntry{
+		{Name: "mon0", Rank: 0, Address: "1.2.3.4:6790/0"},
+		{Name: "mon1", Rank: 1, Address: "1.2.3.5:6790/0"},
+		{Name: "mon2", Rank: 2, Address: "1.2.3.6:6790/0"},
+	}}
+	conn := &test.MockConnection{
+		MockMonCommand: func(args []byte) ([]byte, string, error) {
+			var cmd map[string]string
+			json.Unmarshal(args, &cmd)
+			switch cmd["prefix"] {
+			case "mon dump":
+				buf, err := json.Marshal(current)
+				return buf, "", err
+			case "mon add":
+				current.Mons = append(current.Mons, client.MonMapEntry{Name: cmd["name"], Address: cmd["addr"]})
+			case "mon remove":
+				for i, m := range current.Mons {
+					if m.Name == cmd["name"] {
+						current.Mons = append(current.Mons[:i], current.Mons[i+1:]...)
+						break
+					}
+				}
+			}
+			return []byte{}, "", nil
+		},
+	}
+	c := New("ns", &test.MockConnectionFactory{Conn: conn}, "myversion")
+	c.configDir = "/tmp"
+	clientset := fake.NewSimpleClientset()
+
+	data, err := c.ExportMonMap(clientset, info)
+	assert.Nil(t, err)
+	configMap, err := clientset.Core().ConfigMaps("ns").Get(monMapBackupName)
+	assert.Nil(t, err)
+	assert.Equal(t, string(data), configMap.Data[monMapBackupKey])
+
+	// mons 1 and 2 are lost and replaced by a mon that is not in the backup
+	current.Mons = []client.MonMapEntry{current.Mons[0], {Name: "mon3", Rank: 1, Address: "1.2.3.7:6790/0"}}
+
+	err = c.ImportMonMap(info, []byte(configMap.Data[monMapBackupKey]))
+	assert.Nil(t, err)
+	names := []string{}
+	for _, m := range current.Mons {
+		names = append(names, m.Name)
+	}
+	assert.Equal(t, []string{"mon0", "mon1", "mon2"}, names)
+	assert.Equal(t, "1.2.3.6:6790/0", findMonMapEntry(current, "mon2").Address)
+
+	// a monmap from another cluster is rejected
+	info.FSID = "another"
+	err = c.ImportMonMap(info, data)
+	assert.NotNil(t, err)
+}
+
+func TestExportMonMapOwnership(t *testing.T) {
+	info := testClusterInfo()
+	info.Monitors["mon0"] = mon.ToCephMon("mon0", "1.2.3.4")
+	epoch := 3
+	conn := &test.MockConnection{
+		MockMonCommand: func(args []byte) ([]byte, string, error) {
+			return []byte(fmt.Sprintf(`{"epoch":%d,"fsid":"%s","mons":[{"name":"mon0","rank":0}]}`, epoch, info.FSID)), "", nil
+		},
+	}
+	c := New("ns", &test.MockConnectionFactory{Conn: conn}, "myversion")
+	c.configDir = "/tmp"
+	c.OperatorID = "op1"
+	clientset := fake.NewSimpleClientset()
+	saved := func() *v1.ConfigMap {
+		configMap, err := clientset.Core().ConfigMaps("ns").Get(monMapBackupName)
+		assert.Nil(t, err)
+		return configMap
+	}
+
+	// the backup records the operator but is not owned by the mon resource
+	_, err := c.ExportMonMap(clientset, info)
+	assert.Nil(t, err)
+	assert.Equal(t, "op1", saved().Annotations[operatorIDAnnotation])
+	assert.Equal(t, 0, len(saved().OwnerReferences))
+
+	// the backup of this operator is updated
+	epoch = 4
+	data, err := c.ExportMonMap(clientset, info)
+	assert.Nil(t, err)
+	assert.Equal(t, string(data), saved().Data[monMapBackupKey])
+
+	// the backup of another operator is not overwritten
+	c.OperatorID = "op2"
+	epoch = 5
+	_, err = c.ExportMonMap(clientset, info)
+	assert.NotNil(t, err)
+	assert.Equal(t, string(data), saved().Data[monMapBackupKey])
+
+	// nor is the backup of another cluster
+	c.OperatorID = "op1"
+	other := saved()
+	other.Data[monMapBackupKey] = `{"epoch":1,"fsid":"another","mons":[]}`
+	_, err = clientset.Core().ConfigMaps("ns").Update(other)
+	assert.Nil(t, err)
+	_, err = c.ExportMonMap(clientset, info)
+	assert.NotNil(t, err)
+	assert.Equal(t, `{"epoch":1,"fsid":"another","mons":[]}`, saved().Data[monMapBackupKey])
+}
+
+func TestForceQuorumRecovery(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		testMonSecret("ns"),
+		testMonPod("mon0", "ns", "1.2.3.4", v1.PodRunning),
+		testMonPod("mon1", "ns", "1.2.3.5", v1.PodRunning),
+		testMonPod("mon2", "ns", "1.2.3.6", v1.PodRunning))
+	startCreatedPods(clientset)
+
+	// mon1 and mon2 are lost. quorum returns when mon0 is forced into quorum.
+	lost := true
+	conn := &test.MockConnection{
+		MockMonCommand: func(args []byte) ([]byte, string, error) {
+			if lost {
+				return []byte(`{"quorum":[],"monmap":{"mons":[{"name":"mon0","rank":0},{"name":"mon1","rank":1},{"name":"mon2","rank":2}]}}`), "", nil
+			}
+			return []byte(allInQuorumResponse), "", nil
+		},
+	}
+	clientset.PrependReactor("create", "pods", func(action core.Action) (bool, runtime.Object, error) {
+		pod := action.(core.CreateAction).GetObject().(*v1.Pod)
+		if strings.Contains(pod.Spec.Containers[0].Command[2], "--force-quorum") {
+			lost = false
+		}
+		return false, nil, nil
+	})
+	c := New("ns", &test.MockConnectionFactory{Conn: conn, Fsid: testClusterInfo().FSID, SecretKey: "mysecret"}, "myversion")
+	c.configDir = "/tmp"
+	c.PodStartRetries = 2
+	c.PodStartDelay = time.Millisecond
+	info := testClusterInfo()
+	for i, ip := range []string{"1.2.3.4", "1.2.3.5", "1.2.3.6"} {
+		name := fmt.Sprintf("mon%d", i)
+		info.Monitors[name] = mon.ToCephMon(name, ip)
+	}
+
+	// the recovery must be confirmed
+	err := c.ForceQuorumRecovery(clientset, info, "mon0")
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, len(podRestarts(clientset)))
+
+	c.ConfirmForceQuorumRecovery = true
+	err = c.ForceQuorumRecovery(clientset, info, "monX")
+	assert.NotNil(t, err)
+
+	// the store of the survivor in an emptyDir would be wiped by the restart
+	err = c.ForceQuorumRecovery(clientset, info, "mon0")
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, len(podRestarts(clientset)))
+	c.DataVolumeSize = resource.MustParse("1Gi")
+
+	// the lost mons are removed, the survivor is restarted with and then without the flag, and the mons are rebuilt.
+	// the survivor already exists when the mons are rebuilt.
+	err = c.ForceQuorumRecovery(clientset, info, "mon0")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"delete mon1", "delete mon2", "delete mon0", "create mon0", "delete mon0", "create mon0", "create mon0", "create mon1", "create mon2"},
+		podRestarts(clientset))
+
+	// the survivor runs without the flag after the recovery
+	pod, err := clientset.Core().Pods("ns").Get("mon0")
+	assert.Nil(t, err)
+	assert.False(t, strings.Contains(pod.Spec.Containers[0].Command[2], "--force-quorum"))
+
+	// nothing is forced while the mons have quorum
+	clientset.ClearActions()
+	err = c.ForceQuorumRecovery(clientset, info, "mon0")
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, len(podRestarts(clientset)))
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"k8s.io/client-go/1.5/pkg/api/v1"
+)
+
+// Option sets an optional setting of the mon cluster. The options are applied by New after the defaults.
+type Option func(*Cluster)
+
+// WithSize sets the number of mons
+func WithSize(size int) Option {
+	return func(c *Cluster) {
+		c.Size = size
+	}
+}
+
+// WithAntiAffinity sets whether the mons are spread across nodes
+func WithAntiAffinity(antiAffinity bool) Option {
+	return func(c *Cluster) {
+		c.AntiAffinity = antiAffinity
+	}
+}
+
+// WithPort sets the port of the mons
+func WithPort(port int32) Option {
+	return func(c *Cluster) {
+		c.Port = port
+	}
+}
+
+// WithSecretName sets the secret where the mon keys are stored
+func WithSecretName(name string) Option {
+	return func(c *Cluster) {
+		c.SecretName = name
+	}
+}
+
+// WithDevMode runs a single mon for development and test clusters
+func WithDevMode() Option {
+	return func(c *Cluster) {
+		c.DevMode = true
+	}
+}
+
+// WithResources sets the resources of each mon
+func WithResources(resources v1.ResourceRequirements) Option {
+	return func(c *Cluster) {
+		c.MonResources = resources
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/1.5/kubernetes/fake"
+	"k8s.io/client-go/1.5/pkg/api"
+	"k8s.io/client-go/1.5/pkg/api/resource"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+)
+
+func TestNewOptions(t *testing.T) {
+	// the defaults are kept without options
+	c := New("ns", nil, "myversion")
+	assert.Equal(t, 3, c.Size)
+	assert.True(t, c.AntiAffinity)
+	assert.Equal(t, appName, c.SecretName)
+	assert.False(t, c.DevMode)
+
+	resources := v1.ResourceRequirements{Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse("1Gi")}}
+	c = New("ns", nil, "myversion", WithSize(5), WithAntiAffinity(false), WithPort(6791), WithSecretName("mykeys"),
+		WithDevMode(), WithResources(resources))
+	assert.Equal(t, 5, c.Size)
+	assert.False(t, c.AntiAffinity)
+	assert.Equal(t, int32(6791), c.Port)
+	assert.Equal(t, "mykeys", c.SecretName)
+	assert.True(t, c.DevMode)
+	assert.Equal(t, resources, c.MonResources)
+
+	// the options are applied in order
+	c = New("ns", nil, "myversion", WithSize(5), WithSize(1))
+	assert.Equal(t, 1, c.Size)
+}
+
+func TestPortAndAntiAffinityOptions(t *testing.T) {
+	clientset := fake.NewSimpleClientset(testMonSecret("ns"),
+		testNode("node0", v1.ConditionTrue, false), testNode("node1", v1.ConditionTrue, false), testNode("node2", v1.ConditionTrue, false))
+	startCreatedPods(clientset)
+	c, _ := newTestHealthCluster(map[string]string{"mon_status": allInQuorumResponse})
+	c.PodStartDelay = time.Millisecond
+	c.Subdomain = "mons"
+	WithPort(6791)(c)
+	WithAntiAffinity(false)(c)
+
+	// the mons listen on the port and are not spread across the nodes even though there are enough nodes
+	info, _, err := c.EnsureMons(clientset)
+	assert.Nil(t, err)
+	assert.Equal(t, "mon0.mons.ns.svc:6791", info.Monitors["mon0"].Endpoint)
+	for _, name := range []string{"mon0", "mon1", "mon2"} {
+		pod, err := clientset.Core().Pods("ns").Get(name)
+		assert.Nil(t, err)
+		assert.Equal(t, int32(6791), pod.Spec.Containers[0].Ports[0].ContainerPort)
+		assert.Contains(t, pod.Spec.Containers[0].Command[2], "--port=6791")
+		assert.Equal(t, "", pod.Annotations[api.AffinityAnnotationKey], name)
+	}
+	pod, err := clientset.Core().Pods("ns").Get("mon1")
+	assert.Nil(t, err)
+	assert.Contains(t, pod.Spec.Containers[0].Command[2], "--mon-endpoints=mon0=mon0.mons.ns.svc:6791")
+
+	service, err := clientset.Core().Services("ns").Get("mons")
+	assert.Nil(t, err)
+	assert.Equal(t, int32(6791), service.Spec.Ports[0].Port)
+	assert.Equal(t, 6791, service.Spec.Ports[0].TargetPort.IntValue())
+
+	// the mons are spread by default
+	c = New("ns", nil, "myversion")
+	antiAffinity, err := c.getAntiAffinity(clientset)
+	assert.Nil(t, err)
+	assert.True(t, antiAffinity)
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/client-go/1.5/kubernetes"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+)
+
+// read the mon resource that owns the objects created for the mons. the objects have no owner when the resource
+// does not exist.
+func (c *Cluster) loadOwner(clientset kubernetes.Interface) error {
+	name := c.resourceName()
+	body, err := c.getResource(clientset, resourcePath(c.Namespace, name))
+	if err != nil {
+		if k8sutil.IsKubernetesResourceNotFoundError(err) {
+			c.recordOwner(nil)
+			return nil
+		}
+		return fmt.Errorf("failed to get mon resource %s. %+v", name, err)
+	}
+
+	var resource monResource
+	if err := json.Unmarshal(body, &resource); err != nil {
+		return fmt.Errorf("failed to unmarshal mon resource %s. %+v", name, err)
+	}
+	c.recordOwner(&resource)
+	return nil
+}
+
+func (c *Cluster) recordOwner(resource *monResource) {
+	if resource == nil || resource.Metadata.UID == "" {
+		c.owner = nil
+		return
+	}
+	controller := true
+	c.owner = &v1.OwnerReference{
+		APIVersion: fmt.Sprintf("%s/%s", resourceGroup, resourceVersion),
+		Kind:       resourceKind,
+		Name:       resource.Metadata.Name,
+		UID:        resource.Metadata.UID,
+		Controller: &controller,
+	}
+}
+
+// The owner references of the objects created for the mons, so kubernetes garbage collects them after the mon
+// resource is deleted. The backups and the data volumes are not owned so they outlive the cluster.
+func (c *Cluster) ownerReferences() []v1.OwnerReference {
+	if c.owner == nil {
+		return nil
+	}
+	return []v1.OwnerReference{*c.owner}
+}
+
+// the annotations that record the operator instance that created an object. nil without an operator id.
+func (c *Cluster) operatorAnnotations() map[string]string {
+	if c.OperatorID == "" {
+		return nil
+	}
+	return map[string]string{operatorIDAnnotation: c.OperatorID}
+}
+
+// whether another operator instance created the object. the objects created before the operators had ids belong to
+// any operator.
+func (c *Cluster) foreign(meta v1.ObjectMeta) bool {
+	id, ok := meta.Annotations[operatorIDAnnotation]
+	if !ok || id == c.OperatorID {
+		return false
+	}
+	logger.Warningf("not modifying %s. it was created by operator %q, this is operator %q", meta.Name, id, c.OperatorID)
+	return true
+}
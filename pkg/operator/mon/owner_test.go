@@ -0,0 +1,155 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rook/rook/pkg/cephmgr/mon"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/1.5/kubernetes"
+	"k8s.io/client-go/1.5/kubernetes/fake"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+)
+
+func TestOwnerReferences(t *testing.T) {
+	c, _ := newTestHealthCluster(map[string]string{"mon_status": allInQuorumResponse})
+	c.Size = 1
+	c.PodStartDelay = time.Millisecond
+	c.Subdomain = "rook-mon"
+	c.getResource = func(clientset kubernetes.Interface, path string) ([]byte, error) {
+		return []byte(`{"apiVersion":"rook.io/v1","kind":"Mon","metadata":{"name":"mon","uid":"1234"},"spec":{}}`), nil
+	}
+	c.putResource = func(clientset kubernetes.Interface, path string, body []byte) error { return nil }
+
+	clientset := fake.NewSimpleClientset()
+	startCreatedPods(clientset)
+	_, err := c.Start(clientset)
+	assert.Nil(t, err)
+
+	assertOwned := func(meta v1.ObjectMeta) {
+		if assert.Equal(t, 1, len(meta.OwnerReferences), meta.Name) {
+			owner := meta.OwnerReferences[0]
+			assert.Equal(t, "rook.io/v1", owner.APIVersion)
+			assert.Equal(t, "Mon", owner.Kind)
+			assert.Equal(t, "mon", owner.Name)
+			assert.Equal(t, "1234", string(owner.UID))
+			assert.True(t, *owner.Controller)
+		}
+	}
+	secret, err := clientset.Core().Secrets("ns").Get(appName)
+	assert.Nil(t, err)
+	assertOwned(secret.ObjectMeta)
+	endpoints, err := clientset.Core().ConfigMaps("ns").Get(EndpointConfigMapName)
+	assert.Nil(t, err)
+	assertOwned(endpoints.ObjectMeta)
+	service, err := clientset.Core().Services("ns").Get("rook-mon")
+	assert.Nil(t, err)
+	assertOwned(service.ObjectMeta)
+	pdb, err := clientset.Policy().PodDisruptionBudgets("ns").Get(pdbName)
+	assert.Nil(t, err)
+	assertOwned(pdb.ObjectMeta)
+	pod, err := clientset.Core().Pods("ns").Get("mon0")
+	assert.Nil(t, err)
+	assertOwned(pod.ObjectMeta)
+
+	// without the mon resource nothing is owned
+	c.getResource = noMonResource
+	err = c.loadOwner(clientset)
+	assert.Nil(t, err)
+	assert.Nil(t, c.makeMonPod(&MonConfig{Name: "mon1", Port: 6790}, testClusterInfo(), true, false).OwnerReferences)
+}
+
+func TestOwnerReferencesReconciled(t *testing.T) {
+	c := New("ns", nil, "myversion")
+	clientset := fake.NewSimpleClientset()
+	info := testClusterInfo()
+	info.Monitors["mon0"] = mon.ToCephMon("mon0", "1.2.3.4")
+	err := c.saveEndpoints(clientset, "ns", info)
+	assert.Nil(t, err)
+	configMap, err := clientset.Core().ConfigMaps("ns").Get(EndpointConfigMapName)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(configMap.OwnerReferences))
+
+	// the existing config map gets the owner of the resource that was created later
+	c.getResource = func(clientset kubernetes.Interface, path string) ([]byte, error) {
+		return []byte(`{"metadata":{"name":"mon","uid":"1234"}}`), nil
+	}
+	err = c.LoadSpec(clientset)
+	assert.Nil(t, err)
+	err = c.saveEndpoints(clientset, "ns", info)
+	assert.Nil(t, err)
+	configMap, err = clientset.Core().ConfigMaps("ns").Get(EndpointConfigMapName)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(configMap.OwnerReferences))
+	assert.Equal(t, "1234", string(configMap.OwnerReferences[0].UID))
+}
+
+func TestOperatorID(t *testing.T) {
+	c, info := newTestHealthCluster(map[string]string{"mon_status": allInQuorumResponse})
+	c.Size = 1
+	c.PodStartDelay = time.Millisecond
+	c.OperatorID = "team-a"
+	c.ConfigOverrides = map[string]string{"mon_osd_full_ratio": "0.9"}
+	c.getResource = noMonResource
+	c.putResource = func(clientset kubernetes.Interface, path string, body []byte) error { return nil }
+
+	clientset := fake.NewSimpleClientset()
+	startCreatedPods(clientset)
+	_, err := c.Start(clientset)
+	assert.Nil(t, err)
+
+	// the objects record the operator that created them
+	pod, err := clientset.Core().Pods("ns").Get("mon0")
+	assert.Nil(t, err)
+	assert.Equal(t, "team-a", pod.Annotations[operatorIDAnnotation])
+	secret, err := clientset.Core().Secrets("ns").Get(appName)
+	assert.Nil(t, err)
+	assert.Equal(t, "team-a", secret.Annotations[operatorIDAnnotation])
+	endpoints, err := clientset.Core().ConfigMaps("ns").Get(EndpointConfigMapName)
+	assert.Nil(t, err)
+	assert.Equal(t, "team-a", endpoints.Annotations[operatorIDAnnotation])
+	override, err := clientset.Core().ConfigMaps("ns").Get(configOverrideName)
+	assert.Nil(t, err)
+	assert.Equal(t, "team-a", override.Annotations[operatorIDAnnotation])
+	pdb, err := clientset.Policy().PodDisruptionBudgets("ns").Get(pdbName)
+	assert.Nil(t, err)
+	assert.Equal(t, "team-a", pdb.Annotations[operatorIDAnnotation])
+
+	// another operator does not modify the objects
+	other := New("ns", nil, "myversion")
+	other.OperatorID = "team-b"
+	info.Monitors["mon0"] = mon.ToCephMon("mon0", "1.2.3.9")
+	err = other.saveEndpoints(clientset, "ns", info)
+	assert.Nil(t, err)
+	other.ConfigOverrides = map[string]string{"mon_osd_full_ratio": "0.5"}
+	err = other.saveConfigOverride(clientset, "ns", info)
+	assert.Nil(t, err)
+	endpoints, err = clientset.Core().ConfigMaps("ns").Get(EndpointConfigMapName)
+	assert.Nil(t, err)
+	assert.Equal(t, "mon0=10.0.0.1:6790", endpoints.Data[EndpointDataKey])
+	override, err = clientset.Core().ConfigMaps("ns").Get(configOverrideName)
+	assert.Nil(t, err)
+	assert.Equal(t, c.configOverrideContent(), override.Data[configOverrideKey])
+
+	// the operator that created the objects still updates them
+	err = c.saveEndpoints(clientset, "ns", info)
+	assert.Nil(t, err)
+	endpoints, err = clientset.Core().ConfigMaps("ns").Get(EndpointConfigMapName)
+	assert.Nil(t, err)
+	assert.Equal(t, "mon0=1.2.3.9:6790", endpoints.Data[EndpointDataKey])
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"fmt"
+
+	"github.com/rook/rook/pkg/cephmgr/mon"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/client-go/1.5/kubernetes"
+	"k8s.io/client-go/1.5/pkg/api"
+	"k8s.io/client-go/1.5/pkg/api/unversioned"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+	policy "k8s.io/client-go/1.5/pkg/apis/policy/v1alpha1"
+	"k8s.io/client-go/1.5/pkg/util/intstr"
+)
+
+const pdbName = "rook-ceph-mon"
+
+func (c *Cluster) makePodDisruptionBudget(clusterInfo *mon.ClusterInfo) *policy.PodDisruptionBudget {
+	return &policy.PodDisruptionBudget{
+		ObjectMeta: v1.ObjectMeta{
+			Name:            pdbName,
+			Namespace:       c.Namespace,
+			Labels:          getLabels(clusterInfo.Name),
+			Annotations:     c.operatorAnnotations(),
+			OwnerReferences: c.ownerReferences(),
+		},
+		Spec: policy.PodDisruptionBudgetSpec{
+			MinAvailable: intstr.FromInt(QuorumMajority(c.size())),
+			Selector:     &unversioned.LabelSelector{MatchLabels: getLabels(clusterInfo.Name)},
+		},
+	}
+}
+
+// Protect quorum from voluntary disruptions such as node drains. The budget requires a majority of the
+// mons to be available. The spec of a budget cannot be updated, so the budget is replaced when the size changes.
+func (c *Cluster) startPodDisruptionBudget(clientset kubernetes.Interface, clusterInfo *mon.ClusterInfo) error {
+	pdb := c.makePodDisruptionBudget(clusterInfo)
+
+	existing, err := clientset.Policy().PodDisruptionBudgets(c.Namespace).Get(pdbName)
+	if err == nil {
+		if existing.Spec.MinAvailable == pdb.Spec.MinAvailable || c.foreign(existing.ObjectMeta) {
+			return nil
+		}
+		logger.Infof("replacing mon disruption budget. minAvailable %s -> %s", existing.Spec.MinAvailable.String(), pdb.Spec.MinAvailable.String())
+		err = clientset.Policy().PodDisruptionBudgets(c.Namespace).Delete(pdbName, &api.DeleteOptions{})
+		if err != nil && !k8sutil.IsKubernetesResourceNotFoundError(err) {
+			return fmt.Errorf("failed to delete mon disruption budget. %+v", err)
+		}
+	} else if !k8sutil.IsKubernetesResourceNotFoundError(err) {
+		return fmt.Errorf("failed to get mon disruption budget. %+v", err)
+	}
+
+	if _, err := clientset.Policy().PodDisruptionBudgets(c.Namespace).Create(pdb); err != nil {
+		return fmt.Errorf("failed to create mon disruption budget. %+v", err)
+	}
+	logger.Infof("mon disruption budget requires %d of %d mons", QuorumMajority(c.size()), c.size())
+	return nil
+}
@@ -0,0 +1,45 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/1.5/kubernetes/fake"
+)
+
+func TestPodDisruptionBudget(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	c := New("ns", nil, "myversion")
+
+	for size, minAvailable := range map[int]int{1: 1, 2: 2, 3: 2, 4: 3, 5: 3} {
+		c.Size = size
+		err := c.startPodDisruptionBudget(clientset, testClusterInfo())
+		assert.Nil(t, err)
+
+		pdb, err := clientset.Policy().PodDisruptionBudgets("ns").Get(pdbName)
+		assert.Nil(t, err)
+		assert.Equal(t, minAvailable, pdb.Spec.MinAvailable.IntValue(), "size %d", size)
+		assert.Equal(t, getLabels("rookcluster"), pdb.Spec.Selector.MatchLabels)
+	}
+
+	// the budget is not replaced when the size did not change
+	clientset.ClearActions()
+	err := c.startPodDisruptionBudget(clientset, testClusterInfo())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(clientset.Actions()))
+}
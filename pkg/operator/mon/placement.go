@@ -0,0 +1,127 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/rook/rook/pkg/cephmgr/mon"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/client-go/1.5/kubernetes"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+)
+
+// the failure domain the mon was scheduled into
+const failureDomainAnnotation = "rook.io/failure-domain"
+
+// MonPlacement is the node and failure domain a mon runs in. The failure domain is only set with a FailureDomainLabel.
+type MonPlacement struct {
+	Name          string
+	Node          string
+	FailureDomain string
+}
+
+// MonPlacementReport is the placement of the mons and whether no two scheduled mons share a node, or a failure
+// domain when a FailureDomainLabel is configured
+type MonPlacementReport struct {
+	Mons   []MonPlacement
+	Spread bool
+}
+
+// PlacementReport reports where the mons run and whether they are spread as intended. The mons can end up
+// together after node churn even though each mon was spread when it was created.
+func (c *Cluster) PlacementReport(clientset kubernetes.Interface, clusterName string) (*MonPlacementReport, error) {
+	pods, err := clientset.Core().Pods(c.Namespace).List(listOptions(clusterName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list mon pods. %+v", err)
+	}
+
+	report := &MonPlacementReport{Spread: true}
+	domains := map[string]string{}
+	for _, pod := range pods.Items {
+		placement := MonPlacement{Name: pod.Name, Node: pod.Spec.NodeName}
+		domain := placement.Node
+		if d, ok := pod.Annotations[failureDomainAnnotation]; ok && c.FailureDomainLabel != "" {
+			placement.FailureDomain = d
+			domain = d
+		} else if c.FailureDomainLabel != "" && placement.Node != "" {
+			node, err := clientset.Core().Nodes().Get(placement.Node)
+			if err != nil && !k8sutil.IsKubernetesResourceNotFoundError(err) {
+				return nil, fmt.Errorf("failed to get node %s of mon %s. %+v", placement.Node, pod.Name, err)
+			}
+			if err == nil {
+				placement.FailureDomain = node.Labels[c.FailureDomainLabel]
+			}
+			domain = placement.FailureDomain
+		}
+		report.Mons = append(report.Mons, placement)
+
+		// mons that are not scheduled yet cannot violate the spread
+		if domain == "" {
+			continue
+		}
+		if other, ok := domains[domain]; ok {
+			logger.Warningf("mons %s and %s are both in %s", other, pod.Name, domain)
+			report.Spread = false
+		}
+		domains[domain] = pod.Name
+	}
+	sort.Sort(byMonName(report.Mons))
+	return report, nil
+}
+
+// Record the failure domain of the node the mon was scheduled to on the pod and in the cluster info. The domain is
+// read from the node once since the pod does not move. A domain that cannot be read is not an error, the mon only
+// misses from the report.
+func (c *Cluster) captureFailureDomain(clientset kubernetes.Interface, clusterInfo *mon.ClusterInfo, pod *v1.Pod) {
+	if c.FailureDomainLabel == "" || pod.Spec.NodeName == "" {
+		return
+	}
+
+	domain, ok := pod.Annotations[failureDomainAnnotation]
+	if !ok {
+		node, err := clientset.Core().Nodes().Get(pod.Spec.NodeName)
+		if err != nil {
+			logger.Warningf("failed to get node %s of mon %s. %+v", pod.Spec.NodeName, pod.Name, err)
+			return
+		}
+		domain = node.Labels[c.FailureDomainLabel]
+		if domain == "" {
+			logger.Warningf("node %s of mon %s has no label %s", node.Name, pod.Name, c.FailureDomainLabel)
+			return
+		}
+
+		if pod.Annotations == nil {
+			pod.Annotations = map[string]string{}
+		}
+		pod.Annotations[failureDomainAnnotation] = domain
+		if _, err := clientset.Core().Pods(c.Namespace).Update(pod); err != nil {
+			logger.Warningf("failed to record failure domain %s on mon %s. %+v", domain, pod.Name, err)
+		}
+		logger.Infof("mon %s is in failure domain %s", pod.Name, domain)
+	}
+
+	if m, ok := clusterInfo.Monitors[pod.Name]; ok {
+		m.FailureDomain = domain
+	}
+}
+
+type byMonName []MonPlacement
+
+func (m byMonName) Len() int           { return len(m) }
+func (m byMonName) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+func (m byMonName) Less(i, j int) bool { return m[i].Name < m[j].Name }
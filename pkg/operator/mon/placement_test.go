@@ -0,0 +1,105 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/1.5/kubernetes/fake"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+)
+
+func TestPlacementReport(t *testing.T) {
+	placed := func(name, node string) *v1.Pod {
+		pod := testMonPod(name, "ns", "1.2.3.4", v1.PodRunning)
+		pod.Spec.NodeName = node
+		return pod
+	}
+	zone := "failure-domain.beta.kubernetes.io/zone"
+	nodes := []*v1.Node{testNode("node0", v1.ConditionTrue, false), testNode("node1", v1.ConditionTrue, false)}
+	for _, n := range nodes {
+		n.Labels = map[string]string{zone: "a"}
+	}
+
+	// mon1 and mon2 are on the same node
+	clientset := fake.NewSimpleClientset(placed("mon0", "node0"), placed("mon1", "node1"), placed("mon2", "node1"), nodes[0], nodes[1])
+	c := New("ns", nil, "myversion")
+	report, err := c.PlacementReport(clientset, "rookcluster")
+	assert.Nil(t, err)
+	assert.False(t, report.Spread)
+	assert.Equal(t, []MonPlacement{{"mon0", "node0", ""}, {"mon1", "node1", ""}, {"mon2", "node1", ""}}, report.Mons)
+
+	// the mons are spread across the nodes, but not across the zones
+	clientset = fake.NewSimpleClientset(placed("mon0", "node0"), placed("mon1", "node1"), placed("mon2", ""), nodes[0], nodes[1])
+	report, err = c.PlacementReport(clientset, "rookcluster")
+	assert.Nil(t, err)
+	assert.True(t, report.Spread)
+
+	c.FailureDomainLabel = zone
+	report, err = c.PlacementReport(clientset, "rookcluster")
+	assert.Nil(t, err)
+	assert.False(t, report.Spread)
+	assert.Equal(t, "a", report.Mons[1].FailureDomain)
+}
+
+func TestCaptureFailureDomain(t *testing.T) {
+	zone := "failure-domain.beta.kubernetes.io/zone"
+	pods := []*v1.Pod{}
+	for i := 0; i < 3; i++ {
+		pod := testMonPod(fmt.Sprintf("mon%d", i), "ns", fmt.Sprintf("1.2.3.%d", i), v1.PodRunning)
+		pod.Spec.NodeName = fmt.Sprintf("node%d", i)
+		pods = append(pods, pod)
+	}
+	// the node of mon2 is not labeled. node3 gives enough domains for the anti-affinity.
+	nodes := []*v1.Node{}
+	for i, domain := range []string{"a", "b", "", "c"} {
+		node := testNode(fmt.Sprintf("node%d", i), v1.ConditionTrue, false)
+		if domain != "" {
+			node.Labels = map[string]string{zone: domain}
+		}
+		nodes = append(nodes, node)
+	}
+	clientset := fake.NewSimpleClientset(pods[0], pods[1], pods[2], nodes[0], nodes[1], nodes[2], nodes[3])
+	c := New("ns", nil, "myversion")
+	c.FailureDomainLabel = zone
+	mons := []*MonConfig{{Name: "mon0", Port: 6790}, {Name: "mon1", Port: 6790}, {Name: "mon2", Port: 6790}}
+
+	info := testClusterInfo()
+	_, err := c.startPods(clientset, info, mons)
+	assert.Nil(t, err)
+	assert.Equal(t, "a", info.Monitors["mon0"].FailureDomain)
+	assert.Equal(t, "b", info.Monitors["mon1"].FailureDomain)
+	assert.Equal(t, "", info.Monitors["mon2"].FailureDomain)
+
+	// the domain is stamped on the pods of the labeled nodes
+	pod, err := clientset.Core().Pods("ns").Get("mon0")
+	assert.Nil(t, err)
+	assert.Equal(t, "a", pod.Annotations[failureDomainAnnotation])
+	pod, err = clientset.Core().Pods("ns").Get("mon2")
+	assert.Nil(t, err)
+	_, ok := pod.Annotations[failureDomainAnnotation]
+	assert.False(t, ok)
+
+	// the report uses the captured domain after the node is gone
+	err = clientset.Core().Nodes().Delete("node1", nil)
+	assert.Nil(t, err)
+	report, err := c.PlacementReport(clientset, "rookcluster")
+	assert.Nil(t, err)
+	assert.True(t, report.Spread)
+	assert.Equal(t, []MonPlacement{{"mon0", "node0", "a"}, {"mon1", "node1", "b"}, {"mon2", "node2", ""}}, report.Mons)
+}
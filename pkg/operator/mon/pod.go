@@ -16,22 +16,116 @@ limitations under the License.
 package mon
 
 import (
+	"encoding/json"
 	"fmt"
+	"path"
+	"strings"
 
 	"github.com/rook/rook/pkg/cephmgr/mon"
+	"github.com/rook/rook/pkg/clusterd"
 	"github.com/rook/rook/pkg/operator/k8sutil"
 	"k8s.io/client-go/1.5/kubernetes"
 	"k8s.io/client-go/1.5/pkg/api"
+	"k8s.io/client-go/1.5/pkg/api/unversioned"
 	"k8s.io/client-go/1.5/pkg/api/v1"
 	"k8s.io/client-go/1.5/pkg/labels"
+	"k8s.io/client-go/1.5/pkg/util/intstr"
 )
 
-func MonSecretEnvVar() v1.EnvVar {
-	return v1.EnvVar{Name: "ROOKD_MON_SECRET", ValueFrom: &v1.EnvVarSource{SecretKeyRef: &v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: appName}, Key: monSecretName}}}
+// MonContainerName is the name of the mon container in the mon pods. The statuses and logs of the mon are taken
+// from the container with this name, so sidecars in the mon pods must use other names.
+const MonContainerName = "mon"
+
+// the downward api env vars of the mon container
+const (
+	podNameEnvVar      = "POD_NAME"
+	podNamespaceEnvVar = "POD_NAMESPACE"
+	nodeNameEnvVar     = "NODE_NAME"
+	podIPEnvVar        = "POD_IP"
+)
+
+// the status of the mon container. nil until the kubelet reports it.
+func monContainerStatus(pod *v1.Pod) *v1.ContainerStatus {
+	for i := range pod.Status.ContainerStatuses {
+		if pod.Status.ContainerStatuses[i].Name == MonContainerName {
+			return &pod.Status.ContainerStatuses[i]
+		}
+	}
+	return nil
+}
+
+// whether the mon container is known to not be running, for example while it waits to be restarted after a crash
+func monContainerDown(pod *v1.Pod) bool {
+	status := monContainerStatus(pod)
+	return status != nil && status.State.Running == nil
+}
+
+// the PodScheduled condition of a pending pod when the scheduler cannot place it because of its affinity, for
+// example when there are fewer nodes than mons with anti-affinity. nil if the pod is not blocked by its affinity.
+func affinityUnschedulable(pod *v1.Pod) *v1.PodCondition {
+	for i := range pod.Status.Conditions {
+		cond := &pod.Status.Conditions[i]
+		if cond.Type == v1.PodScheduled && cond.Status == v1.ConditionFalse && cond.Reason == podReasonUnschedulable &&
+			strings.Contains(strings.ToLower(cond.Message), "affinity") {
+			return cond
+		}
+	}
+	return nil
+}
+
+// the ip of the mon. with a public network the ip must be in the network. the mons on the host network bind to
+// an address of their node, so the host ip is also considered for them.
+func (c *Cluster) monIP(pod *v1.Pod) string {
+	if c.PublicNetwork == "" {
+		return pod.Status.PodIP
+	}
+	ips := []string{pod.Status.PodIP}
+	if c.HostNetwork {
+		ips = append(ips, pod.Status.HostIP)
+	}
+	ip, err := clusterd.AddrInNetwork(c.PublicNetwork, ips)
+	if err != nil {
+		logger.Warningf("failed to select the ip of mon %s. %+v", pod.Name, err)
+		return ""
+	}
+	return ip
 }
 
-func AdminSecretEnvVar() v1.EnvVar {
-	return v1.EnvVar{Name: "ROOKD_ADMIN_SECRET", ValueFrom: &v1.EnvVarSource{SecretKeyRef: &v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: appName}, Key: adminSecretName}}}
+func fieldRefEnvVar(name, fieldPath string) v1.EnvVar {
+	return v1.EnvVar{Name: name, ValueFrom: &v1.EnvVarSource{FieldRef: &v1.ObjectFieldSelector{FieldPath: fieldPath}}}
+}
+
+// MonSecret is the secret and the data keys that the pods of the other daemons read the mon and admin keys from
+type MonSecret struct {
+	Name     string
+	MonKey   string
+	AdminKey string
+}
+
+// DefaultMonSecret is the secret of the mons with the default name and keys
+func DefaultMonSecret() MonSecret {
+	return MonSecret{Name: appName, MonKey: monSecretName, AdminKey: adminSecretName}
+}
+
+// MonSecret returns the secret the mon keys are stored in, with the keys mapped by the SecretKeyMap
+func (c *Cluster) MonSecret() MonSecret {
+	return MonSecret{Name: c.SecretName, MonKey: c.secretKey(monSecretName), AdminKey: c.secretKey(adminSecretName)}
+}
+
+func (s MonSecret) MonSecretEnvVar() v1.EnvVar {
+	return monSecretEnvVar(s.Name, s.MonKey)
+}
+
+func (s MonSecret) AdminSecretEnvVar() v1.EnvVar {
+	return adminSecretEnvVar(s.Name, s.AdminKey)
+}
+
+func monSecretEnvVar(secretName, key string) v1.EnvVar {
+	return v1.EnvVar{Name: "ROOKD_MON_SECRET", ValueFrom: &v1.EnvVarSource{SecretKeyRef: &v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: secretName}, Key: key}}}
+}
+
+func adminSecretEnvVar(secretName, key string) v1.EnvVar {
+	return v1.EnvVar{Name: "ROOKD_ADMIN_SECRET", ValueFrom: &v1.EnvVarSource{SecretKeyRef: &v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: secretName}, Key: key}}}
 }
 
 func getLabels(clusterName string) map[string]string {
@@ -41,43 +135,170 @@ func getLabels(clusterName string) map[string]string {
 	}
 }
 
-func (c *Cluster) makeMonPod(config *MonConfig, clusterInfo *mon.ClusterInfo, antiAffinity bool) *v1.Pod {
+// Create the pod for the mon. The bootstrap mon is the first mon of a new cluster and creates the monmap with only
+// itself. The other mons join the monmap of the mons in the cluster info.
+func (c *Cluster) makeMonPod(config *MonConfig, clusterInfo *mon.ClusterInfo, antiAffinity, bootstrap bool) *v1.Pod {
 
-	container := c.monContainer(config, clusterInfo)
+	container := c.monContainer(config, clusterInfo, bootstrap)
 
 	pod := &v1.Pod{
 		ObjectMeta: v1.ObjectMeta{
-			Name:        config.Name,
-			Labels:      getLabels(clusterInfo.Name),
-			Annotations: map[string]string{},
+			Name:            config.Name,
+			Namespace:       c.Namespace,
+			Labels:          getLabels(clusterInfo.Name),
+			Annotations:     map[string]string{},
+			OwnerReferences: c.ownerReferences(),
 		},
 		Spec: v1.PodSpec{
 			Containers:    []v1.Container{container},
 			RestartPolicy: v1.RestartPolicyAlways,
+			HostNetwork:   c.HostNetwork,
+			DNSPolicy:     c.getDNSPolicy(),
+			NodeSelector:  c.nodeSelector(),
 			Volumes: []v1.Volume{
-				{Name: k8sutil.DataDirVolume, VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+				{Name: k8sutil.DataDirVolume, VolumeSource: c.dataVolumeSource(config)},
 			},
 		},
 	}
 
+	if c.Subdomain != "" {
+		pod.Spec.Hostname = config.Name
+		pod.Spec.Subdomain = c.Subdomain
+	}
+
+	if c.DisableServiceAccountToken {
+		// the service account admission controller does not mount the token when the path is already mounted
+		pod.Spec.Volumes = append(pod.Spec.Volumes, v1.Volume{Name: serviceAccountVolume, VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}})
+	}
+	if v := c.configOverrideVolume(); v != nil {
+		pod.Spec.Volumes = append(pod.Spec.Volumes, *v)
+	}
+	if c.KeyringMountPath != "" {
+		pod.Spec.Volumes = append(pod.Spec.Volumes, v1.Volume{Name: keyringVolumeName, VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}})
+	}
+	if c.CABundleConfigMap != "" {
+		pod.Spec.Volumes = append(pod.Spec.Volumes, v1.Volume{
+			Name: caBundleVolumeName,
+			VolumeSource: v1.VolumeSource{ConfigMap: &v1.ConfigMapVolumeSource{
+				LocalObjectReference: v1.LocalObjectReference{Name: c.CABundleConfigMap},
+				Items:                []v1.KeyToPath{{Key: caBundleKey, Path: caBundleKey}},
+			}},
+		})
+	}
+	pod.Annotations[fsidAnnotation] = clusterInfo.FSID
+	if c.OperatorVersion != "" {
+		pod.Annotations[operatorVersionAnnotation] = c.OperatorVersion
+	}
+	if c.OperatorID != "" {
+		pod.Annotations[operatorIDAnnotation] = c.OperatorID
+	}
+	if hash := c.configHash(); hash != "" {
+		pod.Annotations[configHashAnnotation] = hash
+	}
+	if hash := c.resourcesHash(config); hash != "" {
+		pod.Annotations[resourcesHashAnnotation] = hash
+	}
+	if tolerations := c.tolerationsAnnotation(); tolerations != "" {
+		pod.Annotations[api.TolerationsAnnotationKey] = tolerations
+	}
+
+	c.addMetricsExporter(pod, config, clusterInfo)
+
 	k8sutil.SetPodVersion(pod, k8sutil.VersionAttr, c.Version)
 
 	if antiAffinity {
-		k8sutil.PodWithAntiAffinity(pod, monClusterAttr, clusterInfo.Name)
+		k8sutil.PodWithTopologyAntiAffinity(pod, monClusterAttr, clusterInfo.Name, c.topologyKey())
+	}
+
+	if c.PodSpecMutator != nil {
+		c.PodSpecMutator(pod)
 	}
 	return pod
 }
 
-func (c *Cluster) monContainer(config *MonConfig, clusterInfo *mon.ClusterInfo) v1.Container {
-	command := fmt.Sprintf("/usr/bin/rookd mon --data-dir=%s --name=%s --mon-endpoints=%s --port=%d --fsid=%s --cluster-name=%s",
-		k8sutil.DataDir, config.Name, mon.FlattenMonEndpoints(clusterInfo.Monitors), config.Port, clusterInfo.FSID, clusterInfo.Name)
+// the tolerations are set with an annotation in this version of kubernetes. empty when the mons have no tolerations.
+func (c *Cluster) tolerationsAnnotation() string {
+	if len(c.Tolerations) == 0 {
+		return ""
+	}
+	buf, err := json.Marshal(c.Tolerations)
+	if err != nil {
+		logger.Warningf("failed to marshal the mon tolerations. %+v", err)
+		return ""
+	}
+	return string(buf)
+}
 
-	return v1.Container{
+// the dns policy defaults to cluster dns, which requires a special policy when the mons are on the host network
+func (c *Cluster) getDNSPolicy() v1.DNSPolicy {
+	if c.DNSPolicy != "" {
+		return c.DNSPolicy
+	}
+	if c.HostNetwork {
+		return dnsClusterFirstWithHostNet
+	}
+	return v1.DNSClusterFirst
+}
+
+// the mons only run on linux nodes by default. the user's selector takes precedence over the defaults.
+func (c *Cluster) nodeSelector() map[string]string {
+	selector := map[string]string{unversioned.LabelOS: "linux"}
+	if c.Arch != "" {
+		selector[unversioned.LabelArch] = c.Arch
+	}
+	for k, v := range c.NodeSelector {
+		selector[k] = v
+	}
+	return selector
+}
+
+// the admin socket of the mon daemon in the pod, which is under the data dir passed to rookd
+func monAdminSocketPath(clusterInfo *mon.ClusterInfo, config *MonConfig) string {
+	return mon.GetMonAdminSocketPath(k8sutil.DataDir, clusterInfo.Name, config.Name)
+}
+
+func (c *Cluster) monContainer(config *MonConfig, clusterInfo *mon.ClusterInfo, bootstrap bool) v1.Container {
+	command := fmt.Sprintf("/usr/bin/rookd mon --data-dir=%s --name=%s --port=%d --fsid=%s --cluster-name=%s",
+		k8sutil.DataDir, config.Name, config.Port, clusterInfo.FSID, clusterInfo.Name)
+	if !bootstrap {
+		command += fmt.Sprintf(" --mon-endpoints=%s", MonEndpointString(clusterInfo))
+	}
+	if config.forceQuorum {
+		command += " --force-quorum"
+	}
+	if c.PublicNetwork != "" {
+		command += fmt.Sprintf(" --public-network=%s", c.PublicNetwork)
+	}
+	if config.V2Port != 0 {
+		command += fmt.Sprintf(" --v2-port=%d", config.V2Port)
+	}
+
+	volumeMounts := []v1.VolumeMount{
+		{Name: k8sutil.DataDirVolume, MountPath: k8sutil.DataDir},
+	}
+	if c.DisableServiceAccountToken {
+		volumeMounts = append(volumeMounts, v1.VolumeMount{Name: serviceAccountVolume, MountPath: serviceAccountTokenDir, ReadOnly: true})
+	}
+	if len(c.configSettings()) > 0 {
+		command += fmt.Sprintf(" --ceph-config-override=%s/%s", configOverrideDir, configOverrideKey)
+		volumeMounts = append(volumeMounts, v1.VolumeMount{Name: configOverrideVolumeName, MountPath: configOverrideDir})
+	}
+	if c.CABundleConfigMap != "" {
+		volumeMounts = append(volumeMounts, v1.VolumeMount{Name: caBundleVolumeName, MountPath: caBundleDir, ReadOnly: true})
+	}
+	if c.KeyringMountPath != "" {
+		// rookd writes the keyring from the mon secret to the mounted dir and starts the daemon with it
+		command += fmt.Sprintf(" --keyring=%s", c.KeyringMountPath)
+		volumeMounts = append(volumeMounts, v1.VolumeMount{Name: keyringVolumeName, MountPath: path.Dir(c.KeyringMountPath)})
+	}
+
+	container := v1.Container{
 		// TODO: fix "sleep 5".
 		// Without waiting some time, there is highly probable flakes in network setup.
-		Command: []string{"/bin/sh", "-c", fmt.Sprintf("sleep 5; %s", command)},
-		Name:    appName,
-		Image:   k8sutil.MakeRookImage(c.Version),
+		Command:         []string{"/bin/sh", "-c", fmt.Sprintf("sleep 5; %s", command)},
+		Name:            MonContainerName,
+		Image:           k8sutil.MakeRookImage(c.Version),
+		ImagePullPolicy: c.getImagePullPolicy(),
 		Ports: []v1.ContainerPort{
 			{
 				Name:          "client",
@@ -85,19 +306,127 @@ func (c *Cluster) monContainer(config *MonConfig, clusterInfo *mon.ClusterInfo)
 				Protocol:      v1.ProtocolTCP,
 			},
 		},
-		VolumeMounts: []v1.VolumeMount{
-			{Name: k8sutil.DataDirVolume, MountPath: k8sutil.DataDir},
-		},
-		Env: []v1.EnvVar{
-			{Name: k8sutil.PodIPEnvVar, ValueFrom: &v1.EnvVarSource{FieldRef: &v1.ObjectFieldSelector{FieldPath: "status.podIP"}}},
-			MonSecretEnvVar(),
-			AdminSecretEnvVar(),
+		VolumeMounts:  volumeMounts,
+		Resources:     c.monResources(config),
+		Env:           append(c.monEnv(), c.Env...),
+		LivenessProbe: c.livenessProbe(config),
+	}
+	if config.V2Port != 0 {
+		container.Ports = append(container.Ports, v1.ContainerPort{
+			Name:          "msgr2",
+			ContainerPort: config.V2Port,
+			Protocol:      v1.ProtocolTCP,
+		})
+	}
+	return container
+}
+
+// restart the mon when it stops accepting connections on its port
+func (c *Cluster) livenessProbe(config *MonConfig) *v1.Probe {
+	return &v1.Probe{
+		Handler: v1.Handler{
+			TCPSocket: &v1.TCPSocketAction{Port: intstr.FromInt(int(config.Port))},
 		},
+		InitialDelaySeconds: c.livenessInitialDelay(),
+		PeriodSeconds:       c.LivenessPeriodSeconds,
+		FailureThreshold:    c.LivenessFailureThreshold,
+	}
+}
+
+// the liveness probe waits for the startup grace period of the mon, which is never shorter than the default delay
+func (c *Cluster) livenessInitialDelay() int32 {
+	startup := c.StartupProbeFailureThreshold * startupPeriodSeconds
+	if startup < livenessInitialDelaySeconds {
+		return livenessInitialDelaySeconds
+	}
+	return startup
+}
+
+// the env vars rook requires in the mon container
+func (c *Cluster) monEnv() []v1.EnvVar {
+	env := []v1.EnvVar{
+		fieldRefEnvVar(k8sutil.PodIPEnvVar, "status.podIP"),
+		c.MonSecret().MonSecretEnvVar(),
+		c.MonSecret().AdminSecretEnvVar(),
+		// the identity of the mon for its entrypoint and logs
+		fieldRefEnvVar(podNameEnvVar, "metadata.name"),
+		fieldRefEnvVar(podNamespaceEnvVar, "metadata.namespace"),
+		fieldRefEnvVar(nodeNameEnvVar, "spec.nodeName"),
+		fieldRefEnvVar(podIPEnvVar, "status.podIP"),
+	}
+	if c.CABundleConfigMap != "" {
+		// openssl and go read the trusted certs from this file instead of the system bundle
+		env = append(env, v1.EnvVar{Name: caBundleEnvVar, Value: fmt.Sprintf("%s/%s", caBundleDir, caBundleKey)})
+	}
+	return env
+}
+
+// the user's env vars must not replace the env vars rook requires
+func (c *Cluster) validateEnv() error {
+	names := map[string]bool{}
+	for _, e := range c.monEnv() {
+		names[e.Name] = true
+	}
+	for _, e := range c.Env {
+		if names[e.Name] {
+			return fmt.Errorf("env var %s is duplicated or reserved by rook", e.Name)
+		}
+		names[e.Name] = true
+	}
+	return nil
+}
+
+// the topology key the mons are spread across
+func (c *Cluster) topologyKey() string {
+	if c.FailureDomainLabel != "" {
+		return c.FailureDomainLabel
+	}
+	return k8sutil.HostnameTopologyKey
+}
+
+func (c *Cluster) getImagePullPolicy() v1.PullPolicy {
+	if c.ImagePullPolicy != "" {
+		return c.ImagePullPolicy
+	}
+	if c.Version == "" || c.Version == "latest" {
+		return v1.PullAlways
+	}
+	return v1.PullIfNotPresent
+}
+
+func (c *Cluster) monResources(config *MonConfig) v1.ResourceRequirements {
+	resources := c.MonResources
+	if config.Resources != nil {
+		resources = *config.Resources
+	}
+	if c.GuaranteedQoS && !c.DevMode {
+		return guaranteedResources(resources)
 	}
+	return resources
 }
 
-func (c *Cluster) pollPods(clientset *kubernetes.Clientset, clusterName string) ([]*v1.Pod, []*v1.Pod, error) {
-	podList, err := clientset.Core().Pods(c.Namespace).List(listOptions(clusterName))
+// a pod is in the guaranteed qos class when its requests equal its limits. a resource with only a request
+// is limited to the request.
+func guaranteedResources(resources v1.ResourceRequirements) v1.ResourceRequirements {
+	if len(resources.Limits) == 0 && len(resources.Requests) == 0 {
+		return resources
+	}
+	limits := v1.ResourceList{}
+	for name, quantity := range resources.Requests {
+		limits[name] = quantity
+	}
+	for name, quantity := range resources.Limits {
+		limits[name] = quantity
+	}
+	requests := v1.ResourceList{}
+	for name, quantity := range limits {
+		requests[name] = quantity
+	}
+	return v1.ResourceRequirements{Limits: limits, Requests: requests}
+}
+
+func (c *Cluster) pollPods(clientset kubernetes.Interface, namespace, clusterName string) ([]*v1.Pod, []*v1.Pod, error) {
+	podList, err := clientset.Core().Pods(namespace).List(listOptions(clusterName))
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to list running pods: %v", err)
 	}
@@ -109,6 +438,9 @@ func (c *Cluster) pollPods(clientset *kubernetes.Clientset, clusterName string)
 
 		switch pod.Status.Phase {
 		case v1.PodRunning:
+			if monContainerDown(pod) {
+				logger.Warningf("pod %s is running but its mon container is not", pod.Name)
+			}
 			running = append(running, pod)
 		case v1.PodPending:
 			pending = append(pending, pod)
@@ -120,6 +452,53 @@ func (c *Cluster) pollPods(clientset *kubernetes.Clientset, clusterName string)
 	return running, pending, nil
 }
 
+// Update the labels on existing mon pods to match the desired labels. Pods created with an older
+// label scheme would otherwise fall out of the selectors. Only the app label is assumed to be stable. The pods of
+// another operator or of a cluster with another fsid are not relabeled as the pods of this cluster.
+func (c *Cluster) reconcileLabels(clientset kubernetes.Interface, clusterInfo *mon.ClusterInfo) error {
+	options := api.ListOptions{LabelSelector: labels.SelectorFromSet(map[string]string{k8sutil.AppAttr: appName})}
+	podList, err := clientset.Core().Pods(c.Namespace).List(options)
+	if err != nil {
+		return fmt.Errorf("failed to list mon pods. %+v", err)
+	}
+
+	desired := getLabels(clusterInfo.Name)
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		if labelsMatch(pod.Labels, desired) {
+			continue
+		}
+		if c.foreign(pod.ObjectMeta) {
+			continue
+		}
+		if fsid, ok := pod.Annotations[fsidAnnotation]; ok && fsid != clusterInfo.FSID {
+			continue
+		}
+
+		if pod.Labels == nil {
+			pod.Labels = map[string]string{}
+		}
+		for k, v := range desired {
+			pod.Labels[k] = v
+		}
+		logger.Infof("updating labels on mon pod %s", pod.Name)
+		if _, err := clientset.Core().Pods(c.Namespace).Update(pod); err != nil {
+			return fmt.Errorf("failed to update labels on mon pod %s. %+v", pod.Name, err)
+		}
+	}
+	return nil
+}
+
+// whether all the desired labels are set with the desired values
+func labelsMatch(actual, desired map[string]string) bool {
+	for k, v := range desired {
+		if actual[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
 func listOptions(clusterName string) api.ListOptions {
 	return api.ListOptions{
 		LabelSelector: labels.SelectorFromSet(map[string]string{
@@ -128,3 +507,27 @@ func listOptions(clusterName string) api.ListOptions {
 		}),
 	}
 }
+
+// Delete the mon pods that were created for a cluster with a different fsid, for example by a previous cluster
+// in the same namespace. The pods of the current cluster are returned. Pods created before the fsid annotation
+// was introduced are assumed to belong to the current cluster.
+func (c *Cluster) removeForeignPods(clientset kubernetes.Interface, clusterInfo *mon.ClusterInfo, pods []*v1.Pod) ([]*v1.Pod, error) {
+	current := []*v1.Pod{}
+	for _, pod := range pods {
+		fsid, ok := pod.Annotations[fsidAnnotation]
+		if !ok || fsid == clusterInfo.FSID {
+			current = append(current, pod)
+			continue
+		}
+
+		logger.Warningf("deleting mon pod %s that belongs to a cluster with fsid %s", pod.Name, fsid)
+		err := clientset.Core().Pods(c.Namespace).Delete(pod.Name, &api.DeleteOptions{})
+		if err != nil && !k8sutil.IsKubernetesResourceNotFoundError(err) {
+			return nil, fmt.Errorf("failed to delete foreign mon pod %s. %+v", pod.Name, err)
+		}
+		if err := c.waitForPodToDelete(clientset, pod.Name); err != nil {
+			return nil, err
+		}
+	}
+	return current, nil
+}
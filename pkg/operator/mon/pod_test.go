@@ -0,0 +1,504 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rook/rook/pkg/cephmgr/mon"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"github.com/rook/rook/pkg/version"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/1.5/kubernetes/fake"
+	"k8s.io/client-go/1.5/pkg/api"
+	"k8s.io/client-go/1.5/pkg/api/resource"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+	"k8s.io/client-go/1.5/pkg/runtime"
+	core "k8s.io/client-go/1.5/testing"
+)
+
+func testClusterInfo() *mon.ClusterInfo {
+	return &mon.ClusterInfo{
+		Name:          "rookcluster",
+		FSID:          "22ae0d50-c4bc-4cfb-9cf4-341acbe35302",
+		MonitorSecret: "monsecret",
+		AdminSecret:   "adminsecret",
+		Monitors:      map[string]*mon.CephMonitorConfig{},
+	}
+}
+
+func TestMonPodV2Port(t *testing.T) {
+	c := New("ns", nil, "myversion")
+	container := c.makeMonPod(&MonConfig{Name: "mon0", Port: 6790}, testClusterInfo(), true, false).Spec.Containers[0]
+	assert.Equal(t, 1, len(container.Ports))
+	assert.False(t, strings.Contains(container.Command[2], "--v2-port"))
+
+	// the mon listens on both ports
+	container = c.makeMonPod(&MonConfig{Name: "mon0", Port: 6790, V2Port: 3300}, testClusterInfo(), true, false).Spec.Containers[0]
+	assert.Equal(t, 2, len(container.Ports))
+	assert.Equal(t, "client", container.Ports[0].Name)
+	assert.Equal(t, int32(6790), container.Ports[0].ContainerPort)
+	assert.Equal(t, "msgr2", container.Ports[1].Name)
+	assert.Equal(t, int32(3300), container.Ports[1].ContainerPort)
+	assert.True(t, strings.Contains(container.Command[2], "--v2-port=3300"))
+}
+
+func TestMonPodDNSPolicy(t *testing.T) {
+	c := New("ns", nil, "myversion")
+	config := &MonConfig{Name: "mon0", Port: 6790}
+
+	pod := c.makeMonPod(config, testClusterInfo(), true, false)
+	assert.False(t, pod.Spec.HostNetwork)
+	assert.Equal(t, v1.DNSClusterFirst, pod.Spec.DNSPolicy)
+
+	// the host network requires the special policy to resolve cluster names
+	c.HostNetwork = true
+	pod = c.makeMonPod(config, testClusterInfo(), true, false)
+	assert.True(t, pod.Spec.HostNetwork)
+	assert.Equal(t, dnsClusterFirstWithHostNet, pod.Spec.DNSPolicy)
+
+	// an explicit policy always wins
+	c.DNSPolicy = v1.DNSDefault
+	pod = c.makeMonPod(config, testClusterInfo(), true, false)
+	assert.Equal(t, v1.DNSDefault, pod.Spec.DNSPolicy)
+}
+
+func TestMonPodSubdomain(t *testing.T) {
+	c := New("ns", nil, "myversion")
+	config := &MonConfig{Name: "mon0", Port: 6790}
+
+	pod := c.makeMonPod(config, testClusterInfo(), true, false)
+	assert.Equal(t, "", pod.Spec.Hostname)
+	assert.Equal(t, "", pod.Spec.Subdomain)
+	assert.Equal(t, "1.2.3.4", c.monHost("ns", "mon0", "1.2.3.4"))
+
+	c.Subdomain = "rook-mon"
+	pod = c.makeMonPod(config, testClusterInfo(), true, false)
+	assert.Equal(t, "mon0", pod.Spec.Hostname)
+	assert.Equal(t, "rook-mon", pod.Spec.Subdomain)
+	assert.Equal(t, "mon0.rook-mon.ns.svc", c.monHost("ns", "mon0", "1.2.3.4"))
+}
+
+func TestMonPodResources(t *testing.T) {
+	c := New("ns", nil, "myversion")
+	c.MonResources = v1.ResourceRequirements{
+		Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse("1Gi")},
+	}
+
+	// the cluster default applies to all mons
+	pod := c.makeMonPod(&MonConfig{Name: "mon0", Port: 6790}, testClusterInfo(), true, false)
+	memory := pod.Spec.Containers[0].Resources.Limits[v1.ResourceMemory]
+	assert.Equal(t, "1Gi", memory.String())
+
+	// the per-mon override takes precedence
+	override := &v1.ResourceRequirements{
+		Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse("4Gi")},
+	}
+	pod = c.makeMonPod(&MonConfig{Name: "mon1", Port: 6790, Resources: override}, testClusterInfo(), true, false)
+	memory = pod.Spec.Containers[0].Resources.Limits[v1.ResourceMemory]
+	assert.Equal(t, "4Gi", memory.String())
+}
+
+func TestReconcileLabels(t *testing.T) {
+	// a mon pod created with an older label scheme that is missing the cluster label
+	stale := &v1.Pod{ObjectMeta: v1.ObjectMeta{Name: "mon0", Namespace: "ns", Labels: map[string]string{"app": "mon", "foo": "bar"}}}
+	clientset := fake.NewSimpleClientset(stale)
+	c := New("ns", nil, "myversion")
+
+	err := c.reconcileLabels(clientset, testClusterInfo())
+	assert.Nil(t, err)
+
+	pod, err := clientset.Core().Pods("ns").Get("mon0")
+	assert.Nil(t, err)
+	assert.Equal(t, "rookcluster", pod.Labels[monClusterAttr])
+	assert.Equal(t, "mon", pod.Labels["app"])
+	assert.Equal(t, "bar", pod.Labels["foo"])
+
+	// the pod is now found by the mon selector
+	list, err := clientset.Core().Pods("ns").List(listOptions("rookcluster"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(list.Items))
+
+	// the pods of another operator or another cluster keep their labels
+	otherOperator := &v1.Pod{ObjectMeta: v1.ObjectMeta{Name: "mon1", Namespace: "ns", Labels: map[string]string{"app": "mon"},
+		Annotations: map[string]string{operatorIDAnnotation: "other"}}}
+	otherCluster := &v1.Pod{ObjectMeta: v1.ObjectMeta{Name: "mon2", Namespace: "ns", Labels: map[string]string{"app": "mon"},
+		Annotations: map[string]string{fsidAnnotation: "8f3b2b4e-0c0e-4b8e-9a3e-5c6d7e8f9a0b"}}}
+	clientset = fake.NewSimpleClientset(otherOperator, otherCluster)
+	err = c.reconcileLabels(clientset, testClusterInfo())
+	assert.Nil(t, err)
+	for _, name := range []string{"mon1", "mon2"} {
+		pod, err := clientset.Core().Pods("ns").Get(name)
+		assert.Nil(t, err)
+		assert.Equal(t, "", pod.Labels[monClusterAttr], name)
+	}
+}
+
+func TestMonPodImagePullPolicy(t *testing.T) {
+	config := &MonConfig{Name: "mon0", Port: 6790}
+
+	c := New("ns", nil, "v0.3.0")
+	pod := c.makeMonPod(config, testClusterInfo(), true, false)
+	assert.Equal(t, v1.PullIfNotPresent, pod.Spec.Containers[0].ImagePullPolicy)
+
+	c = New("ns", nil, "latest")
+	pod = c.makeMonPod(config, testClusterInfo(), true, false)
+	assert.Equal(t, v1.PullAlways, pod.Spec.Containers[0].ImagePullPolicy)
+
+	c.ImagePullPolicy = v1.PullNever
+	pod = c.makeMonPod(config, testClusterInfo(), true, false)
+	assert.Equal(t, v1.PullNever, pod.Spec.Containers[0].ImagePullPolicy)
+}
+
+func TestMonPodImageDigest(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("0a", 32)
+	c := New("ns", nil, digest)
+	pod := c.makeMonPod(&MonConfig{Name: "mon0", Port: 6790}, testClusterInfo(), true, false)
+	assert.Equal(t, "quay.io/rook/rookd@"+digest, pod.Spec.Containers[0].Image)
+	assert.Equal(t, v1.PullIfNotPresent, pod.Spec.Containers[0].ImagePullPolicy)
+
+	// a malformed digest is rejected before any mon is started
+	c, _ = newTestHealthCluster(map[string]string{"mon_status": allInQuorumResponse})
+	c.Version = "sha256:abc"
+	clientset := fake.NewSimpleClientset(testMonSecret("ns"))
+	_, _, err := c.EnsureMons(clientset)
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, len(podRestarts(clientset)))
+}
+
+func TestMonPodFailureDomain(t *testing.T) {
+	c := New("ns", nil, "myversion")
+	config := &MonConfig{Name: "mon0", Port: 6790}
+	pod := c.makeMonPod(config, testClusterInfo(), true, false)
+	assert.True(t, strings.Contains(pod.Annotations[api.AffinityAnnotationKey], `"topologyKey":"kubernetes.io/hostname"`))
+
+	// the mons are spread across the zones instead of the nodes
+	c.FailureDomainLabel = "failure-domain.beta.kubernetes.io/zone"
+	pod = c.makeMonPod(config, testClusterInfo(), true, false)
+	assert.True(t, strings.Contains(pod.Annotations[api.AffinityAnnotationKey], `"topologyKey":"failure-domain.beta.kubernetes.io/zone"`))
+}
+
+func TestMonPodOperatorVersion(t *testing.T) {
+	c := New("ns", nil, "myversion")
+	assert.Equal(t, version.Version, c.OperatorVersion)
+
+	c.OperatorVersion = "v0.4.0"
+	pod := c.makeMonPod(&MonConfig{Name: "mon0", Port: 6790}, testClusterInfo(), true, false)
+	assert.Equal(t, "v0.4.0", pod.Annotations[operatorVersionAnnotation])
+}
+
+func TestMonPodNodeSelector(t *testing.T) {
+	config := &MonConfig{Name: "mon0", Port: 6790}
+	c := New("ns", nil, "myversion")
+
+	pod := c.makeMonPod(config, testClusterInfo(), true, false)
+	assert.Equal(t, map[string]string{"beta.kubernetes.io/os": "linux"}, pod.Spec.NodeSelector)
+
+	c.Arch = "amd64"
+	pod = c.makeMonPod(config, testClusterInfo(), true, false)
+	assert.Equal(t, "amd64", pod.Spec.NodeSelector["beta.kubernetes.io/arch"])
+
+	// the user's selector overrides the defaults
+	c.NodeSelector = map[string]string{"beta.kubernetes.io/os": "custom", "storage": "true"}
+	pod = c.makeMonPod(config, testClusterInfo(), true, false)
+	assert.Equal(t, "custom", pod.Spec.NodeSelector["beta.kubernetes.io/os"])
+	assert.Equal(t, "true", pod.Spec.NodeSelector["storage"])
+	assert.Equal(t, 3, len(pod.Spec.NodeSelector))
+}
+
+func TestMonPodEnv(t *testing.T) {
+	c := New("ns", nil, "myversion")
+	c.Env = []v1.EnvVar{{Name: "CEPH_ARGS", Value: "--debug-mon=10"}, {Name: "HTTP_PROXY", Value: "http://proxy"}}
+	assert.Nil(t, c.validateEnv())
+
+	pod := c.makeMonPod(&MonConfig{Name: "mon0", Port: 6790}, testClusterInfo(), true, false)
+	env := pod.Spec.Containers[0].Env
+	assert.Equal(t, 9, len(env))
+	assert.Equal(t, "ROOKD_MON_SECRET", env[1].Name)
+	assert.Equal(t, "CEPH_ARGS", env[7].Name)
+	assert.Equal(t, "http://proxy", env[8].Value)
+
+	// rook's env vars cannot be replaced
+	c.Env = []v1.EnvVar{{Name: "ROOKD_MON_SECRET", Value: "mysecret"}}
+	assert.NotNil(t, c.validateEnv())
+	c.Env = []v1.EnvVar{{Name: "FOO", Value: "1"}, {Name: "FOO", Value: "2"}}
+	assert.NotNil(t, c.validateEnv())
+}
+
+func TestMonPodDownwardAPIEnv(t *testing.T) {
+	c := New("ns", nil, "myversion")
+	pod := c.makeMonPod(&MonConfig{Name: "mon0", Port: 6790}, testClusterInfo(), true, false)
+
+	fields := map[string]string{}
+	for _, e := range pod.Spec.Containers[0].Env {
+		if e.ValueFrom != nil && e.ValueFrom.FieldRef != nil {
+			fields[e.Name] = e.ValueFrom.FieldRef.FieldPath
+		}
+	}
+	assert.Equal(t, "metadata.name", fields["POD_NAME"])
+	assert.Equal(t, "metadata.namespace", fields["POD_NAMESPACE"])
+	assert.Equal(t, "spec.nodeName", fields["NODE_NAME"])
+	assert.Equal(t, "status.podIP", fields["POD_IP"])
+
+	// the downward api env vars are reserved
+	c.Env = []v1.EnvVar{{Name: "NODE_NAME", Value: "node0"}}
+	assert.NotNil(t, c.validateEnv())
+}
+
+func TestMonPodServiceAccountToken(t *testing.T) {
+	config := &MonConfig{Name: "mon0", Port: 6790}
+	c := New("ns", nil, "myversion")
+
+	pod := c.makeMonPod(config, testClusterInfo(), true, false)
+	assert.Equal(t, 1, len(pod.Spec.Volumes))
+	assert.Equal(t, 1, len(pod.Spec.Containers[0].VolumeMounts))
+
+	// an empty volume is mounted over the token path
+	c.DisableServiceAccountToken = true
+	pod = c.makeMonPod(config, testClusterInfo(), true, false)
+	assert.Equal(t, 2, len(pod.Spec.Volumes))
+	assert.NotNil(t, pod.Spec.Volumes[1].EmptyDir)
+	mount := pod.Spec.Containers[0].VolumeMounts[1]
+	assert.Equal(t, pod.Spec.Volumes[1].Name, mount.Name)
+	assert.Equal(t, "/var/run/secrets/kubernetes.io/serviceaccount", mount.MountPath)
+}
+
+func TestMonPodSpecMutator(t *testing.T) {
+	c := New("ns", nil, "myversion")
+	c.HostNetwork = true
+	c.PodSpecMutator = func(pod *v1.Pod) {
+		pod.Spec.ServiceAccountName = "rook-mon"
+		pod.Annotations["custom"] = "value"
+		// the mutator sees the fields rook has already set
+		pod.Spec.HostNetwork = !pod.Spec.HostNetwork
+	}
+
+	clientset := fake.NewSimpleClientset()
+	startCreatedPods(clientset)
+	c.PodStartDelay = time.Millisecond
+	_, err := c.startPods(clientset, testClusterInfo(), []*MonConfig{{Name: "mon0", Port: 6790}})
+	assert.Nil(t, err)
+
+	pod, err := clientset.Core().Pods("ns").Get("mon0")
+	assert.Nil(t, err)
+	assert.Equal(t, "rook-mon", pod.Spec.ServiceAccountName)
+	assert.Equal(t, "value", pod.Annotations["custom"])
+	assert.False(t, pod.Spec.HostNetwork)
+	assert.Equal(t, "myversion", pod.Annotations[k8sutil.VersionAttr])
+}
+
+func TestMonPodGuaranteedQoS(t *testing.T) {
+	config := &MonConfig{Name: "mon0", Port: 6790}
+	c := New("ns", nil, "myversion")
+	c.MonResources = v1.ResourceRequirements{
+		Limits:   v1.ResourceList{v1.ResourceMemory: resource.MustParse("1Gi"), v1.ResourceCPU: resource.MustParse("1")},
+		Requests: v1.ResourceList{v1.ResourceMemory: resource.MustParse("512Mi"), v1.ResourceCPU: resource.MustParse("500m")},
+	}
+
+	// the requests are raised to the limits
+	resources := c.makeMonPod(config, testClusterInfo(), true, false).Spec.Containers[0].Resources
+	for _, name := range []v1.ResourceName{v1.ResourceMemory, v1.ResourceCPU} {
+		limit := resources.Limits[name]
+		request := resources.Requests[name]
+		assert.Equal(t, limit.String(), request.String(), string(name))
+	}
+	memory := resources.Requests[v1.ResourceMemory]
+	assert.Equal(t, "1Gi", memory.String())
+
+	// a resource with only a request is limited to the request
+	c.MonResources = v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceMemory: resource.MustParse("2Gi")}}
+	resources = c.makeMonPod(config, testClusterInfo(), true, false).Spec.Containers[0].Resources
+	memory = resources.Limits[v1.ResourceMemory]
+	assert.Equal(t, "2Gi", memory.String())
+
+	// the mons keep burstable resources when disabled
+	c.GuaranteedQoS = false
+	resources = c.makeMonPod(config, testClusterInfo(), true, false).Spec.Containers[0].Resources
+	assert.Equal(t, 0, len(resources.Limits))
+
+	// no resources are added when none are set
+	c.GuaranteedQoS = true
+	c.MonResources = v1.ResourceRequirements{}
+	resources = c.makeMonPod(config, testClusterInfo(), true, false).Spec.Containers[0].Resources
+	assert.Equal(t, 0, len(resources.Limits))
+	assert.Equal(t, 0, len(resources.Requests))
+}
+
+func TestMonAdminSocketPath(t *testing.T) {
+	c := New("ns", nil, "myversion")
+	config := &MonConfig{Name: "mon1", Port: 6790}
+	info := testClusterInfo()
+
+	// the socket is under the data dir that the mon container is started with
+	pod := c.makeMonPod(config, info, true, false)
+	assert.Contains(t, pod.Spec.Containers[0].Command[2], "--data-dir="+k8sutil.DataDir)
+	assert.Equal(t, k8sutil.DataDir+"/mon1/rookcluster-mon.mon1.asok", monAdminSocketPath(info, config))
+}
+
+func TestMonPodLivenessProbe(t *testing.T) {
+	config := &MonConfig{Name: "mon0", Port: 6790}
+	c := New("ns", nil, "myversion")
+
+	probe := c.makeMonPod(config, testClusterInfo(), true, false).Spec.Containers[0].LivenessProbe
+	if assert.NotNil(t, probe) {
+		assert.Equal(t, 6790, probe.TCPSocket.Port.IntValue())
+		assert.Equal(t, int32(5), probe.FailureThreshold)
+		assert.Equal(t, int32(30), probe.PeriodSeconds)
+	}
+
+	c.LivenessFailureThreshold = 10
+	c.LivenessPeriodSeconds = 60
+	probe = c.makeMonPod(config, testClusterInfo(), true, false).Spec.Containers[0].LivenessProbe
+	assert.Equal(t, int32(10), probe.FailureThreshold)
+	assert.Equal(t, int32(60), probe.PeriodSeconds)
+}
+
+func TestMonPodStartupGracePeriod(t *testing.T) {
+	config := &MonConfig{Name: "mon0", Port: 6790}
+	c := New("ns", nil, "myversion")
+	probe := c.makeMonPod(config, testClusterInfo(), true, false).Spec.Containers[0].LivenessProbe
+	assert.Equal(t, int32(60), probe.InitialDelaySeconds)
+
+	// the liveness probe defers to the startup grace period
+	c.StartupProbeFailureThreshold = 30
+	probe = c.makeMonPod(config, testClusterInfo(), true, false).Spec.Containers[0].LivenessProbe
+	assert.Equal(t, int32(300), probe.InitialDelaySeconds)
+	assert.Equal(t, int32(5), probe.FailureThreshold)
+
+	// a short grace period does not shorten the default delay
+	c.StartupProbeFailureThreshold = 3
+	probe = c.makeMonPod(config, testClusterInfo(), true, false).Spec.Containers[0].LivenessProbe
+	assert.Equal(t, int32(60), probe.InitialDelaySeconds)
+}
+
+func TestMonPodBootstrapArgs(t *testing.T) {
+	c := New("ns", nil, "myversion")
+	config := &MonConfig{Name: "mon1", Port: 6790}
+	info := testClusterInfo()
+	info.Monitors["mon0"] = mon.ToCephMon("mon0", "1.2.3.4")
+
+	// the bootstrap mon creates the monmap with only itself
+	command := c.makeMonPod(config, info, true, true).Spec.Containers[0].Command[2]
+	assert.NotContains(t, command, "--mon-endpoints")
+	assert.Contains(t, command, "--name=mon1")
+
+	// a joining mon is given the mons in the cluster
+	command = c.makeMonPod(config, info, true, false).Spec.Containers[0].Command[2]
+	assert.Contains(t, command, "--mon-endpoints=mon0=1.2.3.4:6790")
+}
+
+func TestStartPodsBootstrapFirst(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	startCreatedPods(clientset)
+	c := New("ns", nil, "myversion")
+	c.PodStartDelay = time.Millisecond
+	c.MaxConcurrentPodOps = 3
+	mons := []*MonConfig{{Name: "mon0", Port: 6790}, {Name: "mon1", Port: 6790}, {Name: "mon2", Port: 6790}}
+
+	_, err := c.startPods(clientset, testClusterInfo(), mons)
+	assert.Nil(t, err)
+
+	// only the first mon of a new cluster bootstraps, even when the mons are created in parallel
+	pod, err := clientset.Core().Pods("ns").Get("mon0")
+	assert.Nil(t, err)
+	assert.NotContains(t, pod.Spec.Containers[0].Command[2], "--mon-endpoints")
+	for _, name := range []string{"mon1", "mon2"} {
+		pod, err := clientset.Core().Pods("ns").Get(name)
+		assert.Nil(t, err)
+		assert.Contains(t, pod.Spec.Containers[0].Command[2], "--mon-endpoints=mon0=10.0.0.1:6790", name)
+	}
+}
+
+func TestStartPodsBootstrapOnce(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	bootstrapped := []string{}
+	clientset.PrependReactor("create", "pods", func(action core.Action) (bool, runtime.Object, error) {
+		pod := action.(core.CreateAction).GetObject().(*v1.Pod)
+		if !strings.Contains(pod.Spec.Containers[0].Command[2], "--mon-endpoints") {
+			bootstrapped = append(bootstrapped, pod.Name)
+		}
+		if pod.Name != "mon0" {
+			pod.Status.Phase = v1.PodRunning
+			pod.Status.PodIP = "10.0.0.1"
+		}
+		return false, nil, nil
+	})
+	c := New("ns", nil, "myversion")
+	c.PodStartRetries = 2
+	c.PodStartDelay = time.Millisecond
+	mons := []*MonConfig{{Name: "mon0", Port: 6790}, {Name: "mon1", Port: 6790}, {Name: "mon2", Port: 6790}}
+
+	// mon0 never starts. mon1 must not bootstrap a second monmap.
+	_, err := c.startPods(clientset, testClusterInfo(), mons)
+	assert.NotNil(t, err)
+	assert.Equal(t, []string{"mon0"}, bootstrapped)
+}
+
+func TestMonPodCABundle(t *testing.T) {
+	config := &MonConfig{Name: "mon0", Port: 6790}
+	c := New("ns", nil, "myversion")
+	pod := c.makeMonPod(config, testClusterInfo(), true, false)
+	assert.Equal(t, 1, len(pod.Spec.Volumes))
+
+	c.CABundleConfigMap = "corp-ca"
+	pod = c.makeMonPod(config, testClusterInfo(), true, false)
+	if assert.Equal(t, 2, len(pod.Spec.Volumes)) {
+		assert.Equal(t, "corp-ca", pod.Spec.Volumes[1].ConfigMap.Name)
+	}
+	container := pod.Spec.Containers[0]
+	mount := container.VolumeMounts[len(container.VolumeMounts)-1]
+	assert.Equal(t, pod.Spec.Volumes[1].Name, mount.Name)
+	assert.Equal(t, "/etc/rook/ca", mount.MountPath)
+	env := container.Env[len(c.monEnv())-1]
+	assert.Equal(t, "SSL_CERT_FILE", env.Name)
+	assert.Equal(t, "/etc/rook/ca/ca.crt", env.Value)
+}
+
+func TestMonPodKeyringMountPath(t *testing.T) {
+	config := &MonConfig{Name: "mon0", Port: 6790}
+	c := New("ns", nil, "myversion")
+	container := c.makeMonPod(config, testClusterInfo(), true, false).Spec.Containers[0]
+	assert.False(t, strings.Contains(container.Command[2], "--keyring"))
+	assert.Nil(t, c.validateKeyringMountPath())
+
+	c.KeyringMountPath = "/etc/ceph/keyring"
+	assert.Nil(t, c.validateKeyringMountPath())
+	pod := c.makeMonPod(config, testClusterInfo(), true, false)
+	container = pod.Spec.Containers[0]
+	if assert.Equal(t, 2, len(pod.Spec.Volumes)) {
+		assert.NotNil(t, pod.Spec.Volumes[1].EmptyDir)
+	}
+
+	// the daemon is started with the keyring in the mounted dir
+	arg := ""
+	for _, a := range strings.Fields(container.Command[2]) {
+		if strings.HasPrefix(a, "--keyring=") {
+			arg = strings.TrimPrefix(a, "--keyring=")
+		}
+	}
+	mount := container.VolumeMounts[len(container.VolumeMounts)-1]
+	assert.Equal(t, pod.Spec.Volumes[1].Name, mount.Name)
+	assert.Equal(t, "/etc/ceph", mount.MountPath)
+	assert.Equal(t, mount.MountPath+"/keyring", arg)
+
+	// the path must be a file outside of the dirs rook mounts
+	for _, p := range []string{"keyring", "/etc/ceph/", "/keyring", "/var/lib/rook/keyring", "/etc/rook/ca/keyring"} {
+		c.KeyringMountPath = p
+		assert.NotNil(t, c.validateKeyringMountPath(), p)
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"fmt"
+
+	"github.com/rook/rook/pkg/cephmgr/client"
+	"github.com/rook/rook/pkg/cephmgr/mon"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/client-go/1.5/kubernetes"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+)
+
+const (
+	storageClassSecretName = "rook-admin"
+
+	// ProvisionerUser is the ceph user of the restricted key. Storage classes must set it as their user id.
+	ProvisionerUser = "rook-provisioner"
+)
+
+// save the key used by the storage class
+func (c *Cluster) saveStorageClassSecret(clientset kubernetes.Interface, key string) error {
+	secret := &v1.Secret{
+		ObjectMeta: v1.ObjectMeta{Name: storageClassSecretName, Namespace: c.Namespace},
+		StringData: map[string]string{"key": key},
+		Type:       k8sutil.RbdType,
+	}
+
+	_, err := clientset.Core().Secrets(c.Namespace).Create(secret)
+	if err == nil {
+		logger.Infof("saved %s secret", storageClassSecretName)
+		return nil
+	}
+	if !k8sutil.IsKubernetesResourceAlreadyExistError(err) {
+		return fmt.Errorf("failed to save %s secret. %+v", storageClassSecretName, err)
+	}
+
+	existing, err := clientset.Core().Secrets(c.Namespace).Get(storageClassSecretName)
+	if err != nil {
+		return fmt.Errorf("failed to get %s secret. %+v", storageClassSecretName, err)
+	}
+	if string(existing.Data["key"]) == key || existing.StringData["key"] == key {
+		logger.Infof("%s secret already exists", storageClassSecretName)
+		return nil
+	}
+	if _, err := clientset.Core().Secrets(c.Namespace).Update(secret); err != nil {
+		return fmt.Errorf("failed to update %s secret. %+v", storageClassSecretName, err)
+	}
+	logger.Infof("updated %s secret", storageClassSecretName)
+	return nil
+}
+
+// create the restricted provisioner key and save it for the storage class. the mons must be in quorum.
+func (c *Cluster) saveProvisionerKey(clientset kubernetes.Interface, clusterInfo *mon.ClusterInfo) error {
+	if len(c.ProvisionerCaps) == 0 {
+		return nil
+	}
+
+	conn, err := c.connect(clusterInfo)
+	if err != nil {
+		return err
+	}
+	defer conn.Shutdown()
+
+	key, err := client.AuthGetOrCreateKey(conn, "client."+ProvisionerUser, c.ProvisionerCaps)
+	if err != nil {
+		return fmt.Errorf("failed to create the provisioner key. %+v", err)
+	}
+	return c.saveStorageClassSecret(clientset, key)
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/1.5/kubernetes/fake"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+)
+
+func TestProvisionerKey(t *testing.T) {
+	// a cluster with mons that are already running
+	clientset := fake.NewSimpleClientset(
+		testMonSecret("ns"),
+		testMonPod("mon0", "ns", "1.2.3.4", v1.PodRunning),
+		testMonPod("mon1", "ns", "1.2.3.5", v1.PodRunning),
+		testMonPod("mon2", "ns", "1.2.3.6", v1.PodRunning))
+	c, _ := newTestHealthCluster(map[string]string{
+		"mon_status":             allInQuorumResponse,
+		"auth get-or-create-key": `{"key":"provisionerkey"}`,
+	})
+	c.ProvisionerCaps = []string{"mon", "allow r", "osd", "allow rwx pool=rbd"}
+
+	info, _, err := c.EnsureMons(clientset)
+	assert.Nil(t, err)
+
+	// the storage class secret has the restricted key instead of the admin key
+	secret, err := clientset.Core().Secrets("ns").Get(storageClassSecretName)
+	assert.Nil(t, err)
+	assert.Equal(t, "provisionerkey", secret.StringData["key"])
+	assert.NotEqual(t, info.AdminSecret, secret.StringData["key"])
+
+	// without caps the admin key of a new cluster is used
+	clientset = fake.NewSimpleClientset()
+	startCreatedPods(clientset)
+	c, _ = newTestHealthCluster(map[string]string{"mon_status": allInQuorumResponse})
+	c.Size = 1
+	c.PodStartDelay = time.Millisecond
+	info, _, err = c.EnsureMons(clientset)
+	assert.Nil(t, err)
+	secret, err = clientset.Core().Secrets("ns").Get(storageClassSecretName)
+	assert.Nil(t, err)
+	assert.Equal(t, info.AdminSecret, secret.StringData["key"])
+}
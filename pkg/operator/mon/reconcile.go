@@ -0,0 +1,176 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/rook/rook/pkg/cephmgr/client"
+	"github.com/rook/rook/pkg/cephmgr/mon"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"golang.org/x/net/context"
+	"k8s.io/client-go/1.5/kubernetes"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+)
+
+const (
+	// StatusConfigMapName is the config map where the result of the last reconcile is written
+	StatusConfigMapName = "rook-ceph-mon-status"
+)
+
+// ErrReconcileDeadlineExceeded is returned by Reconcile when the mons did not reach the desired state within the
+// ReconcileDeadline. Retrying right away is not likely to succeed.
+var ErrReconcileDeadlineExceeded = errors.New("the mon reconcile deadline was exceeded")
+
+// ReconcileResult is the state of the mons after a reconcile
+type ReconcileResult struct {
+	// Requeue is how soon the caller should reconcile again. Zero when the mons are in steady state.
+	Requeue  time.Duration
+	Running  int
+	Pending  int
+	InQuorum bool
+	// Health is the overall ceph health, or empty if it could not be retrieved
+	Health string
+	// Error is why the reconcile stopped at the deadline. Empty when the reconcile finished.
+	Error string
+}
+
+// Reconcile brings the mons to the desired state and reports the result. This is the entry point for a
+// controller that reconciles repeatedly. Start remains the one-shot way to start the mons.
+func (c *Cluster) Reconcile(ctx context.Context, clientset kubernetes.Interface) (ReconcileResult, error) {
+	result := ReconcileResult{}
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+
+	c.startDeadline()
+	defer c.clearDeadline()
+
+	clusterInfo, requeue, err := c.EnsureMons(clientset)
+	if err != nil {
+		if !c.deadlineExceeded() {
+			return result, err
+		}
+		logger.Errorf("the mons did not reconcile within %v. %+v", c.ReconcileDeadline, err)
+		result.Error = err.Error()
+		if err := c.writeStatus(clientset, "", result); err != nil {
+			logger.Warningf("failed to write the mon status. %+v", err)
+		}
+		return result, ErrReconcileDeadlineExceeded
+	}
+	result.Requeue = requeue
+	result.InQuorum = requeue == 0
+
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+
+	result.Running, result.Pending, err = c.GetMonPodsRunning(clientset, clusterInfo.Name)
+	if err != nil {
+		return result, err
+	}
+
+	if result.InQuorum {
+		health, err := c.getHealth(clusterInfo)
+		if err != nil {
+			logger.Warningf("failed to get ceph health. %+v", err)
+		}
+		result.Health = health
+	}
+
+	if err := c.writeStatus(clientset, clusterInfo.Name, result); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+func (c *Cluster) getHealth(clusterInfo *mon.ClusterInfo) (string, error) {
+	conn, err := c.connect(clusterInfo)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Shutdown()
+
+	status, err := client.Status(conn)
+	if err != nil {
+		return "", fmt.Errorf("failed to get ceph status. %+v", err)
+	}
+	return status.Health.OverallStatus, nil
+}
+
+// write the reconcile result to the status config map. the cluster name is empty when the reconcile failed before
+// the cluster info was loaded.
+func (c *Cluster) writeStatus(clientset kubernetes.Interface, clusterName string, result ReconcileResult) error {
+	configMap := &v1.ConfigMap{
+		ObjectMeta: v1.ObjectMeta{
+			Name:            StatusConfigMapName,
+			Namespace:       c.Namespace,
+			Labels:          getLabels(clusterName),
+			Annotations:     c.operatorAnnotations(),
+			OwnerReferences: c.ownerReferences(),
+		},
+		Data: map[string]string{
+			"running":  strconv.Itoa(result.Running),
+			"pending":  strconv.Itoa(result.Pending),
+			"inQuorum": strconv.FormatBool(result.InQuorum),
+			"health":   result.Health,
+			"error":    result.Error,
+		},
+	}
+
+	_, err := clientset.Core().ConfigMaps(c.Namespace).Create(configMap)
+	if err == nil {
+		return nil
+	}
+	if !k8sutil.IsKubernetesResourceAlreadyExistError(err) {
+		return fmt.Errorf("failed to create mon status. %+v", err)
+	}
+	existing, err := clientset.Core().ConfigMaps(c.Namespace).Get(StatusConfigMapName)
+	if err != nil {
+		return fmt.Errorf("failed to get mon status. %+v", err)
+	}
+	if c.foreign(existing.ObjectMeta) {
+		return nil
+	}
+	if _, err := clientset.Core().ConfigMaps(c.Namespace).Update(configMap); err != nil {
+		return fmt.Errorf("failed to update mon status. %+v", err)
+	}
+	return nil
+}
+
+// start the deadline of a reconcile. the waits for the mons stop retrying once it passes.
+func (c *Cluster) startDeadline() {
+	c.deadlineLock.Lock()
+	defer c.deadlineLock.Unlock()
+	if c.ReconcileDeadline > 0 {
+		c.deadline = time.Now().Add(c.ReconcileDeadline)
+	}
+}
+
+func (c *Cluster) clearDeadline() {
+	c.deadlineLock.Lock()
+	defer c.deadlineLock.Unlock()
+	c.deadline = time.Time{}
+}
+
+func (c *Cluster) deadlineExceeded() bool {
+	c.deadlineLock.Lock()
+	defer c.deadlineLock.Unlock()
+	return !c.deadline.IsZero() && time.Now().After(c.deadline)
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"k8s.io/client-go/1.5/kubernetes/fake"
+)
+
+func TestReconcile(t *testing.T) {
+	// a new cluster where the mons start and form quorum
+	clientset := fake.NewSimpleClientset()
+	convertSecretStringData(clientset)
+	startCreatedPods(clientset)
+	c, _ := newTestHealthCluster(map[string]string{
+		"mon_status":        allInQuorumResponse,
+		`"prefix":"status"`: `{"health":{"overall_status":"HEALTH_OK"}}`,
+	})
+	c.PodStartDelay = time.Millisecond
+
+	result, err := c.Reconcile(context.Background(), clientset)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(0), result.Requeue)
+	assert.True(t, result.InQuorum)
+	assert.Equal(t, 3, result.Running)
+	assert.Equal(t, 0, result.Pending)
+	assert.Equal(t, "HEALTH_OK", result.Health)
+
+	_, err = clientset.Core().Secrets("ns").Get(appName)
+	assert.Nil(t, err)
+	status, err := clientset.Core().ConfigMaps("ns").Get(StatusConfigMapName)
+	assert.Nil(t, err)
+	assert.Equal(t, "3", status.Data["running"])
+	assert.Equal(t, "true", status.Data["inQuorum"])
+	assert.Equal(t, "HEALTH_OK", status.Data["health"])
+
+	// a second reconcile finds the mons in steady state
+	clientset.ClearActions()
+	result, err = c.Reconcile(context.Background(), clientset)
+	assert.Nil(t, err)
+	assert.True(t, result.InQuorum)
+	for _, a := range clientset.Actions() {
+		assert.False(t, a.Matches("create", "pods"))
+	}
+
+	// nothing is done when the context is already cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	clientset.ClearActions()
+	_, err = c.Reconcile(ctx, clientset)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 0, len(clientset.Actions()))
+}
+
+func TestReconcileDeadline(t *testing.T) {
+	// the mon pods never start
+	clientset := fake.NewSimpleClientset(testMonSecret("ns"))
+	c, _ := newTestHealthCluster(map[string]string{"mon_status": allInQuorumResponse})
+	c.PodStartRetries = 1000
+	c.PodStartDelay = time.Millisecond
+	c.ReconcileDeadline = 20 * time.Millisecond
+
+	// without the deadline the waits would take at least a second
+	start := time.Now()
+	result, err := c.Reconcile(context.Background(), clientset)
+	assert.Equal(t, ErrReconcileDeadlineExceeded, err)
+	assert.True(t, time.Since(start) < 500*time.Millisecond)
+	assert.NotEqual(t, "", result.Error)
+
+	status, err := clientset.Core().ConfigMaps("ns").Get(StatusConfigMapName)
+	assert.Nil(t, err)
+	assert.Equal(t, result.Error, status.Data["error"])
+
+	// the deadline is only for the one reconcile
+	assert.False(t, c.deadlineExceeded())
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rook/rook/pkg/cephmgr/client"
+	"github.com/rook/rook/pkg/cephmgr/mon"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/client-go/1.5/kubernetes"
+	"k8s.io/client-go/1.5/pkg/api"
+)
+
+// ErrQuorumAtRisk is returned when the remaining mons would not have quorum after a mon is removed
+var ErrQuorumAtRisk = fmt.Errorf("removing the mon would leave too few mons in quorum")
+
+// the response of the quorum_status command
+type quorumStatus struct {
+	QuorumNames []string `json:"quorum_names"`
+}
+
+// RemoveMon removes the mon from the monmap and deletes its pod and data. The mon is only removed if the other
+// mons in quorum are a majority of the remaining monmap.
+func (c *Cluster) RemoveMon(clientset kubernetes.Interface, clusterInfo *mon.ClusterInfo, name string) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+	return c.removeMon(clientset, clusterInfo, c.Namespace, name, false)
+}
+
+// GracefulRemoveMon removes the mon like RemoveMon, but waits for the mon to leave quorum before its pod is
+// deleted so the remaining mons are not disrupted during planned maintenance. The pod is deleted anyway when
+// the mon does not leave quorum in time.
+func (c *Cluster) GracefulRemoveMon(clientset kubernetes.Interface, clusterInfo *mon.ClusterInfo, name string) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+	return c.removeMon(clientset, clusterInfo, c.Namespace, name, true)
+}
+
+// remove the mon from the monmap of the mons in the namespace. the caller holds the ops lock.
+func (c *Cluster) removeMon(clientset kubernetes.Interface, clusterInfo *mon.ClusterInfo, namespace, name string, graceful bool) error {
+	conn, err := c.connect(clusterInfo)
+	if err != nil {
+		return err
+	}
+	defer conn.Shutdown()
+
+	status, err := client.GetMonStatus(conn)
+	if err != nil {
+		return fmt.Errorf("failed to get mon status. %+v", err)
+	}
+	inMonMap, err := checkRemovalQuorum(status, name)
+	if err != nil {
+		return err
+	}
+
+	if inMonMap {
+		logger.Infof("removing mon %s from the monmap", name)
+		cmd := map[string]interface{}{"prefix": "mon remove", "name": name}
+		if _, err := client.ExecuteMonCommand(conn, cmd, "mon remove"); err != nil {
+			return fmt.Errorf("failed to remove mon %s from the monmap. %+v", name, err)
+		}
+	}
+	if graceful {
+		if err := c.waitForMonToLeaveQuorum(conn, name); err != nil {
+			logger.Warningf("deleting mon %s that did not leave quorum. %+v", name, err)
+		}
+	}
+
+	err = clientset.Core().Pods(namespace).Delete(name, &api.DeleteOptions{})
+	if err != nil && !k8sutil.IsKubernetesResourceNotFoundError(err) {
+		return fmt.Errorf("failed to delete the pod of mon %s. %+v", name, err)
+	}
+	if c.usePVC() {
+		err := clientset.Core().PersistentVolumeClaims(namespace).Delete(dataVolumeClaimName(name), &api.DeleteOptions{})
+		if err != nil && !k8sutil.IsKubernetesResourceNotFoundError(err) {
+			return fmt.Errorf("failed to delete the data of mon %s. %+v", name, err)
+		}
+	}
+
+	delete(clusterInfo.Monitors, name)
+	if err := c.saveEndpoints(clientset, namespace, clusterInfo); err != nil {
+		return err
+	}
+	logger.Infof("removed mon %s", name)
+	return nil
+}
+
+// whether the mon is in the monmap. ErrQuorumAtRisk if the other mons in quorum would not be a majority of the
+// monmap without the mon.
+func checkRemovalQuorum(status client.MonStatusResponse, name string) (bool, error) {
+	inMonMap := false
+	for _, m := range status.MonMap.Mons {
+		if m.Name == name {
+			inMonMap = true
+		}
+	}
+	size := len(status.MonMap.Mons)
+	remaining := len(status.Quorum)
+	if inMonMap {
+		size--
+	}
+	if monInQuorum(status, name) {
+		remaining--
+	}
+	if remaining < QuorumMajority(size) {
+		logger.Warningf("cannot remove mon %s. %d mons would be in quorum and %d are required", name, remaining, QuorumMajority(size))
+		return inMonMap, ErrQuorumAtRisk
+	}
+	return inMonMap, nil
+}
+
+// poll the quorum until the remaining mons have formed quorum without the mon
+func (c *Cluster) waitForMonToLeaveQuorum(conn client.Connection, name string) error {
+	for i := 0; i < c.PodStartRetries; i++ {
+		buf, err := client.ExecuteMonCommand(conn, map[string]interface{}{"prefix": "quorum_status"}, "quorum_status")
+		if err != nil {
+			logger.Warningf("failed to get quorum status. %+v", err)
+		} else {
+			var status quorumStatus
+			if err := json.Unmarshal(buf, &status); err != nil {
+				logger.Warningf("failed to unmarshal quorum status. %+v", err)
+			} else if !containsString(status.QuorumNames, name) {
+				logger.Infof("mon %s left quorum", name)
+				return nil
+			}
+		}
+
+		logger.Infof("waiting %v for mon %s to leave quorum", c.PodStartDelay, name)
+		<-time.After(c.PodStartDelay)
+	}
+	return fmt.Errorf("timed out waiting for mon %s to leave quorum", name)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rook/rook/pkg/cephmgr/client/test"
+	"github.com/rook/rook/pkg/cephmgr/mon"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/1.5/kubernetes/fake"
+	"k8s.io/client-go/1.5/pkg/api/resource"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+	"k8s.io/client-go/1.5/pkg/runtime"
+	core "k8s.io/client-go/1.5/testing"
+)
+
+func TestRemoveMon(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		testMonPod("mon0", "ns", "1.2.3.4", v1.PodRunning),
+		testMonPod("mon1", "ns", "1.2.3.5", v1.PodRunning),
+		testMonPod("mon2", "ns", "1.2.3.6", v1.PodRunning))
+
+	// mon1 is out of quorum
+	removed := []string{}
+	conn := &test.MockConnection{
+		MockMonCommand: func(args []byte) ([]byte, string, error) {
+			if strings.Contains(string(args), "mon remove") {
+				removed = append(removed, string(args))
+				return []byte{}, "", nil
+			}
+			return []byte(`{"quorum":[0,2],"monmap":{"mons":[{"name":"mon0","rank":0},{"name":"mon1","rank":1},{"name":"mon2","rank":2}]}}`), "", nil
+		},
+	}
+	c := New("ns", &test.MockConnectionFactory{Conn: conn}, "myversion")
+	c.configDir = "/tmp"
+	c.DataVolumeSize = resource.MustParse("10Gi")
+	info := testClusterInfo()
+	info.Monitors["mon0"] = mon.ToCephMon("mon0", "1.2.3.4")
+	info.Monitors["mon1"] = mon.ToCephMon("mon1", "1.2.3.5")
+	info.Monitors["mon2"] = mon.ToCephMon("mon2", "1.2.3.6")
+
+	// removing a mon in quorum leaves one of the two remaining mons in quorum
+	err := c.RemoveMon(clientset, info, "mon0")
+	assert.Equal(t, ErrQuorumAtRisk, err)
+	assert.Equal(t, 0, len(removed))
+	assert.Equal(t, 3, len(info.Monitors))
+	_, err = clientset.Core().Pods("ns").Get("mon0")
+	assert.Nil(t, err)
+
+	// the mon out of quorum can be removed
+	err = c.RemoveMon(clientset, info, "mon1")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(removed))
+	assert.True(t, strings.Contains(removed[0], `"name":"mon1"`))
+	assert.Equal(t, 2, len(info.Monitors))
+	_, err = clientset.Core().Pods("ns").Get("mon1")
+	assert.NotNil(t, err)
+	claimDeletes := 0
+	for _, a := range clientset.Actions() {
+		if a.Matches("delete", "persistentvolumeclaims") {
+			claimDeletes++
+		}
+	}
+	assert.Equal(t, 1, claimDeletes)
+	endpoints, err := clientset.Core().ConfigMaps("ns").Get(EndpointConfigMapName)
+	assert.Nil(t, err)
+	assert.Equal(t, "mon0=1.2.3.4:6790,mon2=1.2.3.6:6790", endpoints.Data[EndpointDataKey])
+}
+
+func TestGracefulRemoveMon(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		testMonPod("mon0", "ns", "1.2.3.4", v1.PodRunning),
+		testMonPod("mon1", "ns", "1.2.3.5", v1.PodRunning),
+		testMonPod("mon2", "ns", "1.2.3.6", v1.PodRunning))
+
+	// mon2 is still reported in quorum on the first two polls after it is removed from the monmap
+	quorumPolls := 0
+	leaveAfter := 2
+	conn := &test.MockConnection{
+		MockMonCommand: func(args []byte) ([]byte, string, error) {
+			if strings.Contains(string(args), "quorum_status") {
+				quorumPolls++
+				if quorumPolls <= leaveAfter {
+					return []byte(`{"quorum_names":["mon0","mon1","mon2"]}`), "", nil
+				}
+				return []byte(`{"quorum_names":["mon0","mon1"]}`), "", nil
+			}
+			if strings.Contains(string(args), "mon remove") {
+				return []byte{}, "", nil
+			}
+			return []byte(allInQuorumResponse), "", nil
+		},
+	}
+	pollsAtDelete := -1
+	clientset.PrependReactor("delete", "pods", func(action core.Action) (bool, runtime.Object, error) {
+		pollsAtDelete = quorumPolls
+		return false, nil, nil
+	})
+	c := New("ns", &test.MockConnectionFactory{Conn: conn}, "myversion")
+	c.configDir = "/tmp"
+	c.PodStartRetries = 5
+	c.PodStartDelay = time.Millisecond
+	info := testClusterInfo()
+	info.Monitors["mon0"] = mon.ToCephMon("mon0", "1.2.3.4")
+	info.Monitors["mon1"] = mon.ToCephMon("mon1", "1.2.3.5")
+	info.Monitors["mon2"] = mon.ToCephMon("mon2", "1.2.3.6")
+
+	err := c.GracefulRemoveMon(clientset, info, "mon2")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, pollsAtDelete)
+	assert.Equal(t, 2, len(info.Monitors))
+	_, err = clientset.Core().Pods("ns").Get("mon2")
+	assert.NotNil(t, err)
+
+	// the mon is deleted anyway when it does not leave quorum in time
+	quorumPolls = 0
+	leaveAfter = 10
+	err = c.GracefulRemoveMon(clientset, info, "mon1")
+	assert.Nil(t, err)
+	assert.Equal(t, 5, pollsAtDelete)
+	_, err = clientset.Core().Pods("ns").Get("mon1")
+	assert.NotNil(t, err)
+}
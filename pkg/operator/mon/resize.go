@@ -0,0 +1,63 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"fmt"
+	"sort"
+
+	"k8s.io/client-go/1.5/kubernetes"
+)
+
+// Resize changes the number of mons. New mons are started and must form quorum before the extra mons are
+// removed one at a time from the highest name down. A mon is only removed while the others keep quorum.
+func (c *Cluster) Resize(clientset kubernetes.Interface, size int) error {
+	if err := c.validateSize(size); err != nil {
+		return err
+	}
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+
+	logger.Infof("resizing the mons from %d to %d", c.size(), size)
+	c.Size = size
+	clusterInfo, requeue, err := c.ensureMons(clientset)
+	if err != nil {
+		return fmt.Errorf("failed to resize the mons. %+v", err)
+	}
+	if requeue > 0 {
+		return fmt.Errorf("the mons are not in quorum after the resize to %d mons. retry later", size)
+	}
+
+	desired := map[string]bool{}
+	for i := 0; i < size; i++ {
+		desired[fmt.Sprintf("mon%d", i)] = true
+	}
+	extra := []string{}
+	for name := range clusterInfo.Monitors {
+		if !desired[name] {
+			extra = append(extra, name)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(extra)))
+	for _, name := range extra {
+		if err := c.removeMon(clientset, clusterInfo, c.Namespace, name, false); err != nil {
+			return fmt.Errorf("failed to remove mon %s. %+v", name, err)
+		}
+	}
+	return nil
+}
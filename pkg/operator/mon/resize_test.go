@@ -0,0 +1,71 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/1.5/kubernetes/fake"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+	"k8s.io/client-go/1.5/pkg/runtime"
+)
+
+const fiveInQuorumResponse = `{"quorum":[0,1,2,3,4],"monmap":{"mons":[` +
+	`{"name":"mon0","rank":0},{"name":"mon1","rank":1},{"name":"mon2","rank":2},{"name":"mon3","rank":3},{"name":"mon4","rank":4}]}}`
+
+func TestResizeCeiling(t *testing.T) {
+	clientset := fake.NewSimpleClientset(testMonSecret("ns"))
+	c, _ := newTestHealthCluster(map[string]string{"mon_status": allInQuorumResponse})
+
+	err := c.Resize(clientset, 9)
+	assert.NotNil(t, err)
+	assert.Equal(t, 3, c.Size)
+	assert.Equal(t, 0, len(clientset.Actions()))
+
+	// the auto scaled size stops at the ceiling
+	nodes := []runtime.Object{}
+	for i := 0; i < 9; i++ {
+		nodes = append(nodes, testNode(fmt.Sprintf("node%d", i), v1.ConditionTrue, false))
+	}
+	c.AutoScaleMons = true
+	c.MaxMons = 0
+	assert.Nil(t, c.autoScale(fake.NewSimpleClientset(nodes...)))
+	assert.Equal(t, 7, c.size())
+	assert.Equal(t, 3, c.Size)
+}
+
+func TestResizeDown(t *testing.T) {
+	objects := []runtime.Object{testMonSecret("ns")}
+	for i := 0; i < 5; i++ {
+		objects = append(objects, testMonPod(fmt.Sprintf("mon%d", i), "ns", fmt.Sprintf("1.2.3.%d", i), v1.PodRunning))
+	}
+	clientset := fake.NewSimpleClientset(objects...)
+	c, _ := newTestHealthCluster(map[string]string{"mon_status": fiveInQuorumResponse})
+	c.Size = 5
+	c.PodStartDelay = time.Millisecond
+
+	// the mons with the highest names are removed
+	err := c.Resize(clientset, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, c.Size)
+	assert.Equal(t, []string{"delete mon4", "delete mon3"}, podRestarts(clientset)[len(podRestarts(clientset))-2:])
+	pods, err := clientset.Core().Pods("ns").List(listOptions("rookcluster"))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(pods.Items))
+}
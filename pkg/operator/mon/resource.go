@@ -0,0 +1,237 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/client-go/1.5/kubernetes"
+	"k8s.io/client-go/1.5/pkg/api"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+	extensions "k8s.io/client-go/1.5/pkg/apis/extensions/v1beta1"
+	"k8s.io/client-go/1.5/pkg/types"
+)
+
+const (
+	tprName          = "mon.rook.io"
+	crdName          = "mons.rook.io"
+	resourceGroup    = "rook.io"
+	resourceVersion  = "v1"
+	resourcePlural   = "mons"
+	resourceKind     = "Mon"
+	crdGroupVersion  = "apiextensions.k8s.io/v1beta1"
+	crdResourceName  = "customresourcedefinitions"
+	resourceTypeTPR  = "tpr"
+	resourceTypeCRD  = "crd"
+	resourceDesc     = "Rook mon cluster"
+	crdResourcesPath = "/apis/" + crdGroupVersion + "/" + crdResourceName
+)
+
+// determine whether the mon resource is a custom resource definition or a third party resource.
+// CRDs are preferred on clusters that support them. Older clusters only support TPRs.
+func (c *Cluster) getResourceType(clientset kubernetes.Interface) (string, error) {
+	resources, err := clientset.Discovery().ServerResourcesForGroupVersion(crdGroupVersion)
+	if err != nil {
+		if k8sutil.IsKubernetesResourceNotFoundError(err) {
+			return resourceTypeTPR, nil
+		}
+		return "", fmt.Errorf("failed to discover %s resources. %+v", crdGroupVersion, err)
+	}
+	if resources != nil {
+		for _, r := range resources.APIResources {
+			if r.Name == crdResourceName {
+				return resourceTypeCRD, nil
+			}
+		}
+	}
+	return resourceTypeTPR, nil
+}
+
+// register the mon resource with the api server
+func (c *Cluster) registerResource(clientset kubernetes.Interface) error {
+	resourceType, err := c.getResourceType(clientset)
+	if err != nil {
+		return err
+	}
+	c.resourceType = resourceType
+
+	if resourceType == resourceTypeTPR {
+		return c.createTPR(clientset)
+	}
+
+	if err := c.createCRD(clientset); err != nil {
+		return err
+	}
+	return c.migrateTPR(clientset)
+}
+
+func (c *Cluster) createTPR(clientset kubernetes.Interface) error {
+	tpr := &extensions.ThirdPartyResource{
+		ObjectMeta:  v1.ObjectMeta{Name: tprName},
+		Versions:    []extensions.APIVersion{{Name: resourceVersion}},
+		Description: resourceDesc,
+	}
+	_, err := clientset.Extensions().ThirdPartyResources().Create(tpr)
+	if err != nil {
+		if !k8sutil.IsKubernetesResourceAlreadyExistError(err) {
+			return fmt.Errorf("failed to create mon third party resource. %+v", err)
+		}
+		logger.Infof("mon third party resource already exists")
+	} else {
+		logger.Infof("created mon third party resource")
+	}
+	return nil
+}
+
+func (c *Cluster) createCRD(clientset kubernetes.Interface) error {
+	crd := map[string]interface{}{
+		"apiVersion": crdGroupVersion,
+		"kind":       "CustomResourceDefinition",
+		"metadata":   map[string]interface{}{"name": crdName},
+		"spec": map[string]interface{}{
+			"group":   resourceGroup,
+			"version": resourceVersion,
+			"scope":   "Namespaced",
+			"names": map[string]interface{}{
+				"plural":   resourcePlural,
+				"singular": appName,
+				"kind":     resourceKind,
+			},
+		},
+	}
+	body, err := json.Marshal(crd)
+	if err != nil {
+		return fmt.Errorf("failed to marshal mon custom resource definition. %+v", err)
+	}
+
+	err = clientset.Core().GetRESTClient().Post().AbsPath(crdResourcesPath).Body(body).Do().Error()
+	if err != nil {
+		if !k8sutil.IsKubernetesResourceAlreadyExistError(err) {
+			return fmt.Errorf("failed to create mon custom resource definition. %+v", err)
+		}
+		logger.Infof("mon custom resource definition already exists")
+	} else {
+		logger.Infof("created mon custom resource definition")
+	}
+	return nil
+}
+
+// The CRD is served at the same path as the TPR. Deleting the TPR after the CRD is created
+// signals the api server to migrate the stored TPR objects to the CRD.
+func (c *Cluster) migrateTPR(clientset kubernetes.Interface) error {
+	_, err := clientset.Extensions().ThirdPartyResources().Get(tprName)
+	if err != nil {
+		if k8sutil.IsKubernetesResourceNotFoundError(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to get mon third party resource. %+v", err)
+	}
+
+	logger.Infof("migrating mon third party resource to a custom resource definition")
+	err = clientset.Extensions().ThirdPartyResources().Delete(tprName, &api.DeleteOptions{})
+	if err != nil && !k8sutil.IsKubernetesResourceNotFoundError(err) {
+		return fmt.Errorf("failed to delete mon third party resource. %+v", err)
+	}
+	return nil
+}
+
+// the spec of the mon resource. fields that are not set keep their current value.
+type monSpec struct {
+	Size         *int   `json:"size,omitempty"`
+	AntiAffinity *bool  `json:"antiAffinity,omitempty"`
+	Port         *int32 `json:"port,omitempty"`
+	HostNetwork  *bool  `json:"hostNetwork,omitempty"`
+	Version      string `json:"version,omitempty"`
+}
+
+type monResource struct {
+	Metadata struct {
+		Name string    `json:"name"`
+		UID  types.UID `json:"uid"`
+	} `json:"metadata"`
+	Spec monSpec `json:"spec"`
+}
+
+// the path of a mon resource object. tprs and crds are served at the same path.
+func resourcePath(namespace, name string) string {
+	return fmt.Sprintf("/apis/%s/%s/namespaces/%s/%s/%s", resourceGroup, resourceVersion, namespace, resourcePlural, name)
+}
+
+func getRESTResource(clientset kubernetes.Interface, path string) ([]byte, error) {
+	return clientset.Core().GetRESTClient().Get().AbsPath(path).DoRaw()
+}
+
+func putRESTResource(clientset kubernetes.Interface, path string, body []byte) error {
+	return clientset.Core().GetRESTClient().Put().AbsPath(path).Body(body).Do().Error()
+}
+
+// the mon resource object is named after the cluster
+func (c *Cluster) resourceName() string {
+	if c.ClusterName == "" {
+		return appName
+	}
+	return c.ClusterName
+}
+
+// LoadSpec reads the desired state of the mons from the mon resource named after the cluster. The
+// current settings are kept if the resource does not exist.
+func (c *Cluster) LoadSpec(clientset kubernetes.Interface) error {
+	name := c.resourceName()
+
+	body, err := c.getResource(clientset, resourcePath(c.Namespace, name))
+	if err != nil {
+		if k8sutil.IsKubernetesResourceNotFoundError(err) {
+			logger.Infof("mon resource %s not found. using the default settings", name)
+			c.recordOwner(nil)
+			return nil
+		}
+		return fmt.Errorf("failed to get mon resource %s. %+v", name, err)
+	}
+
+	var resource monResource
+	if err := json.Unmarshal(body, &resource); err != nil {
+		return fmt.Errorf("failed to unmarshal mon resource %s. %+v", name, err)
+	}
+
+	c.recordOwner(&resource)
+
+	spec := resource.Spec
+	if spec.Size != nil {
+		if *spec.Size < 1 {
+			return fmt.Errorf("invalid mon count %d in mon resource %s", *spec.Size, name)
+		}
+		c.Size = *spec.Size
+	}
+	if spec.AntiAffinity != nil {
+		c.AntiAffinity = *spec.AntiAffinity
+	}
+	if spec.Port != nil {
+		if *spec.Port < 1 || *spec.Port > 65535 {
+			return fmt.Errorf("invalid mon port %d in mon resource %s", *spec.Port, name)
+		}
+		c.Port = *spec.Port
+	}
+	if spec.HostNetwork != nil {
+		c.HostNetwork = *spec.HostNetwork
+	}
+	if spec.Version != "" {
+		c.Version = spec.Version
+	}
+	logger.Infof("loaded mon resource %s. size=%d", name, c.Size)
+	return nil
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/1.5/kubernetes"
+	"k8s.io/client-go/1.5/kubernetes/fake"
+	"k8s.io/client-go/1.5/pkg/api/errors"
+	"k8s.io/client-go/1.5/pkg/api/unversioned"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+)
+
+func TestResourceType(t *testing.T) {
+	c := New("ns", nil, "myversion")
+
+	// older clusters only support third party resources
+	clientset := fake.NewSimpleClientset()
+	resourceType, err := c.getResourceType(clientset)
+	assert.Nil(t, err)
+	assert.Equal(t, resourceTypeTPR, resourceType)
+
+	err = c.registerResource(clientset)
+	assert.Nil(t, err)
+	tpr, err := clientset.Extensions().ThirdPartyResources().Get(tprName)
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", tpr.Versions[0].Name)
+
+	// the crd is preferred when the api server supports it
+	clientset.Resources = map[string]*unversioned.APIResourceList{
+		crdGroupVersion: {
+			GroupVersion: crdGroupVersion,
+			APIResources: []unversioned.APIResource{{Name: crdResourceName, Kind: "CustomResourceDefinition"}},
+		},
+	}
+	resourceType, err = c.getResourceType(clientset)
+	assert.Nil(t, err)
+	assert.Equal(t, resourceTypeCRD, resourceType)
+}
+
+func TestLoadSpec(t *testing.T) {
+	c := New("ns", nil, "myversion")
+	c.ClusterName = "rookcluster"
+
+	// a mon resource object as served for the tpr or crd
+	var requested string
+	c.getResource = func(clientset kubernetes.Interface, path string) ([]byte, error) {
+		requested = path
+		return []byte(`{"apiVersion":"rook.io/v1","kind":"Mon","metadata":{"name":"rookcluster"},` +
+			`"spec":{"size":5,"antiAffinity":false,"port":6791,"version":"v0.4.0"}}`), nil
+	}
+	err := c.LoadSpec(fake.NewSimpleClientset())
+	assert.Nil(t, err)
+	assert.Equal(t, "/apis/rook.io/v1/namespaces/ns/mons/rookcluster", requested)
+	assert.Equal(t, 5, c.Size)
+	assert.False(t, c.AntiAffinity)
+	assert.Equal(t, int32(6791), c.Port)
+	assert.Equal(t, "v0.4.0", c.Version)
+	assert.False(t, c.HostNetwork)
+
+	// the mons are not spread even with a node for each mon, and listen on the port of the spec
+	nodes := fake.NewSimpleClientset()
+	for _, name := range []string{"node0", "node1", "node2", "node3", "node4"} {
+		_, err := nodes.Core().Nodes().Create(testNode(name, v1.ConditionTrue, false))
+		assert.Nil(t, err)
+	}
+	antiAffinity, err := c.getAntiAffinity(nodes)
+	assert.Nil(t, err)
+	assert.False(t, antiAffinity)
+	assert.Equal(t, "1.2.3.4:6791", c.cephMon("ns", "mon0", "1.2.3.4").Endpoint)
+	config := &MonConfig{Name: "mon0", Port: c.port()}
+	assert.Contains(t, c.makeMonPod(config, testClusterInfo(), antiAffinity, false).Spec.Containers[0].Command[2], "--port=6791")
+
+	// an invalid count or port is rejected
+	c.getResource = func(clientset kubernetes.Interface, path string) ([]byte, error) {
+		return []byte(`{"spec":{"size":0}}`), nil
+	}
+	assert.NotNil(t, c.LoadSpec(fake.NewSimpleClientset()))
+	c.getResource = func(clientset kubernetes.Interface, path string) ([]byte, error) {
+		return []byte(`{"spec":{"port":0}}`), nil
+	}
+	assert.NotNil(t, c.LoadSpec(fake.NewSimpleClientset()))
+
+	// the settings are kept when there is no resource
+	c.getResource = func(clientset kubernetes.Interface, path string) ([]byte, error) {
+		return nil, errors.NewNotFound(unversioned.GroupResource{Group: resourceGroup, Resource: resourcePlural}, "rookcluster")
+	}
+	err = c.LoadSpec(fake.NewSimpleClientset())
+	assert.Nil(t, err)
+	assert.Equal(t, 5, c.Size)
+}
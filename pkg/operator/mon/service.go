@@ -0,0 +1,102 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"fmt"
+
+	"github.com/rook/rook/pkg/cephmgr/mon"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/client-go/1.5/kubernetes"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+	"k8s.io/client-go/1.5/pkg/util/intstr"
+)
+
+// start the headless service that gives each mon a stable dns name under the subdomain
+func (c *Cluster) startService(clientset kubernetes.Interface, namespace string, clusterInfo *mon.ClusterInfo) error {
+	labels := getLabels(clusterInfo.Name)
+	s := &v1.Service{
+		ObjectMeta: v1.ObjectMeta{
+			Name:            c.Subdomain,
+			Namespace:       namespace,
+			Labels:          labels,
+			Annotations:     c.operatorAnnotations(),
+			OwnerReferences: c.ownerReferences(),
+		},
+		Spec: v1.ServiceSpec{
+			ClusterIP: v1.ClusterIPNone,
+			Ports: []v1.ServicePort{
+				{
+					Name:       "client",
+					Port:       c.port(),
+					TargetPort: intstr.FromInt(int(c.port())),
+					Protocol:   v1.ProtocolTCP,
+				},
+			},
+			Selector: labels,
+		},
+	}
+
+	if c.V2Port != 0 {
+		s.Spec.Ports = append(s.Spec.Ports, v1.ServicePort{
+			Name:       "msgr2",
+			Port:       c.V2Port,
+			TargetPort: intstr.FromInt(int(c.V2Port)),
+			Protocol:   v1.ProtocolTCP,
+		})
+	}
+
+	_, err := clientset.Core().Services(namespace).Create(s)
+	if err != nil {
+		if !k8sutil.IsKubernetesResourceAlreadyExistError(err) {
+			return fmt.Errorf("failed to create mon service. %+v", err)
+		}
+		return c.reconcileServiceSelector(clientset, namespace, labels)
+	}
+
+	logger.Infof("mon service %s started", c.Subdomain)
+	return nil
+}
+
+// a service created with an older label scheme no longer selects the mon pods. update its selector to the current labels.
+func (c *Cluster) reconcileServiceSelector(clientset kubernetes.Interface, namespace string, labels map[string]string) error {
+	existing, err := clientset.Core().Services(namespace).Get(c.Subdomain)
+	if err != nil {
+		return fmt.Errorf("failed to get mon service. %+v", err)
+	}
+	if len(existing.Spec.Selector) == len(labels) && labelsMatch(existing.Spec.Selector, labels) {
+		logger.Infof("mon service %s already exists", c.Subdomain)
+		return nil
+	}
+	if c.foreign(existing.ObjectMeta) {
+		return nil
+	}
+
+	logger.Infof("updating the selector of mon service %s from %v to %v", c.Subdomain, existing.Spec.Selector, labels)
+	existing.Spec.Selector = labels
+	if _, err := clientset.Core().Services(namespace).Update(existing); err != nil {
+		return fmt.Errorf("failed to update mon service. %+v", err)
+	}
+	return nil
+}
+
+// the host recorded in the monmap for the mon. with a subdomain the mon is reached by its stable dns name.
+func (c *Cluster) monHost(namespace, name, podIP string) string {
+	if c.Subdomain == "" {
+		return podIP
+	}
+	return fmt.Sprintf("%s.%s.%s.svc", name, c.Subdomain, namespace)
+}
@@ -0,0 +1,49 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/1.5/kubernetes/fake"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+)
+
+func TestServiceSelectorReconcile(t *testing.T) {
+	// a service created with an older label scheme
+	stale := &v1.Service{
+		ObjectMeta: v1.ObjectMeta{Name: "rook-mon", Namespace: "ns"},
+		Spec:       v1.ServiceSpec{ClusterIP: v1.ClusterIPNone, Selector: map[string]string{"app": "mon"}},
+	}
+	clientset := fake.NewSimpleClientset(stale)
+	c := New("ns", nil, "myversion")
+	c.Subdomain = "rook-mon"
+
+	err := c.startService(clientset, "ns", testClusterInfo())
+	assert.Nil(t, err)
+	s, err := clientset.Core().Services("ns").Get("rook-mon")
+	assert.Nil(t, err)
+	assert.Equal(t, getLabels("rookcluster"), s.Spec.Selector)
+
+	// the service is not updated when the selector is current
+	clientset.ClearActions()
+	err = c.startService(clientset, "ns", testClusterInfo())
+	assert.Nil(t, err)
+	for _, a := range clientset.Actions() {
+		assert.False(t, a.Matches("update", "services"))
+	}
+}
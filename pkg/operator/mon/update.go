@@ -0,0 +1,180 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rook/rook/pkg/cephmgr/mon"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/client-go/1.5/kubernetes"
+	"k8s.io/client-go/1.5/pkg/api"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+)
+
+// Restart the running mons that were created from a different config, different resources, or different
+// tolerations than they have now. The mons are restarted one at a time and quorum must be restored before the next mon is restarted.
+func (c *Cluster) restartChangedMons(clientset kubernetes.Interface, clusterInfo *mon.ClusterInfo, mons []*MonConfig) error {
+	running, _, err := c.pollPods(clientset, c.Namespace, clusterInfo.Name)
+	if err != nil {
+		return fmt.Errorf("failed to get mon pods. %+v", err)
+	}
+
+	outdated := map[string]bool{}
+	for _, m := range mons {
+		for _, p := range running {
+			if p.Name != m.Name || c.foreign(p.ObjectMeta) {
+				continue
+			}
+			if c.podOutdated(p, m) {
+				outdated[p.Name] = true
+			}
+			if v := p.Annotations[operatorVersionAnnotation]; v != c.OperatorVersion {
+				// the mon keeps running. it picks up changes of the new operator the next time it is restarted.
+				logger.Infof("mon %s was created by operator version %q. the operator is version %q", p.Name, v, c.OperatorVersion)
+			}
+		}
+	}
+	if len(outdated) == 0 {
+		return nil
+	}
+
+	antiAffinity, err := c.getAntiAffinity(clientset)
+	if err != nil {
+		return fmt.Errorf("failed to get antiaffinity. %+v", err)
+	}
+
+	for _, m := range mons {
+		if !outdated[m.Name] {
+			continue
+		}
+		// a single mon cannot keep quorum while it restarts, but would never get its config otherwise
+		if _, current, required := c.HasQuorum(clusterInfo); c.size() > 1 && current <= required {
+			return fmt.Errorf("cannot restart mon %s. %d mons are in quorum and %d are required", m.Name, current, required)
+		}
+		logger.Infof("restarting mon %s to apply its config", m.Name)
+		if err := c.restartMon(clientset, clusterInfo, m, antiAffinity); err != nil {
+			return fmt.Errorf("failed to restart mon %s. %+v", m.Name, err)
+		}
+	}
+	return nil
+}
+
+// Once the cluster has grown to enough nodes for anti-affinity, the mons that were placed on the same node
+// are restarted with anti-affinity so they are spread across the nodes. The first mon on each node stays.
+// The mons are moved one at a time and quorum must be restored before the next mon is moved.
+func (c *Cluster) relocateColocatedMons(clientset kubernetes.Interface, clusterInfo *mon.ClusterInfo, mons []*MonConfig) ([]string, error) {
+	antiAffinity, err := c.getAntiAffinity(clientset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get antiaffinity. %+v", err)
+	}
+	if !antiAffinity {
+		return nil, nil
+	}
+
+	running, _, err := c.pollPods(clientset, c.Namespace, clusterInfo.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mon pods. %+v", err)
+	}
+	nodes := map[string]string{}
+	for _, p := range running {
+		if !c.foreign(p.ObjectMeta) {
+			nodes[p.Name] = p.Spec.NodeName
+		}
+	}
+
+	relocated := []string{}
+	occupied := map[string]bool{}
+	for _, m := range mons {
+		node, ok := nodes[m.Name]
+		if !ok || node == "" {
+			continue
+		}
+		if !occupied[node] {
+			occupied[node] = true
+			continue
+		}
+
+		if _, current, required := c.HasQuorum(clusterInfo); current <= required {
+			return relocated, fmt.Errorf("cannot move mon %s. %d mons are in quorum and %d are required", m.Name, current, required)
+		}
+		logger.Infof("moving mon %s off node %s that it shares with another mon", m.Name, node)
+		if err := c.restartMon(clientset, clusterInfo, m, antiAffinity); err != nil {
+			return relocated, fmt.Errorf("failed to move mon %s. %+v", m.Name, err)
+		}
+		relocated = append(relocated, m.Name)
+	}
+	return relocated, nil
+}
+
+// whether the pod was created from a different config, different resources, or different tolerations than the
+// mon has now
+func (c *Cluster) podOutdated(pod *v1.Pod, config *MonConfig) bool {
+	return pod.Annotations[configHashAnnotation] != c.configHash() ||
+		pod.Annotations[resourcesHashAnnotation] != c.resourcesHash(config) ||
+		pod.Annotations[api.TolerationsAnnotationKey] != c.tolerationsAnnotation()
+}
+
+// replace the mon pod with a pod from the current config and wait for the mon to rejoin quorum
+func (c *Cluster) restartMon(clientset kubernetes.Interface, clusterInfo *mon.ClusterInfo, config *MonConfig, antiAffinity bool) error {
+	err := clientset.Core().Pods(c.Namespace).Delete(config.Name, &api.DeleteOptions{})
+	if err != nil && !k8sutil.IsKubernetesResourceNotFoundError(err) {
+		return fmt.Errorf("failed to delete mon pod. %+v", err)
+	}
+	if err := c.waitForPodToDelete(clientset, config.Name); err != nil {
+		return err
+	}
+
+	monPod := c.makeMonPod(config, clusterInfo, antiAffinity, false)
+	if _, err := clientset.Core().Pods(c.Namespace).Create(monPod); err != nil {
+		return createPodError(monPod.Name, err)
+	}
+
+	running, err := c.waitForPodToStart(clientset, monPod)
+	if err != nil {
+		return err
+	}
+	clusterInfo.Monitors[config.Name] = c.cephMon(c.Namespace, config.Name, c.monIP(running))
+	c.captureFailureDomain(clientset, clusterInfo, running)
+	c.recordCreated(running)
+	if err := c.saveEndpoints(clientset, c.Namespace, clusterInfo); err != nil {
+		return err
+	}
+
+	return c.WaitForQuorum(clusterInfo)
+}
+
+// pods are deleted gracefully. the pod must be gone before a pod with the same name can be created.
+func (c *Cluster) waitForPodToDelete(clientset kubernetes.Interface, name string) error {
+	for i := 0; i < c.PodStartRetries; i++ {
+		if c.deadlineExceeded() {
+			return ErrReconcileDeadlineExceeded
+		}
+		_, err := clientset.Core().Pods(c.Namespace).Get(name)
+		if err != nil {
+			if k8sutil.IsKubernetesResourceNotFoundError(err) {
+				return nil
+			}
+			return fmt.Errorf("failed to get mon pod %s. %+v", name, err)
+		}
+
+		logger.Infof("waiting %v for pod %s to be deleted", c.PodStartDelay, name)
+		<-time.After(c.PodStartDelay)
+	}
+
+	return fmt.Errorf("timed out waiting for pod %s to be deleted", name)
+}
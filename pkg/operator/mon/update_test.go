@@ -0,0 +1,161 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/1.5/kubernetes/fake"
+	"k8s.io/client-go/1.5/pkg/api"
+	"k8s.io/client-go/1.5/pkg/api/resource"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+	"k8s.io/client-go/1.5/pkg/runtime"
+	core "k8s.io/client-go/1.5/testing"
+)
+
+// the order in which mon pods were deleted and created
+func podRestarts(clientset *fake.Clientset) []string {
+	restarts := []string{}
+	for _, a := range clientset.Actions() {
+		if a.Matches("delete", "pods") {
+			restarts = append(restarts, "delete "+a.(core.DeleteAction).GetName())
+		}
+		if a.Matches("create", "pods") {
+			restarts = append(restarts, "create "+a.(core.CreateAction).GetObject().(*v1.Pod).Name)
+		}
+	}
+	return restarts
+}
+
+func TestResourceChangeRollingRestart(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		testMonSecret("ns"),
+		testMonPod("mon0", "ns", "1.2.3.4", v1.PodRunning),
+		testMonPod("mon1", "ns", "1.2.3.5", v1.PodRunning),
+		testMonPod("mon2", "ns", "1.2.3.6", v1.PodRunning))
+	startCreatedPods(clientset)
+
+	c, info := newTestHealthCluster(map[string]string{"mon_status": allInQuorumResponse})
+	c.PodStartRetries = 2
+	c.PodStartDelay = time.Millisecond
+	c.MonResources = v1.ResourceRequirements{
+		Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse("1Gi")},
+	}
+
+	_, _, err := c.EnsureMons(clientset)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"delete mon0", "create mon0", "delete mon1", "create mon1", "delete mon2", "create mon2"}, podRestarts(clientset))
+	pod, err := clientset.Core().Pods("ns").Get("mon2")
+	assert.Nil(t, err)
+	memory := pod.Spec.Containers[0].Resources.Limits[v1.ResourceMemory]
+	assert.Equal(t, "1Gi", memory.String())
+
+	// only the mon with new resources is restarted
+	override := &v1.ResourceRequirements{
+		Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse("4Gi")},
+	}
+	mons := []*MonConfig{{Name: "mon0", Port: 6790}, {Name: "mon1", Port: 6790, Resources: override}, {Name: "mon2", Port: 6790}}
+	clientset.ClearActions()
+	err = c.restartChangedMons(clientset, info, mons)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"delete mon1", "create mon1"}, podRestarts(clientset))
+
+	// nothing is restarted when the resources did not change
+	clientset.ClearActions()
+	err = c.restartChangedMons(clientset, info, mons)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(podRestarts(clientset)))
+}
+
+func TestRelocateColocatedMons(t *testing.T) {
+	// the mons were placed on the only node of a small cluster
+	pods := []runtime.Object{testMonSecret("ns"), testNode("node0", v1.ConditionTrue, false)}
+	for i, ip := range []string{"1.2.3.4", "1.2.3.5", "1.2.3.6"} {
+		pod := testMonPod(fmt.Sprintf("mon%d", i), "ns", ip, v1.PodRunning)
+		pod.Spec.NodeName = "node0"
+		pods = append(pods, pod)
+	}
+	clientset := fake.NewSimpleClientset(pods...)
+	startCreatedPods(clientset)
+
+	c, info := newTestHealthCluster(map[string]string{"mon_status": allInQuorumResponse})
+	c.PodStartRetries = 2
+	c.PodStartDelay = time.Millisecond
+	mons := []*MonConfig{{Name: "mon0", Port: 6790}, {Name: "mon1", Port: 6790}, {Name: "mon2", Port: 6790}}
+
+	// nothing is moved while there are not enough nodes
+	relocated, err := c.relocateColocatedMons(clientset, info, mons)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(relocated))
+
+	// the cluster grows to three nodes
+	for _, name := range []string{"node1", "node2"} {
+		_, err := clientset.Core().Nodes().Create(testNode(name, v1.ConditionTrue, false))
+		assert.Nil(t, err)
+	}
+	clientset.ClearActions()
+	relocated, err = c.relocateColocatedMons(clientset, info, mons)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"mon1", "mon2"}, relocated)
+	assert.Equal(t, []string{"delete mon1", "create mon1", "delete mon2", "create mon2"}, podRestarts(clientset))
+	pod, err := clientset.Core().Pods("ns").Get("mon2")
+	assert.Nil(t, err)
+	assert.NotEqual(t, "", pod.Annotations[api.AffinityAnnotationKey])
+}
+
+func TestTolerationChangeRollingRestart(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		testMonSecret("ns"),
+		testMonPod("mon0", "ns", "1.2.3.4", v1.PodRunning),
+		testMonPod("mon1", "ns", "1.2.3.5", v1.PodRunning),
+		testMonPod("mon2", "ns", "1.2.3.6", v1.PodRunning))
+	startCreatedPods(clientset)
+
+	c, info := newTestHealthCluster(map[string]string{"mon_status": allInQuorumResponse})
+	c.PodStartRetries = 2
+	c.PodStartDelay = time.Millisecond
+	c.Tolerations = []v1.Toleration{{Key: "storage", Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoSchedule}}
+
+	_, _, err := c.EnsureMons(clientset)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"delete mon0", "create mon0", "delete mon1", "create mon1", "delete mon2", "create mon2"}, podRestarts(clientset))
+	pod, err := clientset.Core().Pods("ns").Get("mon1")
+	assert.Nil(t, err)
+	tolerations, err := api.GetTolerationsFromPodAnnotations(pod.Annotations)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(tolerations))
+	assert.Equal(t, "storage", tolerations[0].Key)
+
+	// nothing is restarted when the tolerations did not change
+	mons := []*MonConfig{{Name: "mon0", Port: 6790}, {Name: "mon1", Port: 6790}, {Name: "mon2", Port: 6790}}
+	clientset.ClearActions()
+	err = c.restartChangedMons(clientset, info, mons)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(podRestarts(clientset)))
+
+	// the mons are restarted when the tolerations are removed
+	c.Tolerations = nil
+	clientset.ClearActions()
+	err = c.restartChangedMons(clientset, info, mons)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, len(podRestarts(clientset)))
+	pod, err = clientset.Core().Pods("ns").Get("mon1")
+	assert.Nil(t, err)
+	assert.Equal(t, "", pod.Annotations[api.TolerationsAnnotationKey])
+}
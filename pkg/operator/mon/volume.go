@@ -0,0 +1,212 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rook/rook/pkg/cephmgr/mon"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/client-go/1.5/kubernetes"
+	"k8s.io/client-go/1.5/pkg/api/resource"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+)
+
+const (
+	storageClassAnnotation = "volume.beta.kubernetes.io/storage-class"
+	encryptedParameter     = "encrypted"
+)
+
+// the storage class setting that is newer than the v1beta1 storage types of the client
+type storageClassExpansion struct {
+	AllowVolumeExpansion *bool `json:"allowVolumeExpansion"`
+}
+
+// whether the mon data is stored on a persistent volume claim instead of an empty dir
+func (c *Cluster) usePVC() bool {
+	return !c.DataVolumeSize.IsZero()
+}
+
+func dataVolumeClaimName(monName string) string {
+	return fmt.Sprintf("%s-data", monName)
+}
+
+func (c *Cluster) dataVolumeSource(config *MonConfig) v1.VolumeSource {
+	if c.usePVC() {
+		return v1.VolumeSource{PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: dataVolumeClaimName(config.Name)}}
+	}
+	return v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}
+}
+
+func (c *Cluster) makeDataVolumeClaim(config *MonConfig, clusterInfo *mon.ClusterInfo) *v1.PersistentVolumeClaim {
+	claim := &v1.PersistentVolumeClaim{
+		ObjectMeta: v1.ObjectMeta{
+			Name:        dataVolumeClaimName(config.Name),
+			Namespace:   c.Namespace,
+			Labels:      getLabels(clusterInfo.Name),
+			Annotations: map[string]string{},
+		},
+		Spec: v1.PersistentVolumeClaimSpec{
+			AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+			Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{v1.ResourceStorage: c.DataVolumeSize},
+			},
+		},
+	}
+	if c.DataVolumeStorageClass != "" {
+		claim.Annotations[storageClassAnnotation] = c.DataVolumeStorageClass
+	}
+	if c.OperatorID != "" {
+		claim.Annotations[operatorIDAnnotation] = c.OperatorID
+	}
+	return claim
+}
+
+// encryption of the mon data requires a storage class that provisions encrypted volumes. the claims are not marked,
+// the volumes are encrypted by the provisioner of the class.
+func (c *Cluster) validateDataVolumeEncryption(clientset kubernetes.Interface) error {
+	if !c.DataVolumeEncrypted {
+		return nil
+	}
+	if c.DataVolumeStorageClass == "" {
+		return fmt.Errorf("mon data volume encryption requires a storage class")
+	}
+
+	class, err := clientset.Storage().StorageClasses().Get(c.DataVolumeStorageClass)
+	if err != nil {
+		return fmt.Errorf("failed to get storage class %s. %+v", c.DataVolumeStorageClass, err)
+	}
+	if class.Parameters[encryptedParameter] != "true" {
+		return fmt.Errorf("storage class %s does not provision encrypted volumes. set the parameter %s=true on the class",
+			c.DataVolumeStorageClass, encryptedParameter)
+	}
+	return nil
+}
+
+// create the claims for the mon data volumes if they don't exist yet
+func (c *Cluster) createDataVolumeClaims(clientset kubernetes.Interface, namespace string, clusterInfo *mon.ClusterInfo, mons []*MonConfig) error {
+	if !c.usePVC() {
+		return nil
+	}
+
+	if err := c.validateDataVolumeEncryption(clientset); err != nil {
+		return err
+	}
+
+	for _, m := range mons {
+		claim := c.makeDataVolumeClaim(m, clusterInfo)
+		claim.Namespace = namespace
+		_, err := clientset.Core().PersistentVolumeClaims(namespace).Create(claim)
+		if err != nil {
+			if !k8sutil.IsKubernetesResourceAlreadyExistError(err) {
+				return fmt.Errorf("failed to create data volume claim for mon %s. %+v", m.Name, err)
+			}
+			logger.Infof("data volume claim %s already exists", claim.Name)
+		} else {
+			logger.Infof("created data volume claim %s", claim.Name)
+		}
+	}
+	return nil
+}
+
+// ExpandMonVolume grows the data volume claim of the mon to newSize and waits until the volume and its filesystem
+// are resized. The mon keeps running while the volume is expanded. The storage class of the claim must allow
+// volume expansion. The mons that are created later get claims of DataVolumeSize.
+func (c *Cluster) ExpandMonVolume(clientset kubernetes.Interface, monName string, newSize resource.Quantity) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+
+	if !c.usePVC() {
+		return fmt.Errorf("the data of mon %s is not on a volume claim", monName)
+	}
+	name := dataVolumeClaimName(monName)
+	claim, err := clientset.Core().PersistentVolumeClaims(c.Namespace).Get(name)
+	if err != nil {
+		return fmt.Errorf("failed to get data volume claim %s of mon %s. %+v", name, monName, err)
+	}
+	current := claim.Spec.Resources.Requests[v1.ResourceStorage]
+	if newSize.Cmp(current) <= 0 {
+		return fmt.Errorf("the new size %s of data volume claim %s must be larger than its size %s", newSize.String(), name, current.String())
+	}
+	if err := c.validateVolumeExpansion(clientset, claim); err != nil {
+		return err
+	}
+
+	if claim.Spec.Resources.Requests == nil {
+		claim.Spec.Resources.Requests = v1.ResourceList{}
+	}
+	claim.Spec.Resources.Requests[v1.ResourceStorage] = newSize
+	if _, err := clientset.Core().PersistentVolumeClaims(c.Namespace).Update(claim); err != nil {
+		return fmt.Errorf("failed to update the size of data volume claim %s. %+v", name, err)
+	}
+	logger.Infof("expanding data volume claim %s of mon %s from %s to %s", name, monName, current.String(), newSize.String())
+
+	return c.waitForVolumeExpansion(clientset, name, newSize)
+}
+
+func (c *Cluster) validateVolumeExpansion(clientset kubernetes.Interface, claim *v1.PersistentVolumeClaim) error {
+	class := claim.Annotations[storageClassAnnotation]
+	if class == "" {
+		return fmt.Errorf("data volume claim %s has no storage class. the expansion requires a storage class that allows volume expansion", claim.Name)
+	}
+
+	body, err := c.getStorageClass(clientset, class)
+	if err != nil {
+		return fmt.Errorf("failed to get storage class %s. %+v", class, err)
+	}
+	var expansion storageClassExpansion
+	if err := json.Unmarshal(body, &expansion); err != nil {
+		return fmt.Errorf("failed to unmarshal storage class %s. %+v", class, err)
+	}
+	if expansion.AllowVolumeExpansion == nil || !*expansion.AllowVolumeExpansion {
+		return fmt.Errorf("storage class %s of data volume claim %s does not allow volume expansion. set allowVolumeExpansion on the class", class, claim.Name)
+	}
+	return nil
+}
+
+// the storage class from the v1beta1 storage client like the encryption check. the class is not decoded into the
+// typed object so that allowVolumeExpansion is kept.
+func getRawStorageClass(clientset kubernetes.Interface, name string) ([]byte, error) {
+	return clientset.Storage().GetRESTClient().Get().Resource("storageclasses").Name(name).DoRaw()
+}
+
+// the capacity of the claim is raised after the filesystem was resized. until then the claim has the
+// FileSystemResizePending condition.
+func (c *Cluster) waitForVolumeExpansion(clientset kubernetes.Interface, name string, size resource.Quantity) error {
+	for i := 0; i < c.PodStartRetries; i++ {
+		if c.deadlineExceeded() {
+			return ErrReconcileDeadlineExceeded
+		}
+		claim, err := clientset.Core().PersistentVolumeClaims(c.Namespace).Get(name)
+		if err != nil {
+			return fmt.Errorf("failed to get data volume claim %s. %+v", name, err)
+		}
+		capacity := claim.Status.Capacity[v1.ResourceStorage]
+		if capacity.Cmp(size) >= 0 {
+			logger.Infof("data volume claim %s is expanded to %s", name, capacity.String())
+			return nil
+		}
+
+		logger.Infof("waiting %v for data volume claim %s to expand. capacity=%s", c.PodStartDelay, name, capacity.String())
+		<-time.After(c.PodStartDelay)
+	}
+
+	return fmt.Errorf("timed out waiting for data volume claim %s to expand to %s", name, size.String())
+}
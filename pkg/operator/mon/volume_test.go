@@ -0,0 +1,103 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/1.5/kubernetes"
+	"k8s.io/client-go/1.5/kubernetes/fake"
+	"k8s.io/client-go/1.5/pkg/api/resource"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+	storage "k8s.io/client-go/1.5/pkg/apis/storage/v1beta1"
+	"k8s.io/client-go/1.5/pkg/runtime"
+	core "k8s.io/client-go/1.5/testing"
+)
+
+func TestEncryptedDataVolume(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		&storage.StorageClass{ObjectMeta: v1.ObjectMeta{Name: "plain"}},
+		&storage.StorageClass{ObjectMeta: v1.ObjectMeta{Name: "secure"}, Parameters: map[string]string{"encrypted": "true"}})
+	c := New("ns", nil, "myversion")
+	c.DataVolumeSize = resource.MustParse("10Gi")
+	c.DataVolumeEncrypted = true
+	mons := []*MonConfig{{Name: "mon0", Port: 6790}}
+
+	// the storage class must support encryption
+	c.DataVolumeStorageClass = "plain"
+	err := c.createDataVolumeClaims(clientset, "ns", testClusterInfo(), mons)
+	assert.NotNil(t, err)
+
+	c.DataVolumeStorageClass = "secure"
+	err = c.createDataVolumeClaims(clientset, "ns", testClusterInfo(), mons)
+	assert.Nil(t, err)
+	claim, err := clientset.Core().PersistentVolumeClaims("ns").Get("mon0-data")
+	assert.Nil(t, err)
+	assert.Equal(t, "secure", claim.Annotations[storageClassAnnotation])
+	_, marked := claim.Annotations["rook.io/encrypted"]
+	assert.False(t, marked)
+
+	// the pod mounts the claim
+	pod := c.makeMonPod(mons[0], testClusterInfo(), true, false)
+	assert.Equal(t, "mon0-data", pod.Spec.Volumes[0].PersistentVolumeClaim.ClaimName)
+}
+
+func TestExpandMonVolume(t *testing.T) {
+	c := New("ns", nil, "myversion")
+	c.PodStartRetries = 2
+	c.PodStartDelay = time.Millisecond
+	c.DataVolumeSize = resource.MustParse("10Gi")
+	c.DataVolumeStorageClass = "fixed"
+	c.getStorageClass = func(clientset kubernetes.Interface, name string) ([]byte, error) {
+		if name == "resizable" {
+			return []byte(`{"metadata":{"name":"resizable"},"allowVolumeExpansion":true}`), nil
+		}
+		return []byte(`{"metadata":{"name":"fixed"}}`), nil
+	}
+	clientset := fake.NewSimpleClientset()
+	err := c.createDataVolumeClaims(clientset, "ns", testClusterInfo(), []*MonConfig{{Name: "mon0", Port: 6790}})
+	assert.Nil(t, err)
+
+	// the storage class must allow the expansion
+	err = c.ExpandMonVolume(clientset, "mon0", resource.MustParse("20Gi"))
+	assert.NotNil(t, err)
+	claim, err := clientset.Core().PersistentVolumeClaims("ns").Get("mon0-data")
+	assert.Nil(t, err)
+	size := claim.Spec.Resources.Requests[v1.ResourceStorage]
+	assert.Equal(t, "10Gi", size.String())
+
+	// the volume is resized as soon as the claim is updated
+	claim.Annotations[storageClassAnnotation] = "resizable"
+	_, err = clientset.Core().PersistentVolumeClaims("ns").Update(claim)
+	assert.Nil(t, err)
+	clientset.PrependReactor("update", "persistentvolumeclaims", func(action core.Action) (bool, runtime.Object, error) {
+		claim := action.(core.UpdateAction).GetObject().(*v1.PersistentVolumeClaim)
+		claim.Status.Capacity = v1.ResourceList{v1.ResourceStorage: claim.Spec.Resources.Requests[v1.ResourceStorage]}
+		return false, nil, nil
+	})
+	err = c.ExpandMonVolume(clientset, "mon0", resource.MustParse("20Gi"))
+	assert.Nil(t, err)
+	claim, err = clientset.Core().PersistentVolumeClaims("ns").Get("mon0-data")
+	assert.Nil(t, err)
+	size = claim.Spec.Resources.Requests[v1.ResourceStorage]
+	assert.Equal(t, "20Gi", size.String())
+
+	// the volume cannot shrink
+	err = c.ExpandMonVolume(clientset, "mon0", resource.MustParse("15Gi"))
+	assert.NotNil(t, err)
+}
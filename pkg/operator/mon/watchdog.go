@@ -0,0 +1,178 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rook/rook/pkg/cephmgr/client"
+	"github.com/rook/rook/pkg/cephmgr/mon"
+	"golang.org/x/net/context"
+	"k8s.io/client-go/1.5/kubernetes"
+)
+
+// StartHealthWatchdog checks the health of the mons at the interval until the context is cancelled or the returned
+// function is called. A mon that is out of quorum or without a running pod for longer than the FailoverGracePeriod
+// is replaced by a new mon. The watchdog works on a copy of the cluster info, which the caller shares with the other
+// daemons. The mons after a failover are saved to the endpoints and returned by WatchdogClusterInfo.
+func (c *Cluster) StartHealthWatchdog(ctx context.Context, clientset kubernetes.Interface, clusterInfo *mon.ClusterInfo, interval time.Duration) func() {
+	info := deepCopyClusterInfo(clusterInfo)
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-stop:
+				return
+			case <-ticker.C:
+				replaced, err := c.checkHealth(clientset, info)
+				if len(replaced) > 0 {
+					c.publishWatchdogClusterInfo(info)
+				}
+				if err != nil {
+					logger.Warningf("mon health check failed. %+v", err)
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(stop) })
+	}
+}
+
+// WatchdogClusterInfo returns a copy of the cluster info with the mons after the last failover of the health
+// watchdog. nil if the watchdog has not replaced a mon.
+func (c *Cluster) WatchdogClusterInfo() *mon.ClusterInfo {
+	c.watchdogLock.Lock()
+	defer c.watchdogLock.Unlock()
+	if c.watchdogInfo == nil {
+		return nil
+	}
+	return deepCopyClusterInfo(c.watchdogInfo)
+}
+
+func (c *Cluster) publishWatchdogClusterInfo(info *mon.ClusterInfo) {
+	c.watchdogLock.Lock()
+	defer c.watchdogLock.Unlock()
+	c.watchdogInfo = deepCopyClusterInfo(info)
+}
+
+// a copy that shares neither the monitors nor the config of each mon with the cluster info
+func deepCopyClusterInfo(info *mon.ClusterInfo) *mon.ClusterInfo {
+	result := copyClusterInfo(info)
+	for name, m := range result.Monitors {
+		copied := *m
+		result.Monitors[name] = &copied
+	}
+	return result
+}
+
+// fail over the mons that have been down for longer than the grace period. returns the mons that were replaced.
+func (c *Cluster) checkHealth(clientset kubernetes.Interface, clusterInfo *mon.ClusterInfo) ([]string, error) {
+	down, err := c.downMons(clientset, clusterInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	replaced := []string{}
+	for _, name := range down {
+		if err := c.failoverMon(clientset, clusterInfo, name); err != nil {
+			return replaced, fmt.Errorf("failed to fail over mon %s. %+v", name, err)
+		}
+		replaced = append(replaced, name)
+	}
+	return replaced, nil
+}
+
+// the mons that have been down for longer than the grace period
+func (c *Cluster) downMons(clientset kubernetes.Interface, clusterInfo *mon.ClusterInfo) ([]string, error) {
+	conn, err := c.connect(clusterInfo)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Shutdown()
+
+	status, err := client.GetMonStatus(conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mon status. %+v", err)
+	}
+	running, _, err := c.pollPods(clientset, c.Namespace, clusterInfo.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mon pods. %+v", err)
+	}
+	podRunning := map[string]bool{}
+	for _, p := range running {
+		podRunning[p.Name] = !monContainerDown(p)
+	}
+
+	c.downLock.Lock()
+	defer c.downLock.Unlock()
+	if c.downSince == nil {
+		c.downSince = map[string]time.Time{}
+	}
+
+	down := []string{}
+	for name := range clusterInfo.Monitors {
+		if podRunning[name] && monInQuorum(status, name) {
+			delete(c.downSince, name)
+			continue
+		}
+
+		since, ok := c.downSince[name]
+		if !ok {
+			logger.Infof("mon %s is down", name)
+			c.downSince[name] = time.Now()
+			continue
+		}
+		if time.Since(since) < c.FailoverGracePeriod {
+			continue
+		}
+		logger.Warningf("mon %s has been down for %v", name, time.Since(since))
+		delete(c.downSince, name)
+		down = append(down, name)
+	}
+	sort.Strings(down)
+	return down, nil
+}
+
+// replace the mon with a new mon with an empty store. the mon is removed first so the new mon joins the monmap
+// of the other mons. the lock is held until the new mon is started so no other operation sees the smaller monmap.
+func (c *Cluster) failoverMon(clientset kubernetes.Interface, clusterInfo *mon.ClusterInfo, name string) error {
+	logger.Warningf("failing over mon %s", name)
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+
+	if err := c.removeMon(clientset, clusterInfo, c.Namespace, name, false); err != nil {
+		return err
+	}
+
+	current, _, err := c.ensureMons(clientset)
+	if err != nil {
+		return fmt.Errorf("failed to start the new mon. %+v", err)
+	}
+	clusterInfo.Monitors = current.Monitors
+	return nil
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2016 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rook/rook/pkg/cephmgr/mon"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"k8s.io/client-go/1.5/kubernetes/fake"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+)
+
+// mon2 is out of quorum
+const mon2DownResponse = `{"quorum":[0,1],"monmap":{"mons":[{"name":"mon0","rank":0},{"name":"mon1","rank":1},{"name":"mon2","rank":2}]}}`
+
+func newTestWatchdogCluster() (*Cluster, *mon.ClusterInfo, *fake.Clientset) {
+	clientset := fake.NewSimpleClientset(
+		testMonSecret("ns"),
+		testMonPod("mon0", "ns", "1.2.3.4", v1.PodRunning),
+		testMonPod("mon1", "ns", "1.2.3.5", v1.PodRunning),
+		testMonPod("mon2", "ns", "1.2.3.6", v1.PodRunning))
+	startCreatedPods(clientset)
+
+	c, info := newTestHealthCluster(map[string]string{"mon_status": mon2DownResponse})
+	c.PodStartRetries = 2
+	c.PodStartDelay = time.Millisecond
+	info.Monitors["mon1"] = mon.ToCephMon("mon1", "1.2.3.5")
+	info.Monitors["mon2"] = mon.ToCephMon("mon2", "1.2.3.6")
+	return c, info, clientset
+}
+
+func TestHealthFailover(t *testing.T) {
+	c, info, clientset := newTestWatchdogCluster()
+	c.FailoverGracePeriod = time.Hour
+
+	// the down mon is not replaced within the grace period
+	replaced, err := c.checkHealth(clientset, info)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(replaced))
+	replaced, err = c.checkHealth(clientset, info)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(replaced))
+	assert.Equal(t, 0, len(podRestarts(clientset)))
+
+	// the mon is replaced after the grace period
+	c.FailoverGracePeriod = 0
+	replaced, err = c.checkHealth(clientset, info)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"mon2"}, replaced)
+	restarts := strings.Join(podRestarts(clientset), ",")
+	assert.True(t, strings.HasPrefix(restarts, "delete mon2,"))
+	assert.True(t, strings.Contains(restarts, "create mon2"))
+	assert.Equal(t, 3, len(info.Monitors))
+}
+
+func TestStartHealthWatchdog(t *testing.T) {
+	c, info, clientset := newTestWatchdogCluster()
+	c.FailoverGracePeriod = 0
+	assert.Nil(t, c.WatchdogClusterInfo())
+
+	stop := c.StartHealthWatchdog(context.Background(), clientset, info, time.Millisecond)
+	var published *mon.ClusterInfo
+	for i := 0; i < 1000 && published == nil; i++ {
+		<-time.After(time.Millisecond)
+		published = c.WatchdogClusterInfo()
+	}
+	stop()
+	stop()
+	assert.Contains(t, strings.Join(podRestarts(clientset), ","), "delete mon2")
+
+	// the cluster info of the caller is not changed by the watchdog. the new mons are published.
+	assert.Equal(t, "1.2.3.6:6790", info.Monitors["mon2"].Endpoint)
+	if assert.NotNil(t, published) {
+		assert.Equal(t, 3, len(published.Monitors))
+		assert.Equal(t, "10.0.0.1:6790", published.Monitors["mon2"].Endpoint)
+	}
+
+	// the watchdog stops when the context is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	clientset = fake.NewSimpleClientset()
+	c.StartHealthWatchdog(ctx, clientset, info, time.Millisecond)
+	<-time.After(10 * time.Millisecond)
+	assert.Equal(t, 0, len(clientset.Actions()))
+}
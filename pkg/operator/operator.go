@@ -67,6 +67,7 @@ func (o *Operator) Run() error {
 	}
 
 	a := api.New(o.Namespace, o.containerVersion)
+	a.MonSecret = m.MonSecret()
 	err = a.Start(o.clientset, cluster)
 	if err != nil {
 		return fmt.Errorf("failed to start the REST api. %+v", err)
@@ -74,6 +75,7 @@ func (o *Operator) Run() error {
 
 	// Start the OSDs
 	osds := osd.New(o.Namespace, o.containerVersion, o.useAllDevices)
+	osds.MonSecret = m.MonSecret()
 	err = osds.Start(o.clientset, cluster)
 	if err != nil {
 		return fmt.Errorf("failed to start the osds. %+v", err)
@@ -81,6 +83,7 @@ func (o *Operator) Run() error {
 
 	// Start the object store
 	r := rgw.New(o.Namespace, o.containerVersion, o.factory)
+	r.MonSecret = m.MonSecret()
 	err = r.Start(o.clientset, cluster)
 	if err != nil {
 		return fmt.Errorf("failed to start rgw. %+v", err)
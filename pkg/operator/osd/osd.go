@@ -34,6 +34,7 @@ type Cluster struct {
 	Namespace     string
 	Keyring       string
 	Version       string
+	MonSecret     k8smon.MonSecret
 	useAllDevices bool
 }
 
@@ -41,6 +42,7 @@ func New(namespace, version string, useAllDevices bool) *Cluster {
 	return &Cluster{
 		Namespace:     namespace,
 		Version:       version,
+		MonSecret:     k8smon.DefaultMonSecret(),
 		useAllDevices: useAllDevices,
 	}
 }
@@ -115,8 +117,8 @@ func (c *Cluster) osdContainer(cluster *mon.ClusterInfo) v1.Container {
 			{Name: "devices", MountPath: "/dev"},
 		},
 		Env: []v1.EnvVar{
-			k8smon.MonSecretEnvVar(),
-			k8smon.AdminSecretEnvVar(),
+			c.MonSecret.MonSecretEnvVar(),
+			c.MonSecret.AdminSecretEnvVar(),
 		},
 		SecurityContext: &v1.SecurityContext{Privileged: &privileged},
 	}
@@ -39,6 +39,8 @@ type Cluster struct {
 	Namespace string
 	Version   string
 	Replicas  int32
+	// MonSecret is the secret the rgw reads the mon and admin keys from
+	MonSecret k8smon.MonSecret
 	factory   client.ConnectionFactory
 }
 
@@ -47,6 +49,7 @@ func New(namespace, version string, factory client.ConnectionFactory) *Cluster {
 		Namespace: namespace,
 		Version:   version,
 		Replicas:  2,
+		MonSecret: k8smon.DefaultMonSecret(),
 		factory:   factory,
 	}
 }
@@ -166,8 +169,8 @@ func (c *Cluster) rgwContainer(cluster *mon.ClusterInfo) v1.Container {
 		},
 		Env: []v1.EnvVar{
 			{Name: "ROOKD_RGW_KEYRING", ValueFrom: &v1.EnvVarSource{SecretKeyRef: &v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: appName}, Key: keyringName}}},
-			k8smon.MonSecretEnvVar(),
-			k8smon.AdminSecretEnvVar(),
+			c.MonSecret.MonSecretEnvVar(),
+			c.MonSecret.AdminSecretEnvVar(),
 		},
 	}
 }